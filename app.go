@@ -18,16 +18,19 @@ package main
 import (
 	"SLALite/generator"
 	"SLALite/model"
+	"SLALite/model/functions"
 	"SLALite/utils"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	log "github.com/sirupsen/logrus"
 
+	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 	"github.com/spf13/viper"
 )
@@ -67,6 +70,15 @@ func (e *ApiError) Error() string {
 	return e.Message
 }
 
+// ValidationResult is the result of the validation of an agreement or template
+// swagger:model
+type ValidationResult struct {
+	Valid bool `json:"valid"`
+	// Errors contains the validation errors. Errors that do not refer to an
+	// expression have empty field and expression, and position -1
+	Errors []model.ExpressionError `json:"errors"`
+}
+
 // endpoint represents an available operation represented by its HTTP method, the expected path for invocations and an optional help message.
 // swagger:model
 type endpoint struct {
@@ -84,6 +96,8 @@ var api = map[string]endpoint{
 	"providers":  endpoint{"GET", "/providers", "Providers"},
 	"agreements": endpoint{"GET", "/agreements", "Agreements"},
 	"templates":  endpoint{"GET", "/templates", "Templates"},
+	"functions":  endpoint{"GET", "/functions", "Functions available in guarantee constraints"},
+	"validate":   endpoint{"POST", "/validate", "Validation of agreements and templates"},
 }
 
 func NewApp(config *viper.Viper, repository model.IRepository, validator model.Validator) (App, error) {
@@ -161,6 +175,9 @@ func (a *App) initialize(repository model.IRepository) {
 
 	a.Router.Methods("DELETE").Path("/agreements/{id}").Handler(logger(a.DeleteAgreement))
 	a.Router.Methods("GET").Path("/agreements/{id}/details").Handler(logger(a.GetAgreementDetails))
+	a.Router.Methods("GET").Path("/agreements/{id}/maintenance").Handler(logger(a.GetMaintenanceWindows))
+	a.Router.Methods("POST").Path("/agreements/{id}/maintenance").Handler(logger(a.CreateMaintenanceWindow))
+	a.Router.Methods("DELETE").Path("/agreements/{id}/maintenance/{wid}").Handler(logger(a.DeleteMaintenanceWindow))
 
 	a.Router.Methods("GET").Path("/templates").Handler(logger(a.GetTemplates))
 	a.Router.Methods("GET").Path("/templates/{id}").Handler(logger(a.GetTemplate))
@@ -170,6 +187,9 @@ func (a *App) initialize(repository model.IRepository) {
 
 	a.Router.Methods("POST").Path("/notifications").Handler(logger(a.ReceiveNotification))
 
+	a.Router.Methods("GET").Path("/functions").Handler(logger(a.GetFunctions))
+	a.Router.Methods("POST").Path("/validate").Handler(logger(a.Validate))
+
 	// swagger api
 	sh := http.StripPrefix("/swaggerui/", http.FileServer(http.Dir("./swaggerui/")))
 	a.Router.PathPrefix("/swaggerui/").Handler(sh)
@@ -599,6 +619,166 @@ func (a *App) UpdateAgreement(w http.ResponseWriter, r *http.Request) {
 		})
 }
 
+// GetMaintenanceWindows returns the maintenance windows of an agreement
+// swagger:operation GET /agreements/{id}/maintenance getMaintenanceWindows
+//
+// Returns the maintenance windows of the calendar of an agreement
+//
+// ---
+// produces:
+// - application/json
+// parameters:
+// - name: id
+//   in: path
+//   description: The identifier of the agreement
+//   required: true
+//   type: string
+// responses:
+//   '200':
+//     description: The maintenance windows of the agreement
+//     schema:
+//       type: array
+//       items:
+//         "$ref": "#/definitions/MaintenanceWindow"
+//   '404' :
+//     description: Agreement not found
+func (a *App) GetMaintenanceWindows(w http.ResponseWriter, r *http.Request) {
+	a.get(w, r, func(id string) (interface{}, error) {
+		agreement, err := a.Repository.GetAgreement(id)
+		if err != nil {
+			return nil, err
+		}
+		result := []model.MaintenanceWindow{}
+		if agreement.Details.Calendar != nil {
+			result = append(result, agreement.Details.Calendar.Maintenance...)
+		}
+		return result, nil
+	})
+}
+
+// CreateMaintenanceWindow adds a maintenance window to an agreement
+// swagger:operation POST /agreements/{id}/maintenance createMaintenanceWindow
+//
+// Adds a maintenance window to the calendar of an agreement (the calendar is
+// created if not set). The id of the window is generated if empty.
+//
+// ---
+// produces:
+// - application/json
+// consumes:
+// - application/json
+// parameters:
+// - name: id
+//   in: path
+//   description: The identifier of the agreement
+//   required: true
+//   type: string
+// - name: window
+//   in: body
+//   description: The maintenance window to add
+//   required: true
+//   schema:
+//     "$ref": "#/definitions/MaintenanceWindow"
+// responses:
+//   '201':
+//     description: The new maintenance window
+//     schema:
+//       "$ref": "#/definitions/MaintenanceWindow"
+//   '400':
+//     description: The maintenance window is not valid (e.g., it overlaps another one)
+//   '404' :
+//     description: Agreement not found
+//   '409' :
+//     description: A maintenance window with the same id exists
+func (a *App) CreateMaintenanceWindow(w http.ResponseWriter, r *http.Request) {
+	var window model.MaintenanceWindow
+	id := mux.Vars(r)["id"]
+
+	if err := json.NewDecoder(r.Body).Decode(&window); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	agreement, err := a.Repository.GetAgreement(id)
+	if err != nil {
+		manageError(err, w)
+		return
+	}
+	if window.Id == "" {
+		window.Id = uuid.New().String()
+	}
+	/* the calendar is copied, as it may be shared with the stored agreement */
+	var cal model.Calendar
+	if agreement.Details.Calendar != nil {
+		cal = *agreement.Details.Calendar
+	}
+	for _, aux := range cal.Maintenance {
+		if aux.Id == window.Id {
+			manageError(model.ErrAlreadyExist, w)
+			return
+		}
+	}
+	if errs := cal.ValidateMaintenanceWindow(&window); len(errs) > 0 {
+		msgs := make([]string, 0, len(errs))
+		for _, err := range errs {
+			msgs = append(msgs, err.Error())
+		}
+		respondWithError(w, http.StatusBadRequest, strings.Join(msgs, ". "))
+		return
+	}
+	cal.Maintenance = append(append([]model.MaintenanceWindow{}, cal.Maintenance...), window)
+	if _, err := a.Repository.UpdateAgreementCalendar(id, &cal); err != nil {
+		manageError(err, w)
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, &window)
+}
+
+// DeleteMaintenanceWindow removes a maintenance window from an agreement
+// swagger:operation DELETE /agreements/{id}/maintenance/{wid} deleteMaintenanceWindow
+//
+// Removes a maintenance window from the calendar of an agreement
+//
+// ---
+// parameters:
+// - name: id
+//   in: path
+//   description: The identifier of the agreement
+//   required: true
+//   type: string
+// - name: wid
+//   in: path
+//   description: The identifier of the maintenance window
+//   required: true
+//   type: string
+// responses:
+//   '204':
+//     description: The maintenance window has been successfully deleted
+//   '404' :
+//     description: Agreement or maintenance window not found
+func (a *App) DeleteMaintenanceWindow(w http.ResponseWriter, r *http.Request) {
+	wid := mux.Vars(r)["wid"]
+
+	a.update(w, r, func(id string) error {
+		agreement, err := a.Repository.GetAgreement(id)
+		if err != nil {
+			return err
+		}
+		if agreement.Details.Calendar == nil {
+			return model.ErrNotFound
+		}
+		cal := *agreement.Details.Calendar
+		for i, aux := range cal.Maintenance {
+			if aux.Id == wid {
+				cal.Maintenance = append(append([]model.MaintenanceWindow{}, cal.Maintenance[:i]...),
+					cal.Maintenance[i+1:]...)
+				_, err = a.Repository.UpdateAgreementCalendar(id, &cal)
+				return err
+			}
+		}
+		return model.ErrNotFound
+	})
+}
+
 // StartAgreement starts monitoring an agreement
 func (a *App) StartAgreement(w http.ResponseWriter, r *http.Request) {
 	a.update(w, r, func(id string) error {
@@ -777,6 +957,88 @@ func (a *App) CreateAgreementFromTemplate(w http.ResponseWriter, r *http.Request
 		})
 }
 
+// GetFunctions returns the functions available in guarantee constraints
+// swagger:operation GET /functions getFunctions
+//
+// Returns the functions that can be used in the constraints of guarantee terms
+//
+// ---
+// produces:
+// - application/json
+// responses:
+//   '200':
+//     description: The list of functions, sorted by name
+//     schema:
+//       type: array
+//       items:
+//         "$ref": "#/definitions/Function"
+func (a *App) GetFunctions(w http.ResponseWriter, r *http.Request) {
+	respondSuccessJSON(w, functions.List())
+}
+
+// Validate validates an agreement or template without storing it
+// swagger:operation POST /validate validate
+//
+// Validates the agreement or template (if details.type is template) passed in the
+// request body, as on creation, but without storing it
+//
+// ---
+// produces:
+// - application/json
+// consumes:
+// - application/json
+// parameters:
+// - name: agreement
+//   in: body
+//   description: The agreement or template to validate
+//   required: true
+//   schema:
+//     "$ref": "#/definitions/Agreement"
+// responses:
+//   '200':
+//     description: The result of the validation
+//     schema:
+//       "$ref": "#/definitions/ValidationResult"
+//   '400':
+//     description: The body is not an agreement or template
+func (a *App) Validate(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	var agreement model.Agreement
+	if err := json.Unmarshal(body, &agreement); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var errs []error
+	if agreement.Details.Type == model.TEMPLATE {
+		var template model.Template
+		if err := json.Unmarshal(body, &template); err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		errs = template.Validate(a.validator, model.CREATE)
+	} else {
+		errs = agreement.Validate(a.validator, model.CREATE)
+	}
+
+	result := ValidationResult{
+		Valid:  len(errs) == 0,
+		Errors: make([]model.ExpressionError, 0, len(errs)),
+	}
+	for _, err := range errs {
+		if e, ok := err.(*model.ExpressionError); ok {
+			result.Errors = append(result.Errors, *e)
+		} else {
+			result.Errors = append(result.Errors, model.ExpressionError{Position: -1, Message: err.Error()})
+		}
+	}
+	respondSuccessJSON(w, result)
+}
+
 // ReceiveNotification is an endpoint to test the sending of notifications to
 // external endpoints
 func (a *App) ReceiveNotification(w http.ResponseWriter, r *http.Request) {
@@ -20,6 +20,7 @@ import (
 	assessment_model "SLALite/assessment/model"
 	"SLALite/assessment/monitor/simpleadapter"
 	"SLALite/model"
+	"SLALite/repositories/memrepository"
 	"SLALite/utils"
 	"fmt"
 	"os"
@@ -256,6 +257,65 @@ func TestEvaluateAgreementWithWrongValues(t *testing.T) {
 	}
 }
 
+func TestEvaluateAgreementWithNonBoolResult(t *testing.T) {
+	a := createAgreement("a03", p1, c2, "Agreement 03", "m + 1")
+	a.State = model.STARTED
+	values := assessment_model.GuaranteeData{
+		{"m": model.MetricValue{Key: "m", Value: 1, DateTime: t_(0)}},
+	}
+	ma := simpleadapter.New(values)
+	result, err := EvaluateAgreement(&a, Config{Adapter: ma, Now: t0})
+	if err == nil || result.Errors["TestGuarantee"] == nil {
+		t.Errorf("Expected error evaluating agreement")
+	}
+	AssessAgreement(&a, Config{Adapter: ma, Now: t0})
+	ag := a.Assessment.GetGuarantee("TestGuarantee")
+	if ag.LastError == "" {
+		t.Errorf("Expected error recorded in guarantee")
+	}
+
+	a.Details.Guarantees[0].Constraint = "m >= 0"
+	AssessAgreement(&a, Config{Adapter: ma, Now: t0})
+	if ag := a.Assessment.GetGuarantee("TestGuarantee"); ag.LastError != "" {
+		t.Errorf("Unexpected error recorded in guarantee: %s", ag.LastError)
+	}
+}
+
+func TestAssessAgreementWithFailingGuarantee(t *testing.T) {
+	guarantees := map[string]string{
+		"g1": "m >= 0",
+		"g2": "m + 1",
+		"g3": "m < 0",
+	}
+	a := createAgreementFull("a04", p1, c2, "Agreement 04", guarantees, nil)
+	a.State = model.STARTED
+	values := assessment_model.GuaranteeData{
+		{"m": model.MetricValue{Key: "m", Value: 1, DateTime: t_(0)}},
+	}
+	ma := simpleadapter.New(values)
+
+	result := AssessAgreement(&a, Config{Adapter: ma, Now: t0})
+	if len(result.Errors) != 1 || result.Errors["g2"] == nil {
+		t.Errorf("Expected error in g2. Actual: %v", result.Errors)
+	}
+	if len(result.Violated["g3"].Violations) != 1 {
+		t.Errorf("Expected violation of g3. Actual: %v", result.Violated)
+	}
+	checkTimes(t, &a, t0, t0)
+	for name, expected := range map[string]bool{"g1": false, "g2": true, "g3": false} {
+		ag := a.Assessment.GetGuarantee(name)
+		if (ag.LastError != "") != expected {
+			t.Errorf("Unexpected error in %s: '%s'", name, ag.LastError)
+		}
+		if !ag.LastExecution.Equal(t0) {
+			t.Errorf("Unexpected last execution in %s: %v", name, ag.LastExecution)
+		}
+	}
+	if len(a.Assessment.GetGuarantee("g1").LastValues) != 1 {
+		t.Errorf("Expected last values in g1")
+	}
+}
+
 func TestAssessAgreementWithTransient(t *testing.T) {
 	a := a1 // copy of
 	a.State = model.STARTED
@@ -291,6 +351,129 @@ func TestAssessAgreementWithTransient(t *testing.T) {
 	}
 }
 
+func TestAssessAgreementWithGuaranteeTransient(t *testing.T) {
+	a := createAgreementFull("a02t", p1, c2, "Agreement 02t",
+		map[string]string{"g1": "m >= 0", "g2": "m >= 0"}, nil)
+	a.State = model.STARTED
+	for i := range a.Details.Guarantees {
+		if a.Details.Guarantees[i].Name == "g1" {
+			a.Details.Guarantees[i].Transient = "2500ms"
+		}
+	}
+
+	values := assessment_model.GuaranteeData{
+		{"m": model.MetricValue{Key: "m", Value: -1.0, DateTime: t_(0)}}, // fails in g1 and g2
+		{"m": model.MetricValue{Key: "m", Value: -2.0, DateTime: t_(1)}}, // skipped in g1 and g2
+		{"m": model.MetricValue{Key: "m", Value: -3.0, DateTime: t_(2)}}, // skipped in g1
+		{"m": model.MetricValue{Key: "m", Value: -4.0, DateTime: t_(3)}}, // fails in g1; skipped in g2
+	}
+	result := AssessAgreement(&a, Config{Adapter: simpleadapter.New(values), Now: t0, Transient: 1500 * time.Millisecond})
+	for gtname, expected := range map[string]int{"g1": 2, "g2": 2} {
+		if actual := len(result.Violated[gtname].Violations); actual != expected {
+			t.Errorf("Error in violations of %s; expected: %d; actual: %d", gtname, expected, actual)
+		}
+	}
+	if v := result.Violated["g1"].Violations; len(v) == 2 && !v[1].Datetime.Equal(t_(3)) {
+		t.Errorf("Unexpected violation in g1: %v", v[1])
+	}
+	if v := result.Violated["g2"].Violations; len(v) == 2 && !v[1].Datetime.Equal(t_(2)) {
+		t.Errorf("Unexpected violation in g2: %v", v[1])
+	}
+}
+
+func TestAssessAgreementWithCalendar(t *testing.T) {
+	values := assessment_model.GuaranteeData{
+		{"m": model.MetricValue{Key: "m", Value: -1.0, DateTime: t_(0)}},
+		{"m": model.MetricValue{Key: "m", Value: -2.0, DateTime: t_(1)}}, // in maintenance
+		{"m": model.MetricValue{Key: "m", Value: -3.0, DateTime: t_(2)}}, // in maintenance
+		{"m": model.MetricValue{Key: "m", Value: -4.0, DateTime: t_(3)}},
+	}
+	for _, tc := range []struct {
+		mode       model.CalendarMode
+		violations int
+		excluded   int
+	}{
+		{mode: "", violations: 2},
+		{mode: model.EXCLUDE, violations: 4, excluded: 2},
+	} {
+		a := createAgreement("a02c", p1, c2, "Agreement 02c", "m >= 0")
+		a.State = model.STARTED
+		a.Details.Calendar = &model.Calendar{
+			Mode:        tc.mode,
+			Maintenance: []model.MaintenanceWindow{{Id: "m1", Start: t_(1), End: t_(3)}},
+		}
+		result := AssessAgreement(&a, Config{Adapter: simpleadapter.New(values), Now: t0})
+		violations := result.Violated["TestGuarantee"].Violations
+		excluded := 0
+		for _, v := range violations {
+			if v.Excluded {
+				excluded++
+			}
+		}
+		if len(violations) != tc.violations || excluded != tc.excluded {
+			t.Errorf("Mode '%s': expected %d violations (%d excluded); actual: %v",
+				tc.mode, tc.violations, tc.excluded, violations)
+		}
+	}
+}
+
+func TestAssessAgreementIncidents(t *testing.T) {
+	a := createAgreement("a03", p1, c2, "Agreement 03", "m >= 0")
+	a.State = model.STARTED
+	gtname := a.Details.Guarantees[0].Name
+
+	// opens incident
+	values := assessment_model.GuaranteeData{
+		{"m": model.MetricValue{Key: "m", Value: 1, DateTime: t_(0)}},
+		{"m": model.MetricValue{Key: "m", Value: -1, DateTime: t_(1)}},
+	}
+	result := AssessAgreement(&a, Config{Adapter: simpleadapter.New(values), Now: t_(2)})
+	incident := a.Assessment.GetGuarantee(gtname).Incident
+	if incident == nil || !incident.IsOpen() {
+		t.Fatalf("Expected open incident. Actual: %v", incident)
+	}
+	if !incident.Start.Equal(t_(1)) || incident.Violations != 1 || incident.Duration != 1 {
+		t.Errorf("Unexpected incident: %v", incident)
+	}
+	if len(result.Recovered) != 0 {
+		t.Errorf("Unexpected recovered GTs: %v", result.Recovered)
+	}
+
+	// incident keeps open with no values
+	result = AssessAgreement(&a, Config{Adapter: simpleadapter.New(assessment_model.GuaranteeData{}), Now: t_(3)})
+	incident = a.Assessment.GetGuarantee(gtname).Incident
+	if !incident.IsOpen() || incident.Duration != 2 || len(result.Recovered) != 0 {
+		t.Errorf("Unexpected incident: %v", incident)
+	}
+
+	// closes incident
+	values = assessment_model.GuaranteeData{
+		{"m": model.MetricValue{Key: "m", Value: -2, DateTime: t_(4)}},
+		{"m": model.MetricValue{Key: "m", Value: 2, DateTime: t_(5)}},
+		{"m": model.MetricValue{Key: "m", Value: 3, DateTime: t_(6)}},
+	}
+	result = AssessAgreement(&a, Config{Adapter: simpleadapter.New(values), Now: t_(7)})
+	incident = a.Assessment.GetGuarantee(gtname).Incident
+	if incident.IsOpen() || !incident.End.Equal(t_(5)) || incident.Duration != 4 || incident.Violations != 2 {
+		t.Errorf("Unexpected incident: %v", incident)
+	}
+	if recovered, ok := result.Recovered[gtname]; !ok || recovered.Violations != 2 {
+		t.Errorf("Unexpected recovered GTs: %v", result.Recovered)
+	}
+	if len(result.GetViolations()) != 1 {
+		t.Errorf("Unexpected violations: %v", result.GetViolations())
+	}
+
+	// closed incident is kept; no new recoveries
+	values = assessment_model.GuaranteeData{
+		{"m": model.MetricValue{Key: "m", Value: 4, DateTime: t_(8)}},
+	}
+	result = AssessAgreement(&a, Config{Adapter: simpleadapter.New(values), Now: t_(9)})
+	if a.Assessment.GetGuarantee(gtname).Incident.IsOpen() || len(result.Recovered) != 0 {
+		t.Errorf("Unexpected recovered GTs: %v", result.Recovered)
+	}
+}
+
 func TestEvaluateGuarantee(t *testing.T) {
 	values := assessment_model.GuaranteeData{
 		{"m": model.MetricValue{Key: "m", Value: 1, DateTime: t_(0)}},
@@ -359,6 +542,13 @@ func TestEvaluateExpression(t *testing.T) {
 		t.Errorf("expression: '%s', values:%v", c, v)
 	}
 	fmt.Printf("%v", invalid)
+
+	for _, c := range []string{"m + 1", "m > 0 ? 'up' : 'down'"} {
+		expression, _ = govaluate.NewEvaluableExpression(c)
+		if _, err = evaluateExpression(expression, v); err == nil {
+			t.Errorf("Expected error evaluating non bool expression '%s'", c)
+		}
+	}
 }
 
 // func TestEvaluationSuccess(t *testing.T) {
@@ -428,6 +618,99 @@ func TestEvaluateExpression(t *testing.T) {
 // 	return m.Result
 // }
 
+type countingNotifier map[string]int
+
+func (n countingNotifier) NotifyViolations(agreement *model.Agreement, result *assessment_model.Result) {
+	for name, gt := range result.Violated {
+		n[name] += len(gt.Violations)
+	}
+}
+
+func TestLoop(t *testing.T) {
+	start := time.Date(2019, 10, 29, 10, 0, 0, 0, time.UTC)
+	clock := utils.NewFakeClock(start)
+	deadline := start.Add(time.Minute).Unix()
+
+	repo, _ := memrepository.New(nil)
+	a := createAgreement("al01", p1, c2, "Agreement al01", fmt.Sprintf("m >= 0 && timeNow() < %d", deadline))
+	a.State = model.STARTED
+	repo.CreateAgreement(&a)
+
+	values := assessment_model.GuaranteeData{
+		{"m": model.MetricValue{Key: "m", Value: 1, DateTime: start}},
+	}
+	not := countingNotifier{}
+	cfg := Config{
+		Repo:     repo,
+		Adapter:  simpleadapter.New(values),
+		Notifier: not,
+		Clock:    clock,
+	}
+
+	ticks := make(chan time.Time)
+	done := make(chan bool)
+	go func() {
+		Loop(cfg, ticks)
+		done <- true
+	}()
+
+	ticks <- time.Now()
+	clock.Advance(2 * time.Minute)
+	ticks <- time.Now()
+	close(ticks)
+	<-done
+
+	if not["TestGuarantee"] != 1 {
+		t.Errorf("Expected 1 violation after the deadline. Actual: %d", not["TestGuarantee"])
+	}
+	updated, _ := repo.GetAgreement("al01")
+	checkTimes(t, updated, start, clock.Now())
+}
+
+func TestTimeOfAssessment(t *testing.T) {
+	start := time.Date(2019, 10, 29, 10, 0, 0, 0, time.UTC)
+	a := createAgreement("at01", p1, c2, "Agreement at01", fmt.Sprintf("timeNow() == %d", start.Unix()))
+	values := assessment_model.GuaranteeData{
+		{"m": model.MetricValue{Key: "m", Value: 1, DateTime: start}},
+	}
+	gt := a.Details.Guarantees[0]
+
+	cfg := Config{Adapter: simpleadapter.New(values), Clock: utils.NewFakeClock(start)}
+	if failed, _, err := EvaluateGuarantee(&a, gt, cfg.Adapter, cfg); err != nil || len(failed) != 0 {
+		t.Errorf("Unexpected evaluation with time of clock: %v, %v", failed, err)
+	}
+
+	/* the time of the clock is also the time of the assessment */
+	a.State = model.STARTED
+	AssessAgreement(&a, cfg)
+	if ag := a.Assessment.GetGuarantee(gt.Name); !a.Assessment.LastExecution.Equal(start) ||
+		!ag.LastExecution.Equal(start) || ag.LastError != "" {
+		t.Errorf("Unexpected assessment with time of clock: %v", a.Assessment)
+	}
+
+	cfg = Config{Adapter: simpleadapter.New(values)}
+	if _, _, err := EvaluateGuarantee(&a, gt, cfg.Adapter, cfg); err == nil {
+		t.Errorf("Expected error without time of assessment")
+	}
+}
+
+func TestBuildRetrievalItems(t *testing.T) {
+	a := createAgreement("a01", p1, c2, "Agreement 01", "tumbling + sliding + raw > 0")
+	a.Details.Creation = t_(0)
+	a.Details.Variables = []model.Variable{
+		{Name: "tumbling", Metric: "m", Aggregation: &model.Aggregation{Type: model.AVERAGE, Window: 60}},
+		{Name: "sliding", Metric: "m", Aggregation: &model.Aggregation{Type: model.AVERAGE, Window: 60, WindowType: model.SLIDING}},
+	}
+	gt := a.Details.Guarantees[0]
+	items := BuildRetrievalItems(&a, gt, []string{"tumbling", "sliding", "raw"}, t_(300))
+
+	for i, expected := range []time.Time{t_(240), t_(-60), t_(0)} {
+		if !items[i].From.Equal(expected) {
+			t.Errorf("Unexpected From of %s. Expected: %v; Actual: %v", items[i].Var.Name, expected, items[i].From)
+		}
+	}
+}
+
 func createAgreementFull(aid string, provider model.Provider, client model.Client, name string, constraints map[string]string, expiration *time.Time) model.Agreement {
 	agreement := model.Agreement{
 		Id:    aid,
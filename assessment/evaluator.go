@@ -22,6 +22,8 @@ import (
 	"SLALite/assessment/monitor"
 	"SLALite/assessment/notifier"
 	"SLALite/model"
+	"SLALite/model/functions"
+	"SLALite/utils"
 	"fmt"
 	"strings"
 	"time"
@@ -39,7 +41,7 @@ type Config struct {
 	// Now is the time considered the current time. In general terms, metrics are
 	// retrieved from the adapter from the last measure to `now`.
 	// If the monitoring have some delay storing metrics, now could be shifted some
-	// minutes to the past.
+	// minutes to the past. If not set, the time of Clock is used.
 	Now time.Time
 
 	// Repo is the repository where to load/store entities
@@ -51,13 +53,44 @@ type Config struct {
 	// Notifier receives the violations and notifies them (send by REST, store to DB...)
 	Notifier notifier.ViolationNotifier
 
-	// Transient is time to wait until a new violation of a GT can be raised again (default value is zero)
+	// Transient is time to wait until a new violation of a GT can be raised again (default value is zero),
+	// unless set in the GT
 	Transient time.Duration
+
+	// Clock sets Now on each iteration of Loop (default value is utils.SystemClock)
+	Clock utils.Clock
+}
+
+// resolve returns the config with Now set to the time of Clock if Now is not set,
+// so that the same time is used in the whole assessment. Now is zero if none is
+// set, and the time functions of constraints fail.
+func (cfg Config) resolve() Config {
+	if cfg.Now.IsZero() && cfg.Clock != nil {
+		cfg.Now = cfg.Clock.Now()
+	}
+	return cfg
+}
+
+// Loop assesses the active agreements on each tick received from ticks, setting
+// cfg.Now to the time of cfg.Clock. It returns when ticks is closed.
+//
+// The time of the ticks is ignored, so the loop can be driven by a fake clock
+// and a channel fed by the test.
+func Loop(cfg Config, ticks <-chan time.Time) {
+	clock := cfg.Clock
+	if clock == nil {
+		clock = utils.SystemClock
+	}
+	for range ticks {
+		cfg.Now = clock.Now()
+		AssessActiveAgreements(cfg)
+	}
 }
 
 //AssessActiveAgreements will get the active agreements from the provided repository and assess them, notifying about violations with the provided notifier.
-// Mandatory fields filled in cfg are Repo, Adapter and Now.
+// Mandatory fields filled in cfg are Repo, Adapter and Now (or Clock).
 func AssessActiveAgreements(cfg Config) {
+	cfg = cfg.resolve()
 	repo := cfg.Repo
 	not := cfg.Notifier
 
@@ -67,13 +100,28 @@ func AssessActiveAgreements(cfg Config) {
 	} else {
 		log.Printf("AssessActiveAgreements(). %d agreements to evaluate", len(agreements))
 		for _, agreement := range agreements {
+			state := agreement.State
 			result := AssessAgreement(&agreement, cfg)
-			repo.UpdateAgreement(&agreement)
-			if not != nil && len(result.Violated) > 0 {
+			/*
+			 * only the parts modified by the assessment are persisted, to not
+			 * overwrite concurrent changes (e.g., maintenance windows)
+			 */
+			if agreement.State != state {
+				if _, err := repo.UpdateAgreementState(agreement.Id, agreement.State); err != nil {
+					log.Errorf("Error updating state of agreement %s: %s", agreement.Id, err.Error())
+				}
+			}
+			if _, err := repo.UpdateAgreementAssessment(agreement.Id, &agreement.Assessment); err != nil {
+				log.Errorf("Error updating assessment of agreement %s: %s", agreement.Id, err.Error())
+			}
+			if not != nil && (len(result.Violated) > 0 || len(result.Recovered) > 0) {
 				not.NotifyViolations(&agreement, &result)
 			}
 		}
 	}
+	if flusher, ok := not.(notifier.Flusher); ok {
+		flusher.Flush()
+	}
 }
 
 // AssessAgreement is the process that assess an agreement. The process is:
@@ -85,11 +133,13 @@ func AssessActiveAgreements(cfg Config) {
 // - parameter a is modified
 // - evaluation results are the function return (violated metrics and raised violations).
 //   a guarantee term is filled in the result only if there are violations.
+//   Guarantee terms that are fulfilled again after an incident are filled in Recovered.
 //
 // The function results are not persisted. The output must be persisted/handled accordingly.
 // E.g.: agreement and violations must be persisted to DB. Violations must be notified to
 // observers
 func AssessAgreement(a *model.Agreement, cfg Config) amodel.Result {
+	cfg = cfg.resolve()
 	var result amodel.Result
 	var err error
 
@@ -104,8 +154,8 @@ func AssessAgreement(a *model.Agreement, cfg Config) amodel.Result {
 	if a.State == model.STARTED {
 		result, err = EvaluateAgreement(a, cfg)
 		if err != nil {
+			/* the result contains the rest of guarantee terms */
 			log.Warn("Error evaluating agreement " + a.Id + ": " + err.Error())
-			return result
 		}
 		updateAssessment(a, result, now)
 	}
@@ -120,18 +170,35 @@ func updateAssessment(a *model.Agreement, result amodel.Result, now time.Time) {
 
 	for _, gt := range a.Details.Guarantees {
 		gtname := gt.Name
+		if err, ok := result.Errors[gtname]; ok {
+			setError(a, gtname, err, now)
+			continue
+		}
 		last := result.LastValues[gtname]
 
 		violations := []model.Violation{}
 		if violated, ok := result.Violated[gtname]; ok {
 			violations = violated.Violations
 		}
-		updateAssessmentGuarantee(a, gtname, last, violations, now)
+		var incident *model.Incident
+		if aux, ok := result.Incidents[gtname]; ok {
+			incident = &aux
+		}
+		var budget *model.ErrorBudget
+		if aux, ok := result.Budgets[gtname]; ok {
+			budget = &aux
+		}
+		var pending *model.Pending
+		if aux, ok := result.Pending[gtname]; ok {
+			pending = &aux
+		}
+		updateAssessmentGuarantee(a, gtname, last, violations, incident, budget, pending, now)
 	}
 }
 
 func updateAssessmentGuarantee(a *model.Agreement, gtname string, last amodel.ExpressionData,
-	violations []model.Violation, now time.Time) {
+	violations []model.Violation, incident *model.Incident, budget *model.ErrorBudget,
+	pending *model.Pending, now time.Time) {
 
 	ag := a.Assessment.GetGuarantee(gtname)
 	ag.LastExecution = now
@@ -144,6 +211,23 @@ func updateAssessmentGuarantee(a *model.Agreement, gtname string, last amodel.Ex
 	if len(violations) > 0 {
 		ag.LastViolation = &violations[len(violations)-1]
 	}
+	if incident != nil {
+		ag.Incident = incident
+	}
+	ag.Budget = budget
+	ag.Pending = pending
+	ag.LastError = ""
+	a.Assessment.SetGuarantee(gtname, ag)
+}
+
+// setError records on the assessment of a guarantee term the error of its evaluation
+func setError(a *model.Agreement, gtname string, err error, now time.Time) {
+	ag := a.Assessment.GetGuarantee(gtname)
+	ag.LastExecution = now
+	if ag.FirstExecution.IsZero() {
+		ag.FirstExecution = now
+	}
+	ag.LastError = err.Error()
 	a.Assessment.SetGuarantee(gtname, ag)
 }
 
@@ -152,38 +236,83 @@ func updateAssessmentGuarantee(a *model.Agreement, gtname string, last amodel.Ex
 // The MonitoringAdapter must feed the process correctly
 // (e.g. if the constraint of a guarantee term is of the type "A>B && C>D", the
 // MonitoringAdapter must supply pairs of values).
+//
+// The guarantee terms are evaluated independently: the errors evaluating a term
+// are set in the Errors of the result, and the rest of terms are evaluated. The
+// returned error is not nil if any term failed, and summarizes the errors.
 func EvaluateAgreement(a *model.Agreement, cfg Config) (amodel.Result, error) {
+	cfg = cfg.resolve()
 	ma := cfg.Adapter.Initialize(a)
 	now := cfg.Now
 
 	log.Debugf("EvaluateAgreement(%s)", a.Id)
 	result := amodel.Result{
 		Violated:      map[string]amodel.EvaluationGtResult{},
+		Recovered:     map[string]model.Incident{},
+		Incidents:     map[string]model.Incident{},
 		LastValues:    map[string]amodel.ExpressionData{},
 		LastExecution: map[string]time.Time{},
+		Errors:        map[string]error{},
+		Budgets:       map[string]model.ErrorBudget{},
+		Pending:       map[string]model.Pending{},
 	}
 	gts := a.Details.Guarantees
+	errs := []string{}
 
 	for _, gt := range gts {
 		/*
 		 * TODO Evaluate if gt has to be evaluated according to schedule
 		 */
-		failed, lastvalues, err := EvaluateGuarantee(a, gt, ma, cfg)
+		failed, lastvalues, recovery, points, err := evaluateGuarantee(a, gt, ma, cfg)
 		if err != nil {
 			log.Warn("Error evaluating expression " + gt.Constraint + ": " + err.Error())
-			return amodel.Result{}, err
+			result.Errors[gt.Name] = err
+			errs = append(errs, fmt.Sprintf("%s: %s", gt.Name, err.Error()))
+			continue
 		}
-		if len(failed) > 0 {
-			violations := EvaluateGtViolations(a, gt, failed, cfg.Transient)
-			gtResult := amodel.EvaluationGtResult{
-				Metrics:    failed,
-				Violations: violations,
+		violations := []model.Violation{}
+		if gt.Objective != nil {
+			var budget model.ErrorBudget
+			budget, violations = evaluateObjective(a, gt, points, failed, lastvalues, now)
+			result.Budgets[gt.Name] = budget
+			failed, recovery = objectiveIncident(budget, failed, lastvalues)
+			if len(violations) > 0 {
+				result.Violated[gt.Name] = amodel.EvaluationGtResult{
+					Metrics:    failed,
+					Violations: violations,
+				}
+			}
+		} else {
+			if gt.For != nil {
+				var pending *model.Pending
+				previous := a.Assessment.GetGuarantee(gt.Name).Pending
+				failed, recovery, pending = applyTolerance(a, gt, previous, points)
+				if pending != nil {
+					result.Pending[gt.Name] = *pending
+				}
+			}
+			if len(failed) > 0 {
+				violations = EvaluateGtViolations(a, gt, failed, gt.TransientTime(cfg.Transient))
+				gtResult := amodel.EvaluationGtResult{
+					Metrics:    failed,
+					Violations: violations,
+				}
+				result.Violated[gt.Name] = gtResult
+			}
+		}
+		if incident, recovered := EvaluateGtIncident(a, gt, failed, violations, recovery, now); incident != nil {
+			result.Incidents[gt.Name] = *incident
+			if recovered {
+				result.Recovered[gt.Name] = *incident
 			}
-			result.Violated[gt.Name] = gtResult
 		}
 		result.LastValues[gt.Name] = lastvalues
 		result.LastExecution[gt.Name] = now
 	}
+	if len(errs) > 0 {
+		return result, fmt.Errorf("error evaluating %d of %d guarantee terms (%s)",
+			len(errs), len(gts), strings.Join(errs, "; "))
+	}
 	return result, nil
 }
 
@@ -197,64 +326,95 @@ func EvaluateGuarantee(a *model.Agreement,
 	cfg Config) (
 	failed []amodel.ExpressionData, last amodel.ExpressionData, err error) {
 
+	failed, last, _, _, err = evaluateGuarantee(a, gt, ma, cfg.resolve())
+	return failed, last, err
+}
+
+// evaluateGuarantee is EvaluateGuarantee, but also returning the first values
+// that fulfill the GT constraint after the last failed ones (nil if the last values failed),
+// and the result of the evaluation of each values.
+func evaluateGuarantee(a *model.Agreement,
+	gt model.Guarantee,
+	ma monitor.MonitoringAdapter,
+	cfg Config) (
+	failed []amodel.ExpressionData, last amodel.ExpressionData, recovery amodel.ExpressionData,
+	points []point, err error) {
+
 	log.Debugf("EvaluateGuarantee(%s, %s)", a.Id, gt.Name)
 	failed = make(amodel.GuaranteeData, 0, 1)
 
-	timeNow := map[string]govaluate.ExpressionFunction{
-		"timeNow": func(args ...interface{}) (interface{}, error) {
-			timeNow := (float64)(time.Now().Unix())
-			return timeNow, nil
-		},
-	}
-
-	expression, err := govaluate.NewEvaluableExpressionWithFunctions(gt.Constraint, timeNow)
+	ctx := &functions.Context{Now: cfg.Now}
+	expression, err := govaluate.NewEvaluableExpressionWithFunctions(gt.Constraint, functions.Bind(ctx))
 	if err != nil {
 		log.Warnf("Error parsing expression '%s'", gt.Constraint)
-		return nil, nil, err
+		return nil, nil, nil, nil, err
 	}
-	values := ma.GetValues(gt, expression.Vars(), cfg.Now)
+	cal := a.Details.GetCalendar(gt)
+	values, err := getValues(ma, gt, expression.Vars(), cfg.Now)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	points = make([]point, 0, len(values))
 	for _, value := range values {
+		ctx.Time = tupleTime(value)
+		if suppressed(cal, ctx.Time) {
+			log.Debugf("Skipping values of %s[%s] suppressed by calendar: %v", a.Id, gt.Name, value)
+			continue
+		}
+		ctx.Labels = tupleLabels(value)
 		aux, err := evaluateExpression(expression, value)
 		if err != nil {
 			log.Warn("Error evaluating expression " + gt.Constraint + ": " + err.Error())
-			return nil, nil, err
+			return nil, nil, nil, nil, err
 		}
+		points = append(points, point{t: ctx.Time, ok: aux == nil, values: value})
 		if aux != nil {
 			failed = append(failed, aux)
+			recovery = nil
+		} else if recovery == nil {
+			recovery = value
 		}
 	}
 	if len(values) > 0 {
 		last = values[len(values)-1]
 	}
-	return failed, last, nil
+	return failed, last, recovery, points, nil
+}
+
+// getValues returns the values of the variables of a guarantee term, and the error
+// getting them if the adapter reports it (see monitor.CheckedAdapter)
+func getValues(ma monitor.MonitoringAdapter, gt model.Guarantee, vars []string, now time.Time) (amodel.GuaranteeData, error) {
+	if checked, ok := ma.(monitor.CheckedAdapter); ok {
+		return checked.GetCheckedValues(gt, vars, now)
+	}
+	return ma.GetValues(gt, vars, now), nil
 }
 
 // EvaluateGtViolations creates violations for the detected violated metrics in EvaluateGuarantee
 func EvaluateGtViolations(a *model.Agreement, gt model.Guarantee, violated amodel.GuaranteeData, transientTime time.Duration) []model.Violation {
 	gtv := make([]model.Violation, 0, len(violated))
 	lastViolation := a.Assessment.GetGuarantee(gt.Name).LastViolation
+	cal := a.Details.GetCalendar(gt)
 
 	for _, tuple := range violated {
 		// build values map and find newer metric
-		var d *time.Time
 		var values = make([]model.MetricValue, 0, len(tuple))
 		for _, m := range tuple {
 			values = append(values, m)
-			if d == nil || m.DateTime.After(*d) {
-				d = &m.DateTime
-			}
 		}
-		if inTransientTime(*d, lastViolation, transientTime) {
-			log.Debugf("Skipping failed metrics %v; last=%s transient=%d newTime=%s",
-				tuple, lastViolation, transientTime, *d)
+		d := tupleTime(tuple)
+		if inTransientTime(d, lastViolation, transientTime) {
+			log.Debugf("Skipping failed metrics %v; last=%v transient=%d newTime=%s",
+				tuple, lastViolation, transientTime, d)
 			continue
 		}
 		v := model.Violation{
 			AgreementId: a.Id,
 			Guarantee:   gt.Name,
-			Datetime:    *d,
+			Datetime:    d,
 			Constraint:  gt.Constraint,
 			Values:      values,
+			Excluded:    excluded(cal, d),
 		}
 		lastViolation = &v
 		gtv = append(gtv, v)
@@ -262,6 +422,65 @@ func EvaluateGtViolations(a *model.Agreement, gt model.Guarantee, violated amode
 	return gtv
 }
 
+/*
+EvaluateGtIncident returns the incident of a guarantee term after an evaluation.
+
+If there is no open incident and the GT has failed, a new incident is opened.
+The incident is closed when the GT is fulfilled again (i.e., recovery contains the
+first values that fulfill the GT after the last failed ones). The open incident
+is never closed if there are no values.
+
+The returned incident is nil if there was no open incident and the GT has not failed.
+The second return value is true if the incident has been closed in this evaluation.
+*/
+func EvaluateGtIncident(a *model.Agreement, gt model.Guarantee, failed amodel.GuaranteeData,
+	violations []model.Violation, recovery amodel.ExpressionData, now time.Time) (*model.Incident, bool) {
+
+	var incident model.Incident
+
+	last := a.Assessment.GetGuarantee(gt.Name).Incident
+	if last != nil && last.IsOpen() {
+		incident = *last
+	} else if len(failed) > 0 {
+		incident = model.Incident{
+			AgreementId: a.Id,
+			Guarantee:   gt.Name,
+			Start:       tupleTime(failed[0]),
+		}
+	} else {
+		return nil, false
+	}
+	incident.Violations += len(violations)
+
+	if recovery != nil {
+		incident.Close(tupleTime(recovery))
+		log.Debugf("Closed incident of %s[%s]: %v", a.Id, gt.Name, incident)
+		return &incident, true
+	}
+	incident.Duration = now.Sub(incident.Start).Seconds()
+	return &incident, false
+}
+
+// tupleTime returns the time of the newest metric in the tuple
+func tupleTime(tuple amodel.ExpressionData) time.Time {
+	var d time.Time
+	for _, m := range tuple {
+		if m.DateTime.After(d) {
+			d = m.DateTime
+		}
+	}
+	return d
+}
+
+// tupleLabels returns the labels of each metric in the tuple
+func tupleLabels(tuple amodel.ExpressionData) map[string]map[string]string {
+	result := make(map[string]map[string]string, len(tuple))
+	for name, m := range tuple {
+		result[name] = m.Labels.Map()
+	}
+	return result
+}
+
 // evaluateExpression evaluate a GT expression at a single point in time with a tuple of metric values
 // (one value per variable in GT expresssion)
 //
@@ -275,24 +494,28 @@ func evaluateExpression(expression *govaluate.EvaluableExpression, values amodel
 	}
 	result, err := expression.Evaluate(evalues)
 	log.Debugf("[evaluateExpression] Evaluating expression '%v'=%v with values %v", expression, result, values)
+	if err != nil {
+		return nil, err
+	}
 
-	if _, ok := result.(bool); ok {
-		if err == nil && !result.(bool) {
-			return values, nil
-		}
-	} else {
-		log.Error("[evaluateExpression] 'result' (from evaluation operation) is not a bool object.")
-
-		str := fmt.Sprintf("%v", result)
-		if strings.Contains(strings.ToLower(str), "false") {
-			log.Debugf("[evaluateExpression] 'result' contains a 'false' value.")
-			return values, nil
-		} else if strings.Contains(strings.ToLower(str), "true") {
-			log.Debugf("[evaluateExpression] 'result' contains a 'true' value.")
-		}
+	ok, isBool := result.(bool)
+	if !isBool {
+		return nil, fmt.Errorf("the result is not a bool: %v (%T)", result, result)
 	}
+	if !ok {
+		return values, nil
+	}
+	return nil, nil
+}
 
-	return nil, err
+// suppressed returns if the evaluation of the values at t is suppressed by a calendar
+func suppressed(cal *model.Calendar, t time.Time) bool {
+	return cal != nil && cal.GetMode() == model.SUPPRESS && cal.Excludes(t)
+}
+
+// excluded returns if a violation at t is excluded by a calendar
+func excluded(cal *model.Calendar, t time.Time) bool {
+	return cal != nil && cal.GetMode() == model.EXCLUDE && cal.Excludes(t)
 }
 
 // inTransientTime returns if the new violation detected occurs in the transient time
@@ -343,13 +566,18 @@ func getDefaultFrom(a *model.Agreement, gt model.Guarantee) time.Time {
 /*
 GetFromForVariable returns the interval start for the query to monitoring.
 
-If the variable is aggregated, it depends on the aggregation window.
+If the variable is aggregated, it depends on the aggregation window: a
+sliding window needs the values of one window before defaultFrom.
 If not, returns defaultFrom (which should be the last time the guarantee term
 was evaluated)
 */
 func getFromForVariable(v model.Variable, defaultFrom, to time.Time) time.Time {
 	if v.Aggregation != nil && v.Aggregation.Window != 0 {
-		return to.Add(-time.Duration(v.Aggregation.Window) * time.Second)
+		window := time.Duration(v.Aggregation.Window) * time.Second
+		if v.Aggregation.WindowType == model.SLIDING {
+			return defaultFrom.Add(-window)
+		}
+		return to.Add(-window)
 	}
 	return defaultFrom
 }
@@ -40,8 +40,23 @@ type EvaluationGtResult struct {
 // Result is the result of the agreement assessment
 type Result struct {
 	Violated      map[string]EvaluationGtResult // terms that were violated
+	Recovered     map[string]model.Incident     // terms that were fulfilled again, closing an incident
+	Incidents     map[string]model.Incident     // incident of the terms with an open or just closed incident
 	LastValues    map[string]ExpressionData     // last value of variables in the term
 	LastExecution map[string]time.Time          // last execution of a guarantee
+	Errors        map[string]error              // errors of the terms whose evaluation failed
+	Budgets       map[string]model.ErrorBudget  // error budget of the terms with an objective
+	Pending       map[string]model.Pending      // ongoing failure of the terms with a tolerance
+	Summary       *Summary                      // set if results were aggregated or dropped before this one
+}
+
+// Summary contains the number of results of an agreement that were aggregated in
+// a Result or dropped (by rate limiting) in a period of time.
+type Summary struct {
+	From       time.Time `json:"from"`
+	To         time.Time `json:"to"`
+	Aggregated int       `json:"aggregated"`
+	Dropped    int       `json:"dropped"`
 }
 
 // GetViolations return the violations contained in a Result
@@ -55,3 +70,13 @@ func (r *Result) GetViolations() []model.Violation {
 	}
 	return result
 }
+
+// GetRecoveries returns the incidents closed in a Result
+func (r *Result) GetRecoveries() []model.Incident {
+	result := make([]model.Incident, 0, len(r.Recovered))
+
+	for _, incident := range r.Recovered {
+		result = append(result, incident)
+	}
+	return result
+}
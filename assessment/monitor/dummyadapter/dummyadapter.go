@@ -65,7 +65,7 @@ func (ma *monitoringAdapter) GetValues(gt model.Guarantee, vars []string, now ti
 
 		for _, key := range vars {
 			val[key] = model.MetricValue{
-				DateTime: time.Now(),
+				DateTime: now,
 				Key:      key,
 				Value:    rand.Float64(),
 			}
@@ -0,0 +1,303 @@
+/*
+Copyright 2020 Atos
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package genericadapter
+
+import (
+	"SLALite/model"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// point is a numeric metric value
+type point struct {
+	t     time.Time
+	value float64
+}
+
+// aggregator calculates the aggregated value of the points in a window, sorted by time.
+// It returns false if the value cannot be calculated from the points (e.g. the rate of
+// a single point).
+type aggregator func(points []point) (float64, bool)
+
+var aggregators = map[model.AggregationType]aggregator{
+	model.AVERAGE: average,
+	model.SUM:     sum,
+	model.MIN: func(points []point) (float64, bool) {
+		return fold(points, math.Min), true
+	},
+	model.MAX: func(points []point) (float64, bool) {
+		return fold(points, math.Max), true
+	},
+	model.COUNT: func(points []point) (float64, bool) {
+		return float64(len(points)), true
+	},
+	model.RATE: rate,
+	model.LAST: func(points []point) (float64, bool) {
+		return points[len(points)-1].value, true
+	},
+	model.P50:    percentile(50),
+	model.P95:    percentile(95),
+	model.P99:    percentile(99),
+	model.STDDEV: stddev,
+}
+
+// Processor returns a Process function that aggregates the values of the variables
+// whose aggregation is performed locally: the variables whose aggregation
+// processor is LOCAL, or is not set and defaultProcessor is LOCAL. The values
+// of the rest of variables are returned as is (see model.MONITORING).
+func Processor(defaultProcessor model.AggregationProcessor) Process {
+	return func(v model.Variable, values []model.MetricValue) ([]model.MetricValue, error) {
+		if ProcessorOf(v, defaultProcessor) == model.LOCAL {
+			return Aggregate(v, values)
+		}
+		return Identity(v, values)
+	}
+}
+
+// ProcessorOf returns where the aggregation of a variable is performed:
+// the processor of the variable aggregation or defaultProcessor if not set.
+// It returns "" if the variable is not aggregated.
+func ProcessorOf(v model.Variable, defaultProcessor model.AggregationProcessor) model.AggregationProcessor {
+	if v.Aggregation == nil || v.Aggregation.Type == "" || v.Aggregation.Type == model.NONE {
+		return ""
+	}
+	if v.Aggregation.Processor != "" {
+		return v.Aggregation.Processor
+	}
+	return defaultProcessor
+}
+
+/*
+Aggregate performs the aggregation of the variable on the input, returning
+an error if the aggregation type is unknown or some value is not numeric.
+
+This expects that all the values are in the appropriate window. For that,
+the Retrieve function needs to return only the values in the window. If not,
+this function will return an invalid result.
+
+With a tumbling window (default), the values are split in consecutive windows
+of Window seconds that end at the last value, and an aggregated value is calculated
+for each window. If Window is 0, all the values are aggregated in one value.
+
+With a sliding window, an aggregated value is calculated at the time of each value
+with the values in the previous Window seconds. Only the values with a complete
+window (i.e., at least Window seconds after the first value) produce an
+aggregated value; the Retrieve function must return the values since one
+window before the last evaluation (see assessment.BuildRetrievalItems).
+
+The aggregated values have the variable name as Key and the time of the last
+value in its window.
+*/
+func Aggregate(v model.Variable, values []model.MetricValue) ([]model.MetricValue, error) {
+	if len(values) == 0 || v.Aggregation == nil || v.Aggregation.Type == "" || v.Aggregation.Type == model.NONE {
+		return values, nil
+	}
+	f, ok := aggregators[v.Aggregation.Type]
+	if !ok {
+		return nil, fmt.Errorf("unknown aggregation type '%s'", v.Aggregation.Type)
+	}
+	points, err := toPoints(values)
+	if err != nil {
+		return nil, err
+	}
+	window := time.Duration(v.Aggregation.Window) * time.Second
+
+	var windows [][]point
+	switch v.Aggregation.WindowType {
+	case "", model.TUMBLING:
+		windows = tumbling(points, window)
+	case model.SLIDING:
+		if window <= 0 {
+			return nil, fmt.Errorf("a sliding window needs a window size")
+		}
+		windows = sliding(points, window)
+	default:
+		return nil, fmt.Errorf("unknown window type '%s'", v.Aggregation.WindowType)
+	}
+
+	result := make([]model.MetricValue, 0, len(windows))
+	for _, w := range windows {
+		value, ok := f(w)
+		if !ok {
+			continue
+		}
+		result = append(result, model.MetricValue{
+			Key:      v.Name,
+			Value:    value,
+			DateTime: w[len(w)-1].t,
+		})
+	}
+	return result, nil
+}
+
+// toPoints converts the values to points sorted by time
+func toPoints(values []model.MetricValue) ([]point, error) {
+	result := make([]point, 0, len(values))
+	for _, v := range values {
+		f, err := toFloat(v.Value)
+		if err != nil {
+			return nil, fmt.Errorf("value %v at %v: %s", v.Value, v.DateTime, err.Error())
+		}
+		result = append(result, point{t: v.DateTime, value: f})
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].t.Before(result[j].t)
+	})
+	return result, nil
+}
+
+func toFloat(value interface{}) (float64, error) {
+	switch v := value.(type) {
+	case float64:
+		return v, nil
+	case float32:
+		return float64(v), nil
+	case int:
+		return float64(v), nil
+	case int32:
+		return float64(v), nil
+	case int64:
+		return float64(v), nil
+	case uint:
+		return float64(v), nil
+	case uint32:
+		return float64(v), nil
+	case uint64:
+		return float64(v), nil
+	case json.Number:
+		return v.Float64()
+	default:
+		return 0, fmt.Errorf("not a number (%T)", value)
+	}
+}
+
+// tumbling splits the points in consecutive windows ending at the last point.
+// The empty windows are omitted.
+func tumbling(points []point, window time.Duration) [][]point {
+	if window <= 0 {
+		return [][]point{points}
+	}
+	result := make([][]point, 0)
+	end := len(points)
+	limit := points[end-1].t.Add(-window)
+	for i := end - 1; i >= 0; i-- {
+		if !points[i].t.After(limit) {
+			result = append(result, points[i+1:end])
+			end = i + 1
+			/* skip the empty windows */
+			n := limit.Sub(points[i].t)/window + 1
+			limit = limit.Add(-n * window)
+		}
+	}
+	result = append(result, points[:end])
+	/* reverse to be sorted by time */
+	for i, j := 0, len(result)-1; i < j; i, j = i+1, j-1 {
+		result[i], result[j] = result[j], result[i]
+	}
+	return result
+}
+
+// sliding returns the window (t - window, t] of each point at t that is at least
+// window after the first point
+func sliding(points []point, window time.Duration) [][]point {
+	result := make([][]point, 0)
+	start := 0
+	for i, p := range points {
+		if p.t.Sub(points[0].t) < window {
+			continue
+		}
+		for !points[start].t.After(p.t.Add(-window)) {
+			start++
+		}
+		result = append(result, points[start:i+1])
+	}
+	return result
+}
+
+func average(points []point) (float64, bool) {
+	s, _ := sum(points)
+	return s / float64(len(points)), true
+}
+
+func sum(points []point) (float64, bool) {
+	result := 0.0
+	for _, p := range points {
+		result += p.value
+	}
+	return result, true
+}
+
+func fold(points []point, f func(float64, float64) float64) float64 {
+	result := points[0].value
+	for _, p := range points[1:] {
+		result = f(result, p.value)
+	}
+	return result
+}
+
+// rate returns the per-second increase of a counter. A decrease is considered a
+// reset of the counter, and the value after the reset is taken as the increase.
+func rate(points []point) (float64, bool) {
+	if len(points) < 2 {
+		return 0, false
+	}
+	elapsed := points[len(points)-1].t.Sub(points[0].t).Seconds()
+	if elapsed <= 0 {
+		return 0, false
+	}
+	increase := 0.0
+	for i := 1; i < len(points); i++ {
+		if delta := points[i].value - points[i-1].value; delta >= 0 {
+			increase += delta
+		} else {
+			increase += points[i].value
+		}
+	}
+	return increase / elapsed, true
+}
+
+// percentile returns an aggregator of the p-th percentile, linearly interpolated
+// between the closest ranks
+func percentile(p float64) aggregator {
+	return func(points []point) (float64, bool) {
+		values := make([]float64, len(points))
+		for i, pt := range points {
+			values[i] = pt.value
+		}
+		sort.Float64s(values)
+		rank := p / 100 * float64(len(values)-1)
+		lower := int(math.Floor(rank))
+		if lower == len(values)-1 {
+			return values[lower], true
+		}
+		frac := rank - float64(lower)
+		return values[lower] + frac*(values[lower+1]-values[lower]), true
+	}
+}
+
+// stddev returns the population standard deviation
+func stddev(points []point) (float64, bool) {
+	avg, _ := average(points)
+	sq := 0.0
+	for _, p := range points {
+		sq += (p.value - avg) * (p.value - avg)
+	}
+	return math.Sqrt(sq / float64(len(points))), true
+}
@@ -0,0 +1,164 @@
+/*
+Copyright 2020 Atos
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package genericadapter
+
+import (
+	"SLALite/model"
+	"encoding/json"
+	"math"
+	"testing"
+	"time"
+)
+
+var ta = time.Date(2019, 10, 29, 10, 0, 0, 0, time.UTC)
+
+func TestAggregationTypes(t *testing.T) {
+	values := newValues("v", ta, []m{
+		{0, 4}, {10, 1}, {20, 3}, {30, 2}, {40, 10},
+	})
+	for _, c := range []struct {
+		aggregation model.AggregationType
+		expected    float64
+	}{
+		{model.AVERAGE, 4},
+		{model.SUM, 20},
+		{model.MIN, 1},
+		{model.MAX, 10},
+		{model.COUNT, 5},
+		{model.RATE, 0.325}, /* (1 + 2 + 2 + 8) / 40, with two resets */
+		{model.LAST, 10},
+		{model.P50, 3},
+		{model.P95, 8.8},
+		{model.P99, 9.76},
+		{model.STDDEV, math.Sqrt(10)},
+	} {
+		v := model.Variable{Name: "v", Aggregation: &model.Aggregation{Type: c.aggregation}}
+		output, err := Aggregate(v, values)
+		if err != nil {
+			t.Fatalf("%s: %s", c.aggregation, err.Error())
+		}
+		if len(output) != 1 {
+			t.Fatalf("%s: unexpected values %v", c.aggregation, output)
+		}
+		if actual := output[0].Value.(float64); math.Abs(actual-c.expected) > 1e-9 {
+			t.Errorf("%s. Expected: %f; Actual: %f", c.aggregation, c.expected, actual)
+		}
+		if !output[0].DateTime.Equal(values[4].DateTime) {
+			t.Errorf("%s. Unexpected time: %v", c.aggregation, output[0].DateTime)
+		}
+	}
+}
+
+func TestRateSinglePoint(t *testing.T) {
+	v := model.Variable{Name: "v", Aggregation: &model.Aggregation{Type: model.RATE}}
+	output, err := Aggregate(v, newValues("v", ta, []m{{0, 4}}))
+	if err != nil || len(output) != 0 {
+		t.Errorf("Unexpected result: %v, %v", output, err)
+	}
+}
+
+func TestTumblingWindow(t *testing.T) {
+	values := newValues("v", ta, []m{
+		{0, 1}, {5, 2}, {10, 3}, {15, 4}, {50, 5}, {55, 6},
+	})
+	v := model.Variable{Name: "v", Aggregation: &model.Aggregation{Type: model.SUM, Window: 10}}
+	output, err := Aggregate(v, values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	/* windows: (-5, 5], (5, 15], (45, 55] */
+	checkAggregated(t, output, []m{{5, 3}, {15, 7}, {55, 11}})
+}
+
+func TestSlidingWindow(t *testing.T) {
+	values := newValues("v", ta, []m{
+		{0, 1}, {5, 2}, {10, 3}, {15, 4}, {20, 5},
+	})
+	v := model.Variable{Name: "v", Aggregation: &model.Aggregation{Type: model.MAX, Window: 10, WindowType: model.SLIDING}}
+	output, err := Aggregate(v, values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkAggregated(t, output, []m{{10, 3}, {15, 4}, {20, 5}})
+
+	v.Aggregation.Type = model.COUNT
+	output, _ = Aggregate(v, values)
+	checkAggregated(t, output, []m{{10, 2}, {15, 2}, {20, 2}})
+}
+
+func TestAggregationErrors(t *testing.T) {
+	values := newValues("v", ta, []m{{0, 1}, {5, 2}})
+	for _, a := range []model.Aggregation{
+		{Type: "median"},
+		{Type: model.MAX, WindowType: model.SLIDING},
+		{Type: model.MAX, WindowType: "hopping"},
+	} {
+		v := model.Variable{Name: "v", Aggregation: &a}
+		if _, err := Aggregate(v, values); err == nil {
+			t.Errorf("Expected error with aggregation %v", a)
+		}
+	}
+
+	v := model.Variable{Name: "v", Aggregation: &Average}
+	values[1].Value = "2"
+	if _, err := Aggregate(v, values); err == nil {
+		t.Errorf("Expected error with non numeric value")
+	}
+	if _, err := Processor(model.LOCAL)(v, values); err == nil {
+		t.Errorf("Expected error processing non numeric value")
+	}
+
+	values[1].Value = json.Number("2")
+	values[0].Value = 1
+	if output, err := Aggregate(v, values); err != nil || output[0].Value != 1.5 {
+		t.Errorf("Unexpected result: %v, %v", output, err)
+	}
+}
+
+func checkAggregated(t *testing.T, output []model.MetricValue, expected []m) {
+	if len(output) != len(expected) {
+		t.Fatalf("Unexpected values. Expected: %v; Actual: %v", expected, output)
+	}
+	for i, e := range expected {
+		if !output[i].DateTime.Equal(ta.Add(time.Duration(e.t)*time.Second)) || output[i].Value != e.v {
+			t.Errorf("Unexpected value %d. Expected: %v; Actual: %v", i, e, output[i])
+		}
+	}
+}
+
+func TestProcessor(t *testing.T) {
+	values := newValues("v", ta, []m{{0, 1}, {5, 3}})
+	aggregated := model.Variable{Name: "v", Aggregation: &model.Aggregation{Type: model.SUM}}
+	monitoring := model.Variable{Name: "m", Aggregation: &model.Aggregation{Type: model.SUM, Processor: model.MONITORING}}
+	local := model.Variable{Name: "l", Aggregation: &model.Aggregation{Type: model.SUM, Processor: model.LOCAL}}
+
+	for _, c := range []struct {
+		processor model.AggregationProcessor
+		v         model.Variable
+		expected  int
+	}{
+		{model.LOCAL, aggregated, 1},
+		{model.LOCAL, monitoring, 2},
+		{model.MONITORING, aggregated, 2},
+		{model.MONITORING, local, 1},
+		{model.MONITORING, model.Variable{Name: "raw"}, 2},
+	} {
+		if output, err := Processor(c.processor)(c.v, values); err != nil || len(output) != c.expected {
+			t.Errorf("Unexpected values of %s with processor %s: %v", c.v.Name, c.processor, output)
+		}
+	}
+}
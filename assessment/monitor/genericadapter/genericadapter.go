@@ -34,8 +34,11 @@ import (
 	amodel "SLALite/assessment/model"
 	"SLALite/assessment/monitor"
 	"SLALite/model"
+	"fmt"
 	"math/rand"
 	"time"
+
+	log "github.com/sirupsen/logrus"
 )
 
 /*
@@ -46,8 +49,8 @@ the Process field is a function to perform additional processing
 on data.
 
 Two Process functions are provided in the package:
-Identity (returns the input) and Aggregation (aggregates values according
-to the aggregation type)
+Identity (returns the input) and Aggregate (aggregates values according
+to the aggregation of the variable)
 */
 type Adapter struct {
 	Retrieve  Retrieve
@@ -61,8 +64,8 @@ type Adapter struct {
 type Retrieve func(agreement model.Agreement, items []monitor.RetrievalItem) map[model.Variable][]model.MetricValue
 
 // Process is the type of the function that performs additional custom processing on
-// retrieved data.
-type Process func(v model.Variable, values []model.MetricValue) []model.MetricValue
+// retrieved data. An error is returned if the values cannot be processed.
+type Process func(v model.Variable, values []model.MetricValue) ([]model.MetricValue, error)
 
 // New is a helper function to build an Adapter from a Retriever and the Process function.
 func New(retrieve Retrieve, process Process) monitor.MonitoringAdapter {
@@ -96,7 +99,21 @@ func (ga *Adapter) Initialize(a *model.Agreement) monitor.MonitoringAdapter {
 }
 
 // GetValues implements Monitoring.GetValues().
+//
+// If the values cannot be processed, the error is logged and no values are returned
+// (see GetCheckedValues).
 func (ga *Adapter) GetValues(gt model.Guarantee, varnames []string, now time.Time) amodel.GuaranteeData {
+	result, err := ga.GetCheckedValues(gt, varnames, now)
+	if err != nil {
+		log.Errorf("Error getting values of %s[%s]: %s", ga.agreement.Id, gt.Name, err.Error())
+		return amodel.GuaranteeData{}
+	}
+	return result
+}
+
+// GetCheckedValues implements monitor.CheckedAdapter.GetCheckedValues(), returning
+// an error if the values of a variable cannot be processed.
+func (ga *Adapter) GetCheckedValues(gt model.Guarantee, varnames []string, now time.Time) (amodel.GuaranteeData, error) {
 
 	a := ga.agreement
 
@@ -106,9 +123,28 @@ func (ga *Adapter) GetValues(gt model.Guarantee, varnames []string, now time.Tim
 	/* process each of the series*/
 	valuesmap := map[model.Variable][]model.MetricValue{}
 	for v := range unprocessed {
-		valuesmap[v] = ga.Process(v, unprocessed[v])
+		values, err := ga.Process(v, unprocessed[v])
+		if err != nil {
+			return nil, fmt.Errorf("error processing variable %s: %s", v.Name, err.Error())
+		}
+		valuesmap[v] = values
+	}
+	result := MountInterpolated(valuesmap, lastvalues(a, gt), interpolation(a))
+	return result, nil
+}
+
+// interpolation returns the interpolation of the agreement, with the default values
+// for the unset fields
+func interpolation(a *model.Agreement) model.Interpolation {
+	result := model.Interpolation{Type: model.CONSTANT, Tolerance: DefaultTolerance}
+	if i := a.Details.Interpolation; i != nil {
+		if i.Type != "" {
+			result.Type = i.Type
+		}
+		if i.Tolerance > 0 {
+			result.Tolerance = i.Tolerance
+		}
 	}
-	result := Mount(valuesmap, lastvalues(a, gt), 0.1)
 	return result
 }
 
@@ -165,39 +201,6 @@ func (r DummyRetriever) Retrieve() Retrieve {
 }
 
 // Identity returns the input
-func Identity(v model.Variable, values []model.MetricValue) []model.MetricValue {
-	return values
-}
-
-// Aggregate performs an aggregation function on the input.
-//
-// This expects that all the values are in the appropriate window. For that,
-// the Retrieve function needs to return only the values in the window. If not,
-// this function will return an invalid result.
-func Aggregate(v model.Variable, values []model.MetricValue) []model.MetricValue {
-	if len(values) == 0 || v.Aggregation == nil || v.Aggregation.Type == "" {
-		return values
-	}
-	if v.Aggregation.Type == model.AVERAGE {
-		avg := average(values)
-		return []model.MetricValue{
-			model.MetricValue{
-				Key:      v.Name,
-				Value:    avg,
-				DateTime: values[len(values)-1].DateTime,
-			},
-		}
-	}
-	/* fallback */
-	return values
-}
-
-func average(values []model.MetricValue) float64 {
-	sum := 0.0
-	for _, value := range values {
-		sum += value.Value.(float64)
-	}
-	result := sum / float64(len(values))
-
-	return result
+func Identity(v model.Variable, values []model.MetricValue) ([]model.MetricValue, error) {
+	return values, nil
 }
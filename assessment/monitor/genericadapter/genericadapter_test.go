@@ -18,6 +18,7 @@ package genericadapter
 
 import (
 	"SLALite/assessment"
+	"SLALite/assessment/monitor"
 	"SLALite/model"
 	"SLALite/utils"
 	"os"
@@ -53,8 +54,8 @@ func TestAverage(t *testing.T) {
 		{0, 1}, {1, 2}, {2, 0.5}, {3, 1.5},
 	})
 
-	var avg float64
-	if avg = average(values); avg != 1.25 {
+	points, _ := toPoints(values)
+	if avg, _ := average(points); avg != 1.25 {
 		t.Errorf("Unexpected average. Expected: %f; Actual: %f", 1.25, avg)
 	}
 	v := model.Variable{
@@ -62,8 +63,8 @@ func TestAverage(t *testing.T) {
 		Metric:      name,
 		Aggregation: &Average,
 	}
-	output := Aggregate(v, values)
-	if len(output) != 1 {
+	output, err := Aggregate(v, values)
+	if err != nil || len(output) != 1 {
 		t.Errorf("Unexpected values length. Expected: %d; Actual: %d", 1, len(output))
 		return
 	}
@@ -107,8 +108,8 @@ func TestAverageWrongInput(t *testing.T) {
 }
 func testAverageWrongInput(t *testing.T, v model.Variable, values []model.MetricValue) {
 
-	output := Aggregate(v, values)
-	if len(output) != len(values) {
+	output, err := Aggregate(v, values)
+	if err != nil || len(output) != len(values) {
 		t.Errorf("Unexpected values length. Expected: %d; Actual: %d", len(values), len(output))
 		return
 	}
@@ -135,6 +136,35 @@ func TestGenericAdapter(t *testing.T) {
 	 */
 }
 
+func TestGenericAdapterProcessError(t *testing.T) {
+	retrieve := func(agreement model.Agreement, items []monitor.RetrievalItem) map[model.Variable][]model.MetricValue {
+		result := map[model.Variable][]model.MetricValue{}
+		for _, item := range items {
+			result[item.Var] = []model.MetricValue{{Key: item.Var.Name, Value: "up", DateTime: item.To}}
+		}
+		return result
+	}
+	a, _ := utils.ReadAgreement("testdata/a.json")
+	a.State = model.STARTED
+
+	ma := New(retrieve, Aggregate).Initialize(&a)
+	if values := ma.GetValues(a.Details.Guarantees[0], []string{"availability"}, time.Now()); len(values) != 0 {
+		t.Errorf("Unexpected values: %v", values)
+	}
+
+	cfg := assessment.Config{
+		Adapter: ma,
+		Now:     time.Now(),
+	}
+	result := assessment.AssessAgreement(&a, cfg)
+	if _, ok := result.Errors["qos"]; !ok {
+		t.Errorf("Expected error processing non numeric values")
+	}
+	if a.Assessment.GetGuarantee("qos").LastError == "" {
+		t.Errorf("Expected LastError in assessment")
+	}
+}
+
 func newVar(name string) model.Variable {
 	return model.Variable{
 		Name:   name,
@@ -35,18 +35,24 @@ type mountCtx struct {
 	lens map[model.Variable]int
 	// maxlen contains the maximum length
 	maxlen int
-	// maxdelta is maximum time allowed for metrics to be considered in the same pointset
-	maxdelta float64
+	// interpolations contains the interpolation of each variable, whose Tolerance is
+	// the maximum time allowed for metrics to be considered in the same pointset
+	interpolations map[model.Variable]model.Interpolation
 	// sumlens is the sum of the series lengths in values
 	sumlens int
 }
 
+// DefaultTolerance is the default maximum time in seconds between metrics to be
+// considered in the same pointset
+const DefaultTolerance = 0.1
+
 // Be careful if you run the code here after 73069258126-09-25!
 var _INF = time.Unix(1<<61, 0)
 
 /*
 Mount builds the GuaranteeData structure, directly used for agreement assessment,
-considering constant interpolation.
+considering constant interpolation (unless other is set in the variables, see
+MountInterpolated).
 
 Constant interpolation means that for a variable whose value is not known at a time t,
 it is considered that it has the value of last known value.
@@ -83,7 +89,29 @@ func Mount(valuesmap map[model.Variable][]model.MetricValue,
 	lastvalues map[string]model.MetricValue,
 	maxdelta float64) amodel.GuaranteeData {
 
-	ctx := initCtx(valuesmap, lastvalues, maxdelta)
+	return MountInterpolated(valuesmap, lastvalues, model.Interpolation{Type: model.CONSTANT, Tolerance: maxdelta})
+}
+
+/*
+MountInterpolated is Mount, but the interpolation of each variable, and the maximum
+delta between its points and the pointset, are set by the Interpolation of the
+variable, taking the unset fields from def.
+
+If the variable has no point in the delta of a pointset, its value is:
+
+  - constant: the last known value.
+  - linear: the value on the line between the last known value and the next point
+    (the last known value if there is no next point or the values are not numbers).
+  - nearest: the nearest in time of the last known value and the next point.
+  - drop-incomplete: none, so the point set is discarded.
+
+The point set is discarded if there is no value for a variable.
+*/
+func MountInterpolated(valuesmap map[model.Variable][]model.MetricValue,
+	lastvalues map[string]model.MetricValue,
+	def model.Interpolation) amodel.GuaranteeData {
+
+	ctx := initCtx(valuesmap, lastvalues, def)
 
 	result := make(amodel.GuaranteeData, 0, ctx.maxlen)
 
@@ -109,13 +137,14 @@ func Mount(valuesmap map[model.Variable][]model.MetricValue,
 
 func initCtx(valuesmap map[model.Variable][]model.MetricValue,
 	lastvalues map[string]model.MetricValue,
-	maxdelta float64) mountCtx {
+	def model.Interpolation) mountCtx {
 
 	if lastvalues == nil {
 		lastvalues = model.LastValues{}
 	}
 	index := make(map[model.Variable]int)
 	lens := make(map[model.Variable]int)
+	interpolations := make(map[model.Variable]model.Interpolation)
 	max := 0
 	sum := 0
 
@@ -130,15 +159,17 @@ func initCtx(valuesmap map[model.Variable][]model.MetricValue,
 			max = l
 		}
 		sum += l
+
+		interpolations[v] = interpolationOf(v, def)
 	}
 	ctx := mountCtx{
-		values:   valuesmap,
-		last:     lastvalues,
-		index:    index,
-		lens:     lens,
-		maxlen:   max,
-		maxdelta: maxdelta,
-		sumlens:  sum,
+		values:         valuesmap,
+		last:           lastvalues,
+		index:          index,
+		lens:           lens,
+		maxlen:         max,
+		interpolations: interpolations,
+		sumlens:        sum,
 	}
 	return ctx
 }
@@ -172,19 +203,84 @@ func (ctx *mountCtx) buildNextPointSet(nextp model.MetricValue) (amodel.Expressi
 
 	for v := range ctx.values {
 		value := ctx.getCurrentValue(v)
-		if deltaTimes(nextp, value) <= ctx.maxdelta {
+		interpolation := ctx.interpolations[v]
+		if deltaTimes(nextp, value) <= interpolation.Tolerance {
 			data[v.Name] = value
 			ctx.index[v]++
 			ctx.last[v.Name] = value
-		} else if _, ok := ctx.last[v.Name]; !ok {
-			discard = true
+		} else if aux, ok := ctx.interpolate(v, interpolation.Type, nextp.DateTime, value); ok {
+			data[v.Name] = aux
 		} else {
-			data[v.Name] = ctx.last[v.Name]
+			discard = true
 		}
 	}
 	return data, !discard
 }
 
+// interpolationOf returns the interpolation of a variable, taking the unset fields from def
+func interpolationOf(v model.Variable, def model.Interpolation) model.Interpolation {
+	result := def
+	if v.Interpolation != nil {
+		if v.Interpolation.Type != "" {
+			result.Type = v.Interpolation.Type
+		}
+		if v.Interpolation.Tolerance > 0 {
+			result.Tolerance = v.Interpolation.Tolerance
+		}
+	}
+	if result.Type == "" {
+		result.Type = model.CONSTANT
+	}
+	return result
+}
+
+/*
+interpolate returns the value of a variable at t, which has no point at t,
+from the last known value and the next point (which is in the infinite future
+if the series has been exhausted).
+
+The second return value is false if the value cannot be interpolated.
+*/
+func (ctx *mountCtx) interpolate(v model.Variable, typ model.InterpolationType,
+	t time.Time, next model.MetricValue) (model.MetricValue, bool) {
+
+	last, hasLast := ctx.last[v.Name]
+	hasNext := next.DateTime.Before(_INF)
+
+	switch typ {
+	case model.DROPINCOMPLETE:
+		return model.MetricValue{}, false
+	case model.NEAREST:
+		if hasNext && (!hasLast || next.DateTime.Sub(t) < t.Sub(last.DateTime)) {
+			/* the value is at t, not in the future, as the point set is at t */
+			result := next
+			result.DateTime = t
+			return result, true
+		}
+	case model.LINEAR:
+		if hasLast && hasNext {
+			if value, ok := linear(last, next, t); ok {
+				return value, true
+			}
+		}
+	}
+	return last, hasLast
+}
+
+// linear returns the value at t on the line between the values prev and next
+func linear(prev model.MetricValue, next model.MetricValue, t time.Time) (model.MetricValue, bool) {
+	y0, err0 := toFloat(prev.Value)
+	y1, err1 := toFloat(next.Value)
+	span := next.DateTime.Sub(prev.DateTime).Seconds()
+	if err0 != nil || err1 != nil || span <= 0 {
+		return prev, false
+	}
+	result := prev
+	result.Value = y0 + (y1-y0)*t.Sub(prev.DateTime).Seconds()/span
+	result.DateTime = t
+	return result, true
+}
+
 /*
 getCurrentValue returns the next value of a variable according to the
 index.
@@ -37,6 +37,7 @@ import (
 	amodel "SLALite/assessment/model"
 	"SLALite/model"
 	"fmt"
+	"math"
 	"testing"
 	"time"
 )
@@ -60,7 +61,7 @@ func TestFindNextPoint(t *testing.T) {
 
 	valuesmap := map[model.Variable][]model.MetricValue{v1: v1V, v2: v2V, v3: v3V}
 	lastvalues := map[string]model.MetricValue{}
-	ctx := initCtx(valuesmap, lastvalues, 0.2)
+	ctx := initCtx(valuesmap, lastvalues, model.Interpolation{Tolerance: 0.2})
 
 	p := ctx.findNextPoint()
 	if p != v1V[0] {
@@ -88,7 +89,7 @@ func TestBuildNextPointSet(t *testing.T) {
 
 	valuesmap := map[model.Variable][]model.MetricValue{v1: v1V, v2: v2V, v3: v3V}
 	lastvalues := map[string]model.MetricValue{}
-	ctx := initCtx(valuesmap, lastvalues, 0.2)
+	ctx := initCtx(valuesmap, lastvalues, model.Interpolation{Tolerance: 0.2})
 
 	p := ctx.findNextPoint()
 	data, ok := ctx.buildNextPointSet(p)
@@ -182,6 +183,125 @@ func TestUnsortedSeries(t *testing.T) {
 	fmt.Printf("%#v", pointsets)
 }
 
+func TestMountInterpolated(t *testing.T) {
+	a := newVar("a")
+	b := newVar("b")
+	aV := newValues(a.Metric, t0, []m{{0, 1}, {10, 3}})
+	bV := newValues(b.Metric, t0, []m{{0, 10}, {7, 20}, {10, 30}})
+
+	/* value of a at t=7 */
+	for _, tc := range []struct {
+		typ       model.InterpolationType
+		pointsets int
+		value     float64
+	}{
+		{model.CONSTANT, 3, 1},
+		{"", 3, 1},
+		{model.LINEAR, 3, 2.4},
+		{model.NEAREST, 3, 3},
+		{model.DROPINCOMPLETE, 2, 0},
+	} {
+		valuesmap := map[model.Variable][]model.MetricValue{a: aV, b: bV}
+		pointsets := MountInterpolated(valuesmap, model.LastValues{}, model.Interpolation{Type: tc.typ, Tolerance: 0.1})
+		if len(pointsets) != tc.pointsets {
+			t.Errorf("%s: unexpected number of pointsets. Expected: %d; Actual: %d", tc.typ, tc.pointsets, len(pointsets))
+			continue
+		}
+		assertPointSet(t, pointsets[0], aV[0], bV[0], bV[0])
+		if tc.pointsets == 2 {
+			assertPointSet(t, pointsets[1], aV[1], bV[2], bV[2])
+			continue
+		}
+		if actual := pointsets[1]["a"].Value; math.Abs(actual.(float64)-tc.value) > 1e-9 {
+			t.Errorf("%s: unexpected interpolated value. Expected: %v; Actual: %v", tc.typ, tc.value, actual)
+		}
+		if pointsets[1]["b"] != bV[1] {
+			t.Errorf("%s: unexpected value of b: %v", tc.typ, pointsets[1]["b"])
+		}
+		assertPointSet(t, pointsets[2], aV[1], bV[2], bV[2])
+
+		/* the point sets are at the times of the values of b */
+		for i, ps := range pointsets {
+			if actual := pointSetTime(ps); !actual.Equal(bV[i].DateTime) {
+				t.Errorf("%s: unexpected time of pointset %d. Expected: %v; Actual: %v",
+					tc.typ, i, bV[i].DateTime, actual)
+			}
+		}
+	}
+}
+
+// pointSetTime returns the time of the newest value of a point set
+func pointSetTime(ps amodel.ExpressionData) time.Time {
+	var result time.Time
+	for _, v := range ps {
+		if v.DateTime.After(result) {
+			result = v.DateTime
+		}
+	}
+	return result
+}
+
+func TestMountInterpolatedByVariable(t *testing.T) {
+	a := newVar("a")
+	a.Interpolation = &model.Interpolation{Type: model.LINEAR}
+	b := newVar("b")
+	aV := newValues(a.Metric, t0, []m{{0, 1}, {10, 3}})
+	bV := newValues(b.Metric, t0, []m{{0, 10}, {5, 20}, {10, 30}})
+	valuesmap := map[model.Variable][]model.MetricValue{a: aV, b: bV}
+
+	pointsets := MountInterpolated(valuesmap, model.LastValues{}, model.Interpolation{Type: model.DROPINCOMPLETE, Tolerance: 0.1})
+	if len(pointsets) != 3 {
+		t.Fatalf("Unexpected number of pointsets. Expected: %d; Actual: %d", 3, len(pointsets))
+	}
+	if value := pointsets[1]["a"]; value.Value != 2.0 || !value.DateTime.Equal(bV[1].DateTime) {
+		t.Errorf("Unexpected interpolated value: %v", value)
+	}
+}
+
+func TestMountTolerance(t *testing.T) {
+	a := newVar("a")
+	b := newVar("b")
+	aV := newValues(a.Metric, t0, []m{{0, 1}, {10, 3}})
+	bV := newValues(b.Metric, t0, []m{{0.5, 10}, {10.3, 20}})
+
+	valuesmap := map[model.Variable][]model.MetricValue{a: aV, b: bV}
+	pointsets := MountInterpolated(valuesmap, model.LastValues{}, model.Interpolation{Tolerance: DefaultTolerance})
+	if len(pointsets) != 3 {
+		t.Errorf("Unexpected number of pointsets. Expected: %d; Actual: %d", 3, len(pointsets))
+	}
+
+	valuesmap = map[model.Variable][]model.MetricValue{a: aV, b: bV}
+	pointsets = MountInterpolated(valuesmap, model.LastValues{}, model.Interpolation{Tolerance: 1})
+	if len(pointsets) != 2 {
+		t.Fatalf("Unexpected number of pointsets. Expected: %d; Actual: %d", 2, len(pointsets))
+	}
+	assertPointSet(t, pointsets[0], aV[0], bV[0], bV[0])
+	assertPointSet(t, pointsets[1], aV[1], bV[1], bV[1])
+
+	/* the tolerance of the variable overrides the default */
+	b.Interpolation = &model.Interpolation{Tolerance: 1}
+	valuesmap = map[model.Variable][]model.MetricValue{a: aV, b: bV}
+	pointsets = MountInterpolated(valuesmap, model.LastValues{}, model.Interpolation{Tolerance: DefaultTolerance})
+	if len(pointsets) != 2 {
+		t.Errorf("Unexpected number of pointsets. Expected: %d; Actual: %d", 2, len(pointsets))
+	}
+}
+
+func TestAgreementInterpolation(t *testing.T) {
+	a := model.Agreement{}
+	if i := interpolation(&a); i.Type != model.CONSTANT || i.Tolerance != DefaultTolerance {
+		t.Errorf("Unexpected default interpolation: %v", i)
+	}
+	a.Details.Interpolation = &model.Interpolation{Type: model.NEAREST}
+	if i := interpolation(&a); i.Type != model.NEAREST || i.Tolerance != DefaultTolerance {
+		t.Errorf("Unexpected interpolation: %v", i)
+	}
+	a.Details.Interpolation = &model.Interpolation{Tolerance: 5}
+	if i := interpolation(&a); i.Type != model.CONSTANT || i.Tolerance != 5 {
+		t.Errorf("Unexpected interpolation: %v", i)
+	}
+}
+
 func assertPointSet(t *testing.T, data amodel.ExpressionData, m1, m2, m3 model.MetricValue) bool {
 	if data[m1.Key] != m1 || data[m2.Key] != m2 || data[m3.Key] != m3 {
 		if data[m1.Key] != m1 {
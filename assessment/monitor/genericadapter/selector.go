@@ -0,0 +1,94 @@
+/*
+Copyright 2020 Atos
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package genericadapter
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ParseSelector parses a metric name with an optional label selector with
+// equality matchers: name{label="value",...}
+func ParseSelector(s string) (string, map[string]string, error) {
+	name, labels, rest, err := ParseSeries(strings.TrimSpace(s))
+	if err != nil {
+		return "", nil, err
+	}
+	if strings.TrimSpace(rest) != "" {
+		return "", nil, fmt.Errorf("unexpected '%s'", rest)
+	}
+	return name, labels, nil
+}
+
+// ParseSeries parses the name and labels at the start of s, returning the rest of s.
+//
+// It parses the series of the Prometheus text format: name{label="value",...} value [timestamp]
+func ParseSeries(s string) (string, map[string]string, string, error) {
+	labels := map[string]string{}
+	end := strings.IndexAny(s, "{ \t")
+	if end < 0 {
+		return s, labels, "", nil
+	}
+	name := s[:end]
+	if name == "" {
+		return "", nil, "", fmt.Errorf("metric name not found")
+	}
+	if s[end] != '{' {
+		return name, labels, s[end:], nil
+	}
+	i := end + 1
+	for {
+		for i < len(s) && (s[i] == ' ' || s[i] == ',') {
+			i++
+		}
+		if i >= len(s) {
+			return "", nil, "", fmt.Errorf("unclosed '{'")
+		}
+		if s[i] == '}' {
+			return name, labels, s[i+1:], nil
+		}
+		eq := strings.IndexByte(s[i:], '=')
+		if eq < 0 {
+			return "", nil, "", fmt.Errorf("expected '=' after label")
+		}
+		label := strings.TrimSpace(s[i : i+eq])
+		i += eq + 1
+		for i < len(s) && s[i] == ' ' {
+			i++
+		}
+		if i >= len(s) || s[i] != '"' {
+			return "", nil, "", fmt.Errorf("expected quoted value of label %s", label)
+		}
+		closing := i + 1
+		for closing < len(s) && s[closing] != '"' {
+			if s[closing] == '\\' {
+				closing++
+			}
+			closing++
+		}
+		if closing >= len(s) {
+			return "", nil, "", fmt.Errorf("unterminated value of label %s", label)
+		}
+		value, err := strconv.Unquote(s[i : closing+1])
+		if err != nil {
+			return "", nil, "", fmt.Errorf("invalid value of label %s: %s", label, err.Error())
+		}
+		labels[label] = value
+		i = closing + 1
+	}
+}
@@ -0,0 +1,47 @@
+/*
+Copyright 2020 Atos
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package genericadapter
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSelector(t *testing.T) {
+	for _, c := range []struct {
+		s      string
+		name   string
+		labels map[string]string
+		valid  bool
+	}{
+		{"cpu", "cpu", map[string]string{}, true},
+		{`cpu{host="a", mode="idle"}`, "cpu", map[string]string{"host": "a", "mode": "idle"}, true},
+		{`cpu{host="a,\"b\""}`, "cpu", map[string]string{"host": `a,"b"`}, true},
+		{`cpu{host="a"`, "", nil, false},
+		{`cpu{host=a}`, "", nil, false},
+		{`cpu{host="a"} + 1`, "", nil, false},
+	} {
+		name, labels, err := ParseSelector(c.s)
+		if c.valid != (err == nil) {
+			t.Errorf("Unexpected error parsing %s: %v", c.s, err)
+			continue
+		}
+		if c.valid && (name != c.name || !reflect.DeepEqual(labels, c.labels)) {
+			t.Errorf("Unexpected result parsing %s: %s %v", c.s, name, labels)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+/*
+Copyright 2020 Atos
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package influxdb
+
+/*
+Example of Flux query:
+curl -XPOST 'localhost:8086/api/v2/query?org=my-org' -H 'Content-Type: application/json' \
+	-d '{"query": "from(bucket: \"telegraf\") |> range(start: -1h)", "dialect": {"header": true, "annotations": []}}'
+
+Example of output (a CSV with a header per table):
+
+	,result,table,_start,_stop,_time,_value,_field,_measurement,host
+	,_result,0,2019-10-29T09:00:00Z,2019-10-29T10:00:00Z,2019-10-29T09:10:00Z,97.5,usage_idle,cpu,node1
+	,_result,1,2019-10-29T09:00:00Z,2019-10-29T10:00:00Z,2019-10-29T09:10:00Z,95.2,usage_idle,cpu,node2
+*/
+
+import (
+	"SLALite/assessment/monitor"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	fluxTimeColumn  = "_time"
+	fluxValueColumn = "_value"
+	fluxTableColumn = "table"
+)
+
+// fluxSystemColumns are the columns that are not kept in the labels of the values
+var fluxSystemColumns = map[string]bool{
+	"":              true,
+	"result":        true,
+	fluxTableColumn: true,
+	"_start":        true,
+	"_stop":         true,
+	fluxTimeColumn:  true,
+	fluxValueColumn: true,
+}
+
+type fluxRequest struct {
+	Query   string      `json:"query"`
+	Type    string      `json:"type"`
+	Dialect fluxDialect `json:"dialect"`
+}
+
+type fluxDialect struct {
+	Header      bool     `json:"header"`
+	Annotations []string `json:"annotations"`
+}
+
+/*
+fluxQuery returns the Flux query of the metric of an item, restricted to its window.
+
+The window (From, To] is set in the v.timeRangeStart and v.timeRangeStop options
+(range() includes the start and excludes the stop). The leading imports of the
+metric are written before the options, as Flux requires. If the rest of the metric
+does not start with from(), it is piped to the range of the bucket.
+*/
+func fluxQuery(item monitor.RetrievalItem, bucket string) string {
+	from, to := bounds(item)
+	imports, metric := splitFluxImports(item.Var.Metric)
+
+	var b strings.Builder
+	for _, imp := range imports {
+		b.WriteString(imp)
+		b.WriteString("\n")
+	}
+	fmt.Fprintf(&b, "option v = {timeRangeStart: %s, timeRangeStop: %s, windowPeriod: %s}\n",
+		formatTime(from.Add(time.Nanosecond)), formatTime(to.Add(time.Nanosecond)), formatDuration(window(item)))
+
+	if !strings.HasPrefix(metric, "from(") {
+		fmt.Fprintf(&b, "from(bucket: %s)\n\t|> range(start: v.timeRangeStart, stop: v.timeRangeStop)\n\t",
+			strconv.Quote(bucket))
+	}
+	b.WriteString(metric)
+	return b.String()
+}
+
+// splitFluxImports returns the import statements at the start of a Flux metric
+// (skipping empty lines and comments), and the rest of the metric
+func splitFluxImports(metric string) ([]string, string) {
+	var imports []string
+	rest := strings.TrimSpace(metric)
+	for rest != "" {
+		line := rest
+		next := ""
+		if i := strings.IndexByte(rest, '\n'); i >= 0 {
+			line, next = rest[:i], rest[i+1:]
+		}
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "import ") {
+			imports = append(imports, line)
+		} else if line != "" && !strings.HasPrefix(line, "//") {
+			break
+		}
+		rest = strings.TrimSpace(next)
+	}
+	return imports, rest
+}
+
+// queryFlux performs a Flux query, returning the series in the result
+func (r Retriever) queryFlux(rootURL string, q string) ([]serie, error) {
+	body, err := json.Marshal(fluxRequest{
+		Query:   q,
+		Type:    "flux",
+		Dialect: fluxDialect{Header: true, Annotations: []string{}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	params := url.Values{}
+	if r.Org != "" {
+		params.Set("org", r.Org)
+	}
+	req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("%s/api/v2/query?%s", rootURL, params.Encode()),
+		bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/csv")
+	resp, err := r.do(req, rootURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return nil, fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return parseFlux(resp.Body)
+}
+
+// parseFlux returns the series of a Flux CSV response: one per table.
+//
+// Rows with a non numeric _value are skipped.
+func parseFlux(r io.Reader) ([]serie, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	result := make([]serie, 0)
+	var header []string
+	current := -1
+	currentTable := ""
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return result, err
+		}
+		if isFluxHeader(row) {
+			header = row
+			current = -1
+			continue
+		}
+		if header == nil || len(row) != len(header) {
+			continue
+		}
+		var t time.Time
+		var value float64
+		var validTime, validValue bool
+		labels := map[string]string{}
+		table := ""
+		for i, col := range header {
+			switch col {
+			case fluxTimeColumn:
+				ts, err := time.Parse(time.RFC3339Nano, row[i])
+				t, validTime = ts, err == nil
+			case fluxValueColumn:
+				v, err := strconv.ParseFloat(row[i], 64)
+				value, validValue = v, err == nil
+			case fluxTableColumn:
+				table = row[i]
+			}
+			if !fluxSystemColumns[col] {
+				labels[col] = row[i]
+			}
+		}
+		if current < 0 || table != currentTable {
+			result = append(result, serie{labels: labels})
+			current = len(result) - 1
+			currentTable = table
+		}
+		if validTime && validValue {
+			result[current].points = append(result[current].points, point{t: t, value: value})
+		}
+	}
+	return result, nil
+}
+
+func isFluxHeader(row []string) bool {
+	hasTable, hasValue := false, false
+	for _, col := range row {
+		hasTable = hasTable || col == fluxTableColumn
+		hasValue = hasValue || col == fluxValueColumn
+	}
+	return hasTable && hasValue
+}
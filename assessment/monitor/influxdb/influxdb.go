@@ -0,0 +1,310 @@
+/*
+Copyright 2020 Atos
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+/*
+Package influxdb provides a Retriever to get monitoring metrics
+from an InfluxDB, using InfluxQL (InfluxDB 1.x and the 1.x compatibility API
+of InfluxDB 2.x) or Flux (InfluxDB 2.x and 1.8+).
+
+The metric of a variable is a query in the configured language, that is
+restricted to the window (From, To] of each RetrievalItem:
+
+InfluxQL queries may contain the $timeFilter placeholder, that is substituted by the
+time condition. If not present, the time condition is added to the WHERE clause.
+The $interval placeholder is substituted by the aggregation window of the variable
+(or the length of the window, if the variable is not aggregated). E.g.:
+
+	SELECT mean("usage_idle") FROM "cpu" WHERE $timeFilter GROUP BY time($interval), "host"
+
+Flux queries can use the v.timeRangeStart, v.timeRangeStop and v.windowPeriod
+variables. If the query does not start with from(), it is piped to the
+default bucket restricted to the window. E.g.:
+
+	|> filter(fn: (r) => r._measurement == "cpu" and r._field == "usage_idle")
+	|> aggregateWindow(every: v.windowPeriod, fn: mean)
+
+The tags of the series (and the measurement, in the _measurement label) are
+kept in the labels of the values, and mapped to the key and resource as in
+model.LabelMapping.
+*/
+package influxdb
+
+import (
+	"SLALite/assessment/monitor"
+	"SLALite/assessment/monitor/genericadapter"
+	"SLALite/model"
+	"SLALite/utils"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// Language is the query language of the retriever
+type Language string
+
+const (
+	// Name is the unique identifier of this adapter/retriever
+	Name = "influxdb"
+
+	// INFLUXQL is the query language of InfluxDB 1.x
+	INFLUXQL Language = "influxql"
+	// FLUX is the query language of InfluxDB 2.x
+	FLUX Language = "flux"
+
+	// InfluxDBURLPropertyName is the config property name of the InfluxDB URL.
+	// It is mandatory, and can be read from a file (see utils.GetSecret)
+	InfluxDBURLPropertyName = "influxdbUrl"
+	// LanguagePropertyName is the config property name of the query language (influxql or flux)
+	LanguagePropertyName = "influxdbLanguage"
+	// DatabasePropertyName is the config property name of the database of InfluxQL queries
+	DatabasePropertyName = "influxdbDatabase"
+	// RetentionPolicyPropertyName is the config property name of the retention policy of InfluxQL queries
+	RetentionPolicyPropertyName = "influxdbRetentionPolicy"
+	// OrgPropertyName is the config property name of the organization of Flux queries
+	OrgPropertyName = "influxdbOrg"
+	// BucketPropertyName is the config property name of the default bucket of Flux queries
+	BucketPropertyName = "influxdbBucket"
+	// UsernamePropertyName is the config property name of the user
+	UsernamePropertyName = "influxdbUsername"
+	// PasswordPropertyName is the config property name of the password.
+	// It can be read from a file (see utils.GetSecret)
+	PasswordPropertyName = "influxdbPassword"
+	// TokenPropertyName is the config property name of the API token of InfluxDB 2.x.
+	// It can be read from a file (see utils.GetSecret)
+	TokenPropertyName = "influxdbToken"
+	// KeyTagsPropertyName is the config property name of the tags mapped to the
+	// key of metric values (see model.LabelMapping)
+	KeyTagsPropertyName = "influxdbKeyTags"
+	// ResourceTagsPropertyName is the config property name of the tags mapped to the
+	// resource of metric values (see model.LabelMapping)
+	ResourceTagsPropertyName = "influxdbResourceTags"
+	// TimeoutPropertyName is the config property name of the timeout of the requests
+	TimeoutPropertyName = "influxdbTimeout"
+
+	// MeasurementLabel is the label that contains the measurement of a serie
+	MeasurementLabel = "_measurement"
+
+	defaultLanguage = INFLUXQL
+	defaultTimeout  = "30s"
+)
+
+// defaultTags is the tag mapping used if the Retriever does not set one
+var defaultTags = model.LabelMapping{
+	Key:      []string{"host"},
+	Resource: []string{MeasurementLabel},
+}
+
+// Retriever implements genericadapter.Retrieve
+type Retriever struct {
+	URL             string
+	Language        Language
+	Database        string
+	RetentionPolicy string
+	Org             string
+	Bucket          string
+	Username        string
+	Password        string
+	Token           string
+	// Labels is the mapping of tags to MetricValues, if not set in the variable
+	Labels model.LabelMapping
+	// Client performs the requests. http.DefaultClient is used if nil.
+	Client *http.Client
+}
+
+// New constructs an InfluxDB adapter from a Viper configuration
+func New(config *viper.Viper) (Retriever, error) {
+
+	config.SetDefault(LanguagePropertyName, string(defaultLanguage))
+	config.SetDefault(KeyTagsPropertyName, defaultTags.Key)
+	config.SetDefault(ResourceTagsPropertyName, defaultTags.Resource)
+	config.SetDefault(TimeoutPropertyName, defaultTimeout)
+
+	language := Language(config.GetString(LanguagePropertyName))
+	if language != INFLUXQL && language != FLUX {
+		return Retriever{}, fmt.Errorf("%s must be one of %s, %s; found '%s'",
+			LanguagePropertyName, INFLUXQL, FLUX, language)
+	}
+	rootURL, err := utils.RequireSecret(config, InfluxDBURLPropertyName)
+	if err != nil {
+		return Retriever{}, err
+	}
+	password, err := utils.GetSecret(config, PasswordPropertyName)
+	if err != nil {
+		return Retriever{}, err
+	}
+	token, err := utils.GetSecret(config, TokenPropertyName)
+	if err != nil {
+		return Retriever{}, err
+	}
+	tlsConfig, err := utils.NewTLSConfig("", "", "", false)
+	if err != nil {
+		return Retriever{}, err
+	}
+
+	r := Retriever{
+		URL:             rootURL,
+		Language:        language,
+		Database:        config.GetString(DatabasePropertyName),
+		RetentionPolicy: config.GetString(RetentionPolicyPropertyName),
+		Org:             config.GetString(OrgPropertyName),
+		Bucket:          config.GetString(BucketPropertyName),
+		Username:        config.GetString(UsernamePropertyName),
+		Password:        password,
+		Token:           token,
+		Labels: model.LabelMapping{
+			Key:      config.GetStringSlice(KeyTagsPropertyName),
+			Resource: config.GetStringSlice(ResourceTagsPropertyName),
+		},
+		Client: &http.Client{
+			Timeout:   config.GetDuration(TimeoutPropertyName),
+			Transport: &http.Transport{TLSClientConfig: tlsConfig, Proxy: http.ProxyFromEnvironment},
+		},
+	}
+	logConfig(r)
+	return r, nil
+}
+
+func logConfig(r Retriever) {
+	log.Infof("InfluxDB configuration:\n"+
+		"\tURL: %s\n"+
+		"\tLanguage: %s\n"+
+		"\tDatabase: %s\n"+
+		"\tOrg: %s\n"+
+		"\tBucket: %s\n"+
+		"\tKey tags: %v\n"+
+		"\tResource tags: %v",
+		utils.MaskURL(r.URL), r.Language, r.Database, r.Org, r.Bucket, r.Labels.Key, r.Labels.Resource)
+}
+
+// Retrieve implements genericadapter.Retrieve
+func (r Retriever) Retrieve() genericadapter.Retrieve {
+
+	return func(agreement model.Agreement,
+		items []monitor.RetrievalItem) map[model.Variable][]model.MetricValue {
+
+		rootURL := r.influxdbRoot(agreement)
+		result := make(map[model.Variable][]model.MetricValue)
+		for _, item := range items {
+			var series []serie
+			var err error
+			if r.Language == FLUX {
+				series, err = r.queryFlux(rootURL, fluxQuery(item, r.Bucket))
+			} else {
+				series, err = r.queryInfluxQL(rootURL, influxQLQuery(item))
+			}
+			if err != nil {
+				log.Errorf("Error querying variable %s of agreement %s: %s", item.Var.Name, agreement.Id, err.Error())
+			}
+			result[item.Var] = translate(series, r.labelMapping(item.Var))
+		}
+		return result
+	}
+}
+
+// serie is a set of points that share the labels
+type serie struct {
+	labels map[string]string
+	points []point
+}
+
+type point struct {
+	t     time.Time
+	value float64
+}
+
+// translate returns the values of all the series, sorted by time
+func translate(series []serie, mapping model.LabelMapping) []model.MetricValue {
+	res := make([]model.MetricValue, 0)
+	for _, s := range series {
+		k, rsc := mapping.Map(s.labels)
+		labels := model.NewLabels(s.labels)
+		for _, p := range s.points {
+			res = append(res, model.MetricValue{
+				Key:      k,
+				Value:    p.value,
+				DateTime: p.t,
+				Resource: rsc,
+				Labels:   labels,
+			})
+		}
+	}
+	sort.SliceStable(res, func(i, j int) bool {
+		return res[i].DateTime.Before(res[j].DateTime)
+	})
+	return res
+}
+
+// window returns the aggregation window of the item
+func window(item monitor.RetrievalItem) time.Duration {
+	v := item.Var
+	if v.Aggregation != nil && v.Aggregation.Window != 0 {
+		return time.Duration(v.Aggregation.Window) * time.Second
+	}
+	if w := item.To.Sub(item.From); !item.From.IsZero() && w > 0 {
+		return w
+	}
+	return time.Minute
+}
+
+// formatDuration returns d in seconds (e.g. "60s"), valid in InfluxQL and Flux
+func formatDuration(d time.Duration) string {
+	s := d.Seconds()
+	if s < 1 {
+		return strconv.FormatInt(d.Milliseconds(), 10) + "ms"
+	}
+	return strconv.FormatInt(int64(s), 10) + "s"
+}
+
+// labelMapping returns the tag mapping of a variable, falling back to the one of
+// the retriever and the default one
+func (r Retriever) labelMapping(v model.Variable) model.LabelMapping {
+	return v.Labels.Merge(r.Labels.Merge(defaultTags))
+}
+
+func (r Retriever) influxdbRoot(agreement model.Agreement) string {
+	if agreement.Assessment.MonitoringURL != "" {
+		return agreement.Assessment.MonitoringURL
+	}
+	return r.URL
+}
+
+// do performs a request, authenticated if it is sent to the URL of the retriever.
+// The credentials are not sent to the MonitoringURL of agreements.
+func (r Retriever) do(req *http.Request, rootURL string) (*http.Response, error) {
+	/* credentials are only sent to the configured InfluxDB */
+	if rootURL == r.URL {
+		if r.Token != "" {
+			req.Header.Set("Authorization", "Token "+r.Token)
+		} else if r.Username != "" {
+			req.SetBasicAuth(r.Username, r.Password)
+		}
+	}
+	client := r.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	log.Debugf("%d %s %s", resp.StatusCode, req.Method, utils.MaskURL(req.URL.String()))
+	return resp, nil
+}
@@ -0,0 +1,235 @@
+/*
+Copyright 2020 Atos
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package influxdb
+
+import (
+	"SLALite/assessment/monitor"
+	"SLALite/model"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+var to = time.Date(2019, 10, 29, 10, 0, 0, 0, time.UTC)
+
+func TestNew(t *testing.T) {
+	config := viper.New()
+	if _, err := New(config); err == nil {
+		t.Errorf("Expected error without URL")
+	}
+
+	config.Set(InfluxDBURLPropertyName+"_file", "testdata/url.txt")
+	r, err := New(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.URL != "http://influxdb:8086" || r.Language != INFLUXQL {
+		t.Errorf("Unexpected retriever: %v", r)
+	}
+	config.Set(LanguagePropertyName, "sql")
+	if _, err := New(config); err == nil {
+		t.Errorf("Expected error with invalid language")
+	}
+}
+
+func TestInfluxQLQuery(t *testing.T) {
+	from := to.Add(-time.Hour)
+	filter := "time > '2019-10-29T09:00:00Z' AND time <= '2019-10-29T10:00:00Z'"
+	aggregated := &model.Aggregation{Type: model.AVERAGE, Window: 600}
+
+	for _, c := range []struct {
+		metric      string
+		aggregation *model.Aggregation
+		expected    string
+	}{
+		{`SELECT "usage_idle" FROM "cpu"`, nil,
+			`SELECT "usage_idle" FROM "cpu" WHERE ` + filter},
+		{`SELECT mean("usage_idle") FROM "cpu" WHERE $timeFilter GROUP BY time($interval)`, aggregated,
+			`SELECT mean("usage_idle") FROM "cpu" WHERE ` + filter + ` GROUP BY time(600s)`},
+		{`SELECT mean("usage_idle") FROM "cpu" WHERE host = 'a' OR host = 'b' GROUP BY time($interval) fill(none)`, nil,
+			`SELECT mean("usage_idle") FROM "cpu" WHERE ` + filter + ` AND (host = 'a' OR host = 'b') GROUP BY time(3600s) fill(none)`},
+		{`SELECT max("usage_idle") FROM "cpu" GROUP BY "host"`, nil,
+			`SELECT max("usage_idle") FROM "cpu" WHERE ` + filter + ` GROUP BY "host"`},
+	} {
+		v := model.Variable{Name: "v", Metric: c.metric, Aggregation: c.aggregation}
+		item := monitor.RetrievalItem{Var: v, From: from, To: to}
+		if actual := influxQLQuery(item); actual != c.expected {
+			t.Errorf("Expected: %s; Actual: %s", c.expected, actual)
+		}
+	}
+}
+
+func TestRetrieveInfluxQL(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/query" {
+			t.Errorf("Unexpected path: %s", r.URL.Path)
+		}
+		q := r.URL.Query()
+		if q.Get("db") != "telegraf" || q.Get("epoch") != "ms" || !strings.Contains(q.Get("q"), "WHERE time >") {
+			t.Errorf("Unexpected query: %v", q)
+		}
+		if user, password, _ := r.BasicAuth(); user != "user" || password != "secret" {
+			t.Errorf("Unexpected credentials: %s/%s", user, password)
+		}
+		http.ServeFile(w, r, "testdata/influxql.json")
+	}))
+	defer server.Close()
+
+	r := Retriever{URL: server.URL, Language: INFLUXQL, Database: "telegraf", Username: "user", Password: "secret"}
+	v := model.Variable{Name: "cpu", Metric: `SELECT mean("usage_idle") FROM "cpu" GROUP BY time(10m), "host"`}
+	items := []monitor.RetrievalItem{{Var: v, From: to.Add(-time.Hour), To: to}}
+
+	values := r.Retrieve()(model.Agreement{}, items)[v]
+	if len(values) != 3 {
+		t.Fatalf("Unexpected values: %v", values)
+	}
+	first := values[0]
+	if first.Key != "node1" || first.Resource != "cpu" || first.Value != 97.5 ||
+		!first.DateTime.Equal(time.Unix(1572339600, 0)) || first.Labels.Get("host") != "node1" {
+		t.Errorf("Unexpected value: %v", first)
+	}
+	if last := values[2]; last.Key != "node2" || last.Value != 96.0 {
+		t.Errorf("Unexpected value: %v", last)
+	}
+}
+
+func TestInfluxQLError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error": "error parsing query"}`))
+	}))
+	defer server.Close()
+
+	r := Retriever{URL: server.URL}
+	if _, err := r.queryInfluxQL(server.URL, "SELECT"); err == nil {
+		t.Errorf("Expected error")
+	}
+}
+
+func TestFluxQuery(t *testing.T) {
+	item := monitor.RetrievalItem{
+		Var: model.Variable{Name: "v", Metric: `|> filter(fn: (r) => r._measurement == "cpu")`},
+		To:  to,
+	}
+	expected := "option v = {timeRangeStart: 2019-10-29T09:59:00.000000001Z, timeRangeStop: 2019-10-29T10:00:00.000000001Z, windowPeriod: 60s}\n" +
+		"from(bucket: \"telegraf\")\n\t|> range(start: v.timeRangeStart, stop: v.timeRangeStop)\n\t" +
+		`|> filter(fn: (r) => r._measurement == "cpu")`
+	if actual := fluxQuery(item, "telegraf"); actual != expected {
+		t.Errorf("Expected: %s; Actual: %s", expected, actual)
+	}
+
+	item.Var.Metric = `from(bucket: "b") |> range(start: v.timeRangeStart, stop: v.timeRangeStop)`
+	if actual := fluxQuery(item, "telegraf"); strings.Contains(actual, "telegraf") {
+		t.Errorf("Unexpected default bucket: %s", actual)
+	}
+
+	item.Var.Metric = "import \"math\"\n// rounded\nimport \"strings\"\n\n|> map(fn: (r) => ({r with _value: math.round(x: r._value)}))"
+	expected = "import \"math\"\nimport \"strings\"\n" +
+		"option v = {timeRangeStart: 2019-10-29T09:59:00.000000001Z, timeRangeStop: 2019-10-29T10:00:00.000000001Z, windowPeriod: 60s}\n" +
+		"from(bucket: \"telegraf\")\n\t|> range(start: v.timeRangeStart, stop: v.timeRangeStop)\n\t" +
+		"|> map(fn: (r) => ({r with _value: math.round(x: r._value)}))"
+	if actual := fluxQuery(item, "telegraf"); actual != expected {
+		t.Errorf("Expected: %s; Actual: %s", expected, actual)
+	}
+
+	item.Var.Metric = "import \"math\"\nfrom(bucket: \"b\") |> range(start: v.timeRangeStart, stop: v.timeRangeStop)"
+	if actual := fluxQuery(item, "telegraf"); !strings.HasPrefix(actual, "import \"math\"\noption v") ||
+		strings.Contains(actual, "telegraf") {
+		t.Errorf("Unexpected query: %s", actual)
+	}
+}
+
+func TestRetrieveFlux(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/api/v2/query" || r.URL.Query().Get("org") != "my-org" {
+			t.Errorf("Unexpected request: %s %s", r.Method, r.URL)
+		}
+		if auth := r.Header.Get("Authorization"); auth != "Token token" {
+			t.Errorf("Unexpected Authorization: %s", auth)
+		}
+		var body fluxRequest
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || !strings.HasPrefix(body.Query, "option v") {
+			t.Errorf("Unexpected body: %v (%v)", body, err)
+		}
+		http.ServeFile(w, r, "testdata/flux.csv")
+	}))
+	defer server.Close()
+
+	r := Retriever{URL: server.URL, Language: FLUX, Org: "my-org", Bucket: "telegraf", Token: "token"}
+	v := model.Variable{Name: "cpu", Metric: `|> filter(fn: (r) => r._measurement == "cpu")`,
+		Labels: &model.LabelMapping{Key: []string{"host", "_measurement"}}}
+	items := []monitor.RetrievalItem{{Var: v, From: to.Add(-time.Hour), To: to}}
+
+	values := r.Retrieve()(model.Agreement{}, items)[v]
+	if len(values) != 4 {
+		t.Fatalf("Unexpected values: %v", values)
+	}
+	expected := []struct {
+		key   string
+		value float64
+	}{{"node1", 97.5}, {"node2", 95.2}, {"mem", 12}, {"node1", 97}}
+	for i, e := range expected {
+		if values[i].Key != e.key || values[i].Value != e.value {
+			t.Errorf("Expected: %s=%f; Actual: %v", e.key, e.value, values[i])
+		}
+	}
+	if values[0].Labels.Get("_field") != "usage_idle" {
+		t.Errorf("Unexpected labels: %v", values[0].Labels)
+	}
+}
+
+func TestCredentialsNotSentToMonitoringURL(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if auth := r.Header.Get("Authorization"); auth != "" {
+			t.Errorf("Unexpected Authorization: %s", auth)
+		}
+		http.ServeFile(w, r, "testdata/influxql.json")
+	}))
+	defer server.Close()
+
+	r := Retriever{URL: "http://influxdb:8086", Token: "token"}
+	a := model.Agreement{Assessment: model.Assessment{MonitoringURL: server.URL}}
+	v := model.Variable{Name: "cpu", Metric: `SELECT "usage_idle" FROM "cpu"`}
+	items := []monitor.RetrievalItem{{Var: v, To: to}}
+	if values := r.Retrieve()(a, items)[v]; len(values) != 3 {
+		t.Errorf("Unexpected values: %v", values)
+	}
+}
+
+func TestParseFlux(t *testing.T) {
+	f, err := os.Open("testdata/flux.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	series, err := parseFlux(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(series) != 3 {
+		t.Fatalf("Unexpected series: %v", series)
+	}
+	if len(series[0].points) != 2 || series[2].labels[MeasurementLabel] != "mem" {
+		t.Errorf("Unexpected series: %v", series)
+	}
+}
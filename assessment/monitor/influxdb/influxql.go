@@ -0,0 +1,209 @@
+/*
+Copyright 2020 Atos
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package influxdb
+
+/*
+Example of InfluxQL query:
+curl 'localhost:8086/query?db=telegraf&epoch=ms&q=SELECT+mean(usage_idle)+FROM+cpu+WHERE+time+>+now()-1h+GROUP+BY+time(10m),host'
+
+Example of output:
+
+	{
+		"results": [
+			{
+				"statement_id": 0,
+				"series": [
+					{
+						"name": "cpu",
+						"tags": { "host": "node1" },
+						"columns": [ "time", "mean" ],
+						"values": [
+							[ 1572339600000, 97.5 ],
+							[ 1572340200000, null ]
+						]
+					}
+				]
+			}
+		]
+	}
+*/
+
+import (
+	"SLALite/assessment/monitor"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	timeFilterPlaceholder = "$timeFilter"
+	intervalPlaceholder   = "$interval"
+)
+
+type influxQLResponse struct {
+	Results []influxQLResult `json:"results"`
+	Error   string           `json:"error"`
+}
+
+type influxQLResult struct {
+	Series []influxQLSerie `json:"series"`
+	Error  string          `json:"error"`
+}
+
+type influxQLSerie struct {
+	Name    string            `json:"name"`
+	Tags    map[string]string `json:"tags"`
+	Columns []string          `json:"columns"`
+	Values  [][]interface{}   `json:"values"`
+}
+
+// influxQLQuery returns the InfluxQL query of the metric of an item, restricted to its window
+func influxQLQuery(item monitor.RetrievalItem) string {
+	from, to := bounds(item)
+	filter := fmt.Sprintf("time > '%s' AND time <= '%s'", formatTime(from), formatTime(to))
+
+	q := strings.Replace(item.Var.Metric, intervalPlaceholder, formatDuration(window(item)), -1)
+	if strings.Contains(q, timeFilterPlaceholder) {
+		return strings.Replace(q, timeFilterPlaceholder, filter, -1)
+	}
+	return addCondition(q, filter)
+}
+
+// addCondition adds cond to the WHERE clause of a SELECT statement
+func addCondition(q string, cond string) string {
+	upper := strings.ToUpper(q)
+	end := len(q)
+	for _, clause := range []string{" GROUP BY ", " ORDER BY ", " LIMIT ", " SLIMIT ", " FILL(", " TZ("} {
+		if i := strings.Index(upper, clause); i >= 0 && i < end {
+			end = i
+		}
+	}
+	if i := strings.Index(upper[:end], " WHERE "); i >= 0 {
+		return fmt.Sprintf("%s WHERE %s AND (%s)%s", q[:i], cond, strings.TrimSpace(q[i+len(" WHERE "):end]), q[end:])
+	}
+	return fmt.Sprintf("%s WHERE %s%s", q[:end], cond, q[end:])
+}
+
+// queryInfluxQL performs an InfluxQL query, returning the series in the result
+func (r Retriever) queryInfluxQL(rootURL string, q string) ([]serie, error) {
+	params := url.Values{}
+	params.Set("q", q)
+	params.Set("epoch", "ms")
+	if r.Database != "" {
+		params.Set("db", r.Database)
+	}
+	if r.RetentionPolicy != "" {
+		params.Set("rp", r.RetentionPolicy)
+	}
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/query?%s", rootURL, params.Encode()), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := r.do(req, rootURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var response influxQLResponse
+	decoder := json.NewDecoder(resp.Body)
+	decoder.UseNumber()
+	if err := decoder.Decode(&response); err != nil {
+		return nil, fmt.Errorf("%s. Error decoding InfluxDB output: %s", resp.Status, err.Error())
+	}
+	if response.Error != "" {
+		return nil, fmt.Errorf("%s: %s", resp.Status, response.Error)
+	}
+	return translateInfluxQL(response)
+}
+
+// translateInfluxQL returns the series of an InfluxQL response.
+//
+// The value of the points is the first column that is not the time.
+// Null values are skipped.
+func translateInfluxQL(response influxQLResponse) ([]serie, error) {
+	result := make([]serie, 0)
+	for _, res := range response.Results {
+		if res.Error != "" {
+			return result, fmt.Errorf("%s", res.Error)
+		}
+		for _, s := range res.Series {
+			timeIdx, valueIdx := -1, -1
+			for i, c := range s.Columns {
+				if c == "time" {
+					timeIdx = i
+				} else if valueIdx < 0 {
+					valueIdx = i
+				}
+			}
+			if timeIdx < 0 || valueIdx < 0 {
+				return result, fmt.Errorf("serie %s without time or value columns: %v", s.Name, s.Columns)
+			}
+			labels := map[string]string{MeasurementLabel: s.Name}
+			for k, v := range s.Tags {
+				labels[k] = v
+			}
+			aux := serie{labels: labels}
+			for _, row := range s.Values {
+				if len(row) <= timeIdx || len(row) <= valueIdx {
+					continue
+				}
+				ms, ok := toFloat(row[timeIdx])
+				value, okValue := toFloat(row[valueIdx])
+				if !ok || !okValue {
+					continue
+				}
+				aux.points = append(aux.points, point{t: time.Unix(0, int64(ms)*int64(time.Millisecond)), value: value})
+			}
+			result = append(result, aux)
+		}
+	}
+	return result, nil
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch x := v.(type) {
+	case json.Number:
+		f, err := x.Float64()
+		return f, err == nil
+	case float64:
+		return x, true
+	case bool:
+		if x {
+			return 1, true
+		}
+		return 0, true
+	default:
+		return 0, false
+	}
+}
+
+// bounds returns the window of an item. If the start is not set, the window
+// ends at To and lasts the aggregation window (or a minute).
+func bounds(item monitor.RetrievalItem) (time.Time, time.Time) {
+	if item.From.IsZero() {
+		return item.To.Add(-window(item)), item.To
+	}
+	return item.From, item.To
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
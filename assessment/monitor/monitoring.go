@@ -38,6 +38,13 @@ type MonitoringAdapter interface {
 	GetValues(gt model.Guarantee, vars []string, to time.Time) assessment_model.GuaranteeData
 }
 
+// CheckedAdapter is implemented by adapters that report the errors getting the
+// values of a guarantee term, so that they are recorded in its assessment
+type CheckedAdapter interface {
+	// GetCheckedValues is GetValues, returning an error if the values cannot be obtained
+	GetCheckedValues(gt model.Guarantee, vars []string, to time.Time) (assessment_model.GuaranteeData, error)
+}
+
 // RetrievalItem contains the retrieval information for a variable
 //
 // Used in EarlyRetriever interface
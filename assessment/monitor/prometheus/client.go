@@ -0,0 +1,271 @@
+/*
+Copyright 2020 Atos
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package prometheus
+
+/*
+This file contains the HTTP clients used to access Prometheus servers that
+require authentication (bearer token, basic auth, client certificates), custom
+CAs or additional headers (e.g. X-Scope-OrgID of Cortex, Thanos or Mimir).
+
+The settings of the Prometheus URL of the adapter are read from the
+prometheus* properties. The settings of other URLs, set in the MonitoringURL
+of agreements, are read from the list in prometheusEndpoints:
+
+	prometheusEndpoints:
+	  - url: https://mimir.example.com/prometheus
+	    bearerTokenFile: /run/secrets/mimir-token
+	    headers:
+	      X-Scope-OrgID: team-a
+
+The credentials of the adapter are never sent to URLs not configured.
+*/
+
+import (
+	"SLALite/utils"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+const (
+	// BearerTokenPropertyName is the config property name of the bearer token sent to Prometheus.
+	// It can be read from a file (see utils.GetSecret)
+	BearerTokenPropertyName = "prometheusBearerToken"
+	// UsernamePropertyName is the config property name of the basic auth user
+	UsernamePropertyName = "prometheusUsername"
+	// PasswordPropertyName is the config property name of the basic auth password.
+	// It can be read from a file (see utils.GetSecret)
+	PasswordPropertyName = "prometheusPassword"
+	// CAFilePropertyName is the config property name of the path of the CAs of Prometheus
+	CAFilePropertyName = "prometheusCAFile"
+	// CertFilePropertyName is the config property name of the path of the client certificate
+	CertFilePropertyName = "prometheusCertFile"
+	// KeyFilePropertyName is the config property name of the path of the client key
+	KeyFilePropertyName = "prometheusKeyFile"
+	// InsecurePropertyName is the config property name to skip the verification of the server certificate
+	InsecurePropertyName = "prometheusInsecure"
+	// HeadersPropertyName is the config property name of the headers added to the requests
+	HeadersPropertyName = "prometheusHeaders"
+	// TimeoutPropertyName is the config property name of the timeout of the requests
+	TimeoutPropertyName = "prometheusTimeout"
+	// EndpointsPropertyName is the config property name of the list of ClientConfig
+	// of the Prometheus URLs set in agreements
+	EndpointsPropertyName = "prometheusEndpoints"
+
+	// defaultTimeout is the value of the TimeoutPropertyName if it is not set in the config
+	defaultTimeout = "30s"
+)
+
+// ClientConfig contains the settings to access a Prometheus server
+type ClientConfig struct {
+	// URL is the root URL of the server. The settings apply to all the URLs starting with it.
+	URL             string            `mapstructure:"url"`
+	BearerToken     string            `mapstructure:"bearerToken"`
+	BearerTokenFile string            `mapstructure:"bearerTokenFile"`
+	Username        string            `mapstructure:"username"`
+	Password        string            `mapstructure:"password"`
+	PasswordFile    string            `mapstructure:"passwordFile"`
+	CAFile          string            `mapstructure:"caFile"`
+	CertFile        string            `mapstructure:"certFile"`
+	KeyFile         string            `mapstructure:"keyFile"`
+	Insecure        bool              `mapstructure:"insecure"`
+	Headers         map[string]string `mapstructure:"headers"`
+}
+
+// Client performs the requests to a Prometheus server, adding the credentials and headers.
+//
+// A nil Client performs plain requests with the http.DefaultClient.
+type Client struct {
+	HTTP        *http.Client
+	BearerToken string
+	Username    string
+	Password    string
+	Headers     map[string]string
+}
+
+// NewClient returns a Client with the settings in cfg
+func NewClient(cfg ClientConfig, timeout time.Duration) (*Client, error) {
+	tlsConfig, err := utils.NewTLSConfig(cfg.CAFile, cfg.CertFile, cfg.KeyFile, cfg.Insecure)
+	if err != nil {
+		return nil, err
+	}
+	token, err := readIndirection(cfg.BearerToken, cfg.BearerTokenFile)
+	if err != nil {
+		return nil, err
+	}
+	password, err := readIndirection(cfg.Password, cfg.PasswordFile)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{
+		HTTP: &http.Client{
+			Timeout:   timeout,
+			Transport: &http.Transport{TLSClientConfig: tlsConfig, Proxy: http.ProxyFromEnvironment},
+		},
+		BearerToken: token,
+		Username:    cfg.Username,
+		Password:    password,
+		Headers:     cfg.Headers,
+	}, nil
+}
+
+func readIndirection(value string, path string) (string, error) {
+	if value != "" || path == "" {
+		return value, nil
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("Error reading %s: %s", path, err.Error())
+	}
+	return strings.TrimSpace(string(content)), nil
+}
+
+// Get performs a GET request to url
+func (c *Client) Get(url string) (*http.Response, error) {
+	if c == nil {
+		return http.Get(url)
+	}
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range c.Headers {
+		req.Header.Set(k, v)
+	}
+	if c.BearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.BearerToken)
+	} else if c.Username != "" {
+		req.SetBasicAuth(c.Username, c.Password)
+	}
+	return c.HTTP.Do(req)
+}
+
+// endpoint is a Client that applies to the URLs starting with url
+type endpoint struct {
+	url    string
+	client *Client
+}
+
+// Clients selects the Client to access a Prometheus URL
+type Clients struct {
+	endpoints []endpoint
+	fallback  *Client
+}
+
+/*
+NewClients returns the Clients with the settings in config: the Client of the
+Prometheus URL of the adapter and the Clients of the prometheusEndpoints.
+It returns an error if the Prometheus URL is not set.
+
+The URLs not configured are accessed without credentials.
+*/
+func NewClients(config *viper.Viper) (*Clients, error) {
+	config.SetDefault(TimeoutPropertyName, defaultTimeout)
+	timeout := config.GetDuration(TimeoutPropertyName)
+
+	rootURL, err := utils.RequireSecret(config, PrometheusURLPropertyName)
+	if err != nil {
+		return nil, err
+	}
+	token, err := utils.GetSecret(config, BearerTokenPropertyName)
+	if err != nil {
+		return nil, err
+	}
+	password, err := utils.GetSecret(config, PasswordPropertyName)
+	if err != nil {
+		return nil, err
+	}
+	cfgs := []ClientConfig{
+		{
+			URL:         rootURL,
+			BearerToken: token,
+			Username:    config.GetString(UsernamePropertyName),
+			Password:    password,
+			CAFile:      config.GetString(CAFilePropertyName),
+			CertFile:    config.GetString(CertFilePropertyName),
+			KeyFile:     config.GetString(KeyFilePropertyName),
+			Insecure:    config.GetBool(InsecurePropertyName),
+			Headers:     config.GetStringMapString(HeadersPropertyName),
+		},
+	}
+	var endpoints []ClientConfig
+	if err := config.UnmarshalKey(EndpointsPropertyName, &endpoints); err != nil {
+		return nil, fmt.Errorf("Error reading %s: %s", EndpointsPropertyName, err.Error())
+	}
+	cfgs = append(cfgs, endpoints...)
+
+	result := &Clients{}
+	for _, cfg := range cfgs {
+		if cfg.URL == "" {
+			return nil, fmt.Errorf("%s: url is mandatory", EndpointsPropertyName)
+		}
+		client, err := NewClient(cfg, timeout)
+		if err != nil {
+			return nil, fmt.Errorf("Error creating client of %s: %s", utils.MaskURL(cfg.URL), err.Error())
+		}
+		log.Infof("Prometheus client of %s: bearer token: %v; basic auth: %v; headers: %v",
+			utils.MaskURL(cfg.URL), client.BearerToken != "", client.Username != "", headerNames(client.Headers))
+		result.endpoints = append(result.endpoints, endpoint{url: cfg.URL, client: client})
+	}
+	result.fallback, _ = NewClient(ClientConfig{}, timeout)
+	return result, nil
+}
+
+// For returns the Client of rootURL: the one of the longest configured URL that
+// prefixes rootURL, or a Client without credentials if none.
+//
+// A nil Clients always returns a nil Client.
+func (cs *Clients) For(rootURL string) *Client {
+	if cs == nil {
+		return nil
+	}
+	var result *Client
+	length := -1
+	for _, e := range cs.endpoints {
+		if matchesURL(rootURL, e.url) && len(e.url) > length {
+			result = e.client
+			length = len(e.url)
+		}
+	}
+	if result == nil {
+		return cs.fallback
+	}
+	return result
+}
+
+// matchesURL returns if rootURL is prefix or a subpath of prefix
+func matchesURL(rootURL, prefix string) bool {
+	rootURL = strings.TrimSuffix(rootURL, "/")
+	prefix = strings.TrimSuffix(prefix, "/")
+	if !strings.HasPrefix(rootURL, prefix) {
+		return false
+	}
+	return len(rootURL) == len(prefix) || rootURL[len(prefix)] == '/'
+}
+
+func headerNames(headers map[string]string) []string {
+	result := make([]string, 0, len(headers))
+	for k := range headers {
+		result = append(result, k)
+	}
+	return result
+}
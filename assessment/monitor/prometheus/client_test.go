@@ -0,0 +1,147 @@
+/*
+Copyright 2020 Atos
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package prometheus
+
+import (
+	"SLALite/assessment/monitor"
+	"SLALite/model"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func TestClientGet(t *testing.T) {
+	var header http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+		http.ServeFile(w, r, "testdata/vector.json")
+	}))
+	defer server.Close()
+
+	c, err := NewClient(ClientConfig{
+		BearerToken: "token",
+		Headers:     map[string]string{"X-Scope-OrgID": "tenant"},
+	}, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Get(server.URL); err != nil {
+		t.Fatal(err)
+	}
+	if actual := header.Get("Authorization"); actual != "Bearer token" {
+		t.Errorf("Unexpected Authorization header: %s", actual)
+	}
+	if actual := header.Get("X-Scope-OrgID"); actual != "tenant" {
+		t.Errorf("Unexpected X-Scope-OrgID header: %s", actual)
+	}
+
+	c, _ = NewClient(ClientConfig{Username: "user", PasswordFile: "testdata/password.txt"}, time.Second)
+	if _, err := c.Get(server.URL); err != nil {
+		t.Fatal(err)
+	}
+	if user, password, ok := (&http.Request{Header: header}).BasicAuth(); !ok || user != "user" || password != "secret" {
+		t.Errorf("Unexpected basic auth: %s/%s", user, password)
+	}
+
+	if _, err := NewClient(ClientConfig{CertFile: "testdata/notexists.pem"}, time.Second); err == nil {
+		t.Errorf("Expected error with not existing client certificate")
+	}
+}
+
+func TestClients(t *testing.T) {
+	config := viper.New()
+	config.Set(PrometheusURLPropertyName, "http://prometheus:9090")
+	config.Set(BearerTokenPropertyName, "token")
+	config.Set(EndpointsPropertyName, []map[string]interface{}{
+		{"url": "http://mimir/prometheus", "headers": map[string]string{"X-Scope-OrgID": "a"}},
+		{"url": "http://mimir/prometheus/b", "headers": map[string]string{"X-Scope-OrgID": "b"}},
+	})
+	cs, err := NewClients(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		url    string
+		token  string
+		tenant string
+	}{
+		{"http://prometheus:9090", "token", ""},
+		{"http://prometheus:9090/", "token", ""},
+		{"http://prometheus:90901", "", ""},
+		{"http://mimir/prometheus", "", "a"},
+		{"http://mimir/prometheus/b", "", "b"},
+		{"http://other:9090", "", ""},
+	} {
+		client := cs.For(c.url)
+		if client == nil {
+			t.Fatalf("Unexpected nil client for %s", c.url)
+		}
+		if client.BearerToken != c.token || client.Headers["X-Scope-OrgID"] != c.tenant {
+			t.Errorf("Unexpected client for %s: %v", c.url, client)
+		}
+	}
+
+	var nilClients *Clients
+	if nilClients.For("http://prometheus:9090") != nil {
+		t.Errorf("Expected nil client")
+	}
+
+	config.Set(EndpointsPropertyName, []map[string]interface{}{{"bearerToken": "t"}})
+	if _, err := NewClients(config); err == nil {
+		t.Errorf("Expected error in endpoint without url")
+	}
+
+	config.Set(EndpointsPropertyName, nil)
+	config.Set(PrometheusURLPropertyName, "")
+	if _, err := NewClients(config); err == nil {
+		t.Errorf("Expected error without Prometheus URL")
+	}
+}
+
+func TestRetrieveWithClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/tenant/") {
+			t.Errorf("Unexpected path: %s", r.URL.Path)
+		}
+		if r.Header.Get("X-Scope-OrgID") != "tenant" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		http.ServeFile(w, r, "testdata/vector.json")
+	}))
+	defer server.Close()
+
+	config := viper.New()
+	config.Set(PrometheusURLPropertyName, "http://localhost:9090")
+	config.Set(EndpointsPropertyName, []map[string]interface{}{
+		{"url": server.URL + "/tenant", "headers": map[string]string{"X-Scope-OrgID": "tenant"}},
+	})
+	r, err := New(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := model.Agreement{Assessment: model.Assessment{MonitoringURL: server.URL + "/tenant"}}
+	v := model.Variable{Name: "m", Metric: "m"}
+	result := r.Retrieve()(a, []monitor.RetrievalItem{{Var: v, To: time.Now()}})
+	if len(result[v]) == 0 {
+		t.Errorf("Expected values")
+	}
+}
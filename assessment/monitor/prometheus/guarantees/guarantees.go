@@ -18,9 +18,10 @@ limitations under the License.
 package guarantees
 
 import (
+	"SLALite/assessment/monitor/prometheus"
 	"encoding/json"
 	"fmt"
-	"net/http"
+	"net/url"
 	"strings"
 
 	"github.com/prometheus/common/log"
@@ -68,13 +69,22 @@ func CheckGuarantee(gname string, prometheusRootURL string, execID string, resou
  * Query single query to prometheus
  */
 func Query(m string, prometheusRootURL string) (QueryResp, error) {
-	url := fmt.Sprintf("%s/api/v1/query?query=%s", prometheusRootURL, m)
-	return request(url)
+	return QueryWithClient(nil, m, prometheusRootURL)
+}
+
+/**
+ * QueryWithClient single query to prometheus, with the credentials and headers of client
+ */
+func QueryWithClient(client *prometheus.Client, m string, prometheusRootURL string) (QueryResp, error) {
+	params := url.Values{}
+	params.Set("query", m)
+	url := fmt.Sprintf("%s/api/v1/query?%s", prometheusRootURL, params.Encode())
+	return request(client, url)
 }
 
 // http request
-func request(url string) (QueryResp, error) {
-	resp, err := http.Get(url)
+func request(client *prometheus.Client, url string) (QueryResp, error) {
+	resp, err := client.Get(url)
 	if err != nil {
 		log.Error(err)
 		return QueryResp{}, err
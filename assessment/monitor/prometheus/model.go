@@ -42,14 +42,8 @@ type result struct {
 	Items  []value `json:"values"`
 }
 
-type metric struct {
-	Name string `json:"__name__"`
-	//Instance         string `json:"instance"`
-	ExportedInstance string `json:"exported_instance"`
-	Job              string `json:"job_id"`
-	Function         string `json:"function_name"`
-	Call             string `json:"call_id"`
-}
+// metric contains the labels of a serie, including the metric name in __name__
+type metric map[string]string
 
 type value struct {
 	Timestamp datetime
@@ -27,6 +27,11 @@ curl 'localhost:9090/api/v1/query?query=hmm_compute_dbdump_time&time=2019-11-14T
 Example of query range:
 curl 'localhost:9090/api/v1/query_range?query=hmm_compute_dbdump_time&start=2019-11-14T16:00:00Z&end=2019-11-14T17:00:00Z&step=15s'
 
+If the step of the Retriever is set, a range query is performed over the
+window [From, To] of each RetrievalItem, so that values between assessments
+are also evaluated. The window is aligned to the step, so that consecutive
+windows do not overlap.
+
 Example of vector output from Prometheus:
 
 	{
@@ -55,10 +60,13 @@ import (
 	"SLALite/assessment/monitor"
 	"SLALite/assessment/monitor/genericadapter"
 	"SLALite/model"
+	"SLALite/utils"
 	"encoding/json"
 	"fmt"
 	"io"
-	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
 	"time"
 
 	log "github.com/sirupsen/logrus"
@@ -69,19 +77,27 @@ const (
 	// Name is the unique identifier of this adapter/retriever
 	Name = "prometheus"
 
-	// PrometheusURLPropertyName is the config property name of the Prometheus URL
+	// PrometheusURLPropertyName is the config property name of the Prometheus URL.
+	// It is mandatory, and can be read from a file (see utils.GetSecret)
 	PrometheusURLPropertyName = "prometheusUrl"
 	// PrometheusPredictorPropertyName is the config property name of the Prometheus Predictor type
+	// applied to variables that do not set a prediction
 	PrometheusPredictorPropertyName = "prometheusPredictor"
-	// HWSmoothingFactorPropertyName is the config property name of the Holt-Winters Smoothing Factor
+	// HWSmoothingFactorPropertyName is the config property name of the default Holt-Winters Smoothing Factor
 	HWSmoothingFactorPropertyName = "HWSmoothingFactor"
-	// HWTrendFactorPropertyName is the config property name of the Holt-Winters Trend Factor
+	// HWTrendFactorPropertyName is the config property name of the default Holt-Winters Trend Factor
 	HWTrendFactorPropertyName = "HWTrendFactor"
-	// PLScalarPropertyName is the config property name of the Prediction Linear Scalar
+	// PLScalarPropertyName is the config property name of the default Prediction Linear Scalar (in seconds)
 	PLScalarPropertyName = "PLScalar"
-
-	// defaultURL is the value of the Prometheus URL if PrometheusURLPropertyName is not set
-	defaultURL = "http://localhost:9090"
+	// KeyLabelsPropertyName is the config property name of the labels mapped to the
+	// key of metric values (see model.LabelMapping)
+	KeyLabelsPropertyName = "prometheusKeyLabels"
+	// ResourceLabelsPropertyName is the config property name of the labels mapped to the
+	// resource of metric values (see model.LabelMapping)
+	ResourceLabelsPropertyName = "prometheusResourceLabels"
+	// PrometheusStepPropertyName is the config property name of the step of range queries.
+	// If zero, instant queries are performed.
+	PrometheusStepPropertyName = "prometheusStep"
 
 	// defaultPredictor is the value of the Prometheus Predictor if PrometheusPredictorPropertyName is not set in the config
 	defaultPredictor = ""
@@ -91,49 +107,109 @@ const (
 	defaultHWTrendFactor = 0.5
 	// defaultScalar is the value of the PredictLinearScalarPropertyName if it is not set in the config
 	defaultPLScalar = 30
+	// defaultStep is the value of the PrometheusStepPropertyName if it is not set in the config
+	defaultStep = "15s"
+
+	// maxPoints is the maximum number of points per serie in a range query accepted by Prometheus
+	maxPoints = 11000
 
 	vectorType resultType = "vector"
 	matrixType resultType = "matrix"
 )
 
-var predictor = defaultPredictor
-var hwSmoothingFactor = defaultHWSmoothingFactor
-var hwTrendFactor = defaultHWTrendFactor
-var plScalar = defaultPLScalar
+// defaultLabels is the label mapping of Lithops metrics, used if the Retriever does not set one
+var defaultLabels = model.LabelMapping{
+	Key:      []string{"call_id", "job_id+exported_instance"},
+	Resource: []string{"function_name"},
+}
 
 // Retriever implements genericadapter.Retrieve
 type Retriever struct {
 	URL string
+	// Step is the resolution of range queries. Instant queries are performed if zero.
+	Step time.Duration
+	// Labels is the mapping of labels to MetricValues, if not set in the variable
+	Labels model.LabelMapping
+	// Predict is the prediction of variables that do not set one. Real values are used if nil.
+	Predict *model.Prediction
+	// Clients are the HTTP clients of the Prometheus URLs. Plain requests are performed if nil.
+	Clients *Clients
+	// Aggregation is where the variables that do not set a processor are aggregated.
+	// If MONITORING, the aggregation is pushed down to the PromQL expression.
+	Aggregation model.AggregationProcessor
 }
 
 // New constructs a Prometheus adapter from a Viper configuration
-func New(config *viper.Viper) Retriever {
+func New(config *viper.Viper) (Retriever, error) {
 
-	config.SetDefault(PrometheusURLPropertyName, defaultURL)
 	config.SetDefault(PrometheusPredictorPropertyName, defaultPredictor)
 	config.SetDefault(HWSmoothingFactorPropertyName, defaultHWSmoothingFactor)
 	config.SetDefault(HWTrendFactorPropertyName, defaultHWTrendFactor)
 	config.SetDefault(PLScalarPropertyName, defaultPLScalar)
+	config.SetDefault(PrometheusStepPropertyName, defaultStep)
+	config.SetDefault(KeyLabelsPropertyName, defaultLabels.Key)
+	config.SetDefault(ResourceLabelsPropertyName, defaultLabels.Resource)
+
+	rootURL, err := utils.RequireSecret(config, PrometheusURLPropertyName)
+	if err != nil {
+		return Retriever{}, err
+	}
+	logConfig(config, rootURL)
 
-	predictor = config.GetString(PrometheusPredictorPropertyName)
-	hwSmoothingFactor = config.GetFloat64(HWSmoothingFactorPropertyName)
-	hwTrendFactor = config.GetFloat64(HWTrendFactorPropertyName)
-	plScalar = config.GetInt(PLScalarPropertyName)
-	logConfig(config)
+	clients, err := NewClients(config)
+	if err != nil {
+		return Retriever{}, err
+	}
 
 	return Retriever{
-		config.GetString(PrometheusURLPropertyName),
+		URL:  rootURL,
+		Step: config.GetDuration(PrometheusStepPropertyName),
+		Labels: model.LabelMapping{
+			Key:      config.GetStringSlice(KeyLabelsPropertyName),
+			Resource: config.GetStringSlice(ResourceLabelsPropertyName),
+		},
+		Predict:     defaultPrediction(config),
+		Clients:     clients,
+		Aggregation: model.AggregationProcessor(config.GetString(utils.AggregationPropertyName)),
+	}, nil
+}
+
+// defaultPrediction returns the prediction set in config, or nil if not set
+func defaultPrediction(config *viper.Viper) *model.Prediction {
+	switch predictor := model.PredictionType(config.GetString(PrometheusPredictorPropertyName)); predictor {
+	case model.HOLTWINTERS:
+		return &model.Prediction{
+			Type:            predictor,
+			SmoothingFactor: config.GetFloat64(HWSmoothingFactorPropertyName),
+			TrendFactor:     config.GetFloat64(HWTrendFactorPropertyName),
+		}
+	case model.PREDICTLINEAR:
+		return &model.Prediction{
+			Type:    predictor,
+			Horizon: fmt.Sprintf("%ds", config.GetInt(PLScalarPropertyName)),
+		}
+	default:
+		return nil
 	}
 }
 
-func logConfig(config *viper.Viper) {
+func logConfig(config *viper.Viper, rootURL string) {
 	log.Infof("Prometheus configuration:\n"+
-		"\tURL: %s", config.GetString(PrometheusURLPropertyName))
-	switch predictor {
-	case "holt_winters":
-		log.Infof("Predictor: %s\n\tSmoothing Factor: %f\n\tTrend Factor: %f\n", predictor, hwSmoothingFactor, hwTrendFactor)
-	case "predict_linear":
-		log.Infof("Predictor: %s\n\tScalar: %d\n", predictor, plScalar)
+		"\tURL: %s\n"+
+		"\tStep: %v\n"+
+		"\tKey labels: %v\n"+
+		"\tResource labels: %v",
+		utils.MaskURL(rootURL),
+		config.GetDuration(PrometheusStepPropertyName),
+		config.GetStringSlice(KeyLabelsPropertyName),
+		config.GetStringSlice(ResourceLabelsPropertyName))
+	predictor := config.GetString(PrometheusPredictorPropertyName)
+	switch model.PredictionType(predictor) {
+	case model.HOLTWINTERS:
+		log.Infof("Predictor: %s\n\tSmoothing Factor: %f\n\tTrend Factor: %f\n", predictor,
+			config.GetFloat64(HWSmoothingFactorPropertyName), config.GetFloat64(HWTrendFactorPropertyName))
+	case model.PREDICTLINEAR:
+		log.Infof("Predictor: %s\n\tScalar: %d\n", predictor, config.GetInt(PLScalarPropertyName))
 	default:
 		log.Infof("Real metrics\n")
 	}
@@ -146,30 +222,187 @@ func (r Retriever) Retrieve() genericadapter.Retrieve {
 		items []monitor.RetrievalItem) map[model.Variable][]model.MetricValue {
 
 		rootURL := r.prometheusRoot(agreement)
+		client := r.Clients.For(rootURL)
 		result := make(map[model.Variable][]model.MetricValue)
 		for _, item := range items {
-			url := fmt.Sprintf("%s/api/v1/query?query=%s&time=%s",
-				rootURL, item.Var.Metric, item.To.Format(time.RFC3339))
-			switch predictor {
-			case "holt_winters":
-				url = fmt.Sprintf("%s/api/v1/query?query=holt_winters(%s,%f,%f)",
-					rootURL, item.Var.Metric, hwSmoothingFactor, hwTrendFactor)
-			case "predict_linear":
-				url = fmt.Sprintf("%s/api/v1/query?query=predict_linear(%s,%d)",
-					rootURL, item.Var.Metric, plScalar)
-			default:
-				url = fmt.Sprintf("%s/api/v1/query?query=%s",
-					rootURL, item.Var.Metric)
-			}
-
-			query := r.request(url)
-			aux := translateVector(query, item.Var.Name)
+			expr := r.expression(item.Var)
+			query := r.request(client, r.queryURL(rootURL, expr, r.from(item), item.To))
+			aux := translate(query, r.labelMapping(item.Var))
 			result[item.Var] = aux
 		}
 		return result
 	}
 }
 
+/*
+queryURL returns the URL of a range query of expr on the window (from, to].
+
+The start of the range query is the first multiple of the step after from,
+so that the points evaluated in consecutive windows do not overlap, and the
+number of points is limited to maxPoints.
+
+An instant query at to is returned if the step is zero, from is not set or
+there are no multiples of step in the window.
+*/
+func (r Retriever) queryURL(rootURL string, expr string, from, to time.Time) string {
+	step := r.Step
+	if step <= 0 || from.IsZero() {
+		return instantQueryURL(rootURL, expr, to)
+	}
+	start := from.Truncate(step).Add(step)
+	if min := to.Add(-step * (maxPoints - 1)); start.Before(min) {
+		start = min.Truncate(step)
+		if start.Before(min) {
+			start = start.Add(step)
+		}
+	}
+	if start.After(to) {
+		return instantQueryURL(rootURL, expr, to)
+	}
+	params := url.Values{}
+	params.Set("query", expr)
+	params.Set("start", formatTime(start))
+	params.Set("end", formatTime(to))
+	params.Set("step", strconv.FormatFloat(step.Seconds(), 'f', -1, 64))
+	return fmt.Sprintf("%s/api/v1/query_range?%s", rootURL, params.Encode())
+}
+
+/*
+from returns the start of the query window of a retrieval item.
+
+If the aggregation of the variable is pushed down, each point returned is already
+aggregated: an instant query is performed for a tumbling window, and the values
+since the last evaluation (i.e., one window after From) for a sliding window.
+*/
+func (r Retriever) from(item monitor.RetrievalItem) time.Time {
+	if !r.pushedDown(item.Var) {
+		return item.From
+	}
+	if item.Var.Aggregation.WindowType == model.SLIDING {
+		return item.From.Add(time.Duration(item.Var.Aggregation.Window) * time.Second)
+	}
+	return time.Time{}
+}
+
+func instantQueryURL(rootURL string, expr string, t time.Time) string {
+	params := url.Values{}
+	params.Set("query", expr)
+	params.Set("time", formatTime(t))
+	return fmt.Sprintf("%s/api/v1/query?%s", rootURL, params.Encode())
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+/*
+expression returns the PromQL expression to query the values of a variable.
+
+The metric of the variable may be URL encoded (see DecodeQuery).
+If the variable has a prediction (or the Retriever has a default one), the metric
+is wrapped in the corresponding prediction function. If the aggregation of the
+variable is pushed down, the result is wrapped in the aggregation function over a
+subquery of the window (e.g. avg_over_time((m)[60s:15s])).
+*/
+func (r Retriever) expression(v model.Variable) string {
+	metric, err := DecodeQuery(v.Metric)
+	if err != nil {
+		log.Warnf("Error decoding metric '%s' of variable %s: %s", v.Metric, v.Name, err.Error())
+		metric = v.Metric
+	}
+	expr := r.prediction(v, metric)
+	if r.pushedDown(v) {
+		expr = r.aggregation(v.Aggregation, expr)
+	}
+	return expr
+}
+
+// pushedDown returns if the aggregation of a variable is performed by Prometheus
+func (r Retriever) pushedDown(v model.Variable) bool {
+	if genericadapter.ProcessorOf(v, r.Aggregation) != model.MONITORING {
+		return false
+	}
+	if v.Aggregation.Window <= 0 {
+		log.Warnf("Aggregation of variable %s cannot be pushed down without window", v.Name)
+		return false
+	}
+	return true
+}
+
+// aggregation returns expr wrapped in the PromQL function of the aggregation
+func (r Retriever) aggregation(a *model.Aggregation, expr string) string {
+	subquery := fmt.Sprintf("(%s)[%ds:", expr, a.Window)
+	if r.Step > 0 {
+		subquery += strconv.FormatFloat(r.Step.Seconds(), 'f', -1, 64) + "s"
+	}
+	subquery += "]"
+
+	switch a.Type {
+	case model.AVERAGE:
+		return fmt.Sprintf("avg_over_time(%s)", subquery)
+	case model.SUM, model.MIN, model.MAX, model.COUNT, model.LAST:
+		return fmt.Sprintf("%s_over_time(%s)", a.Type, subquery)
+	case model.STDDEV:
+		return fmt.Sprintf("stddev_over_time(%s)", subquery)
+	case model.RATE:
+		return fmt.Sprintf("rate(%s)", subquery)
+	case model.P50:
+		return fmt.Sprintf("quantile_over_time(0.5,%s)", subquery)
+	case model.P95:
+		return fmt.Sprintf("quantile_over_time(0.95,%s)", subquery)
+	case model.P99:
+		return fmt.Sprintf("quantile_over_time(0.99,%s)", subquery)
+	default:
+		log.Warnf("Aggregation type '%s' cannot be pushed down", a.Type)
+		return expr
+	}
+}
+
+// prediction returns metric wrapped in the prediction function of a variable, if any
+func (r Retriever) prediction(v model.Variable, metric string) string {
+	p := v.Predict
+	if p == nil {
+		p = r.Predict
+	}
+	if p == nil {
+		return metric
+	}
+	ranged := metric
+	if p.Range != "" {
+		ranged = fmt.Sprintf("%s[%s]", metric, p.Range)
+	}
+	switch p.Type {
+	case model.HOLTWINTERS:
+		sf, tf := p.SmoothingFactor, p.TrendFactor
+		if sf == 0 {
+			sf = defaultHWSmoothingFactor
+		}
+		if tf == 0 {
+			tf = defaultHWTrendFactor
+		}
+		return fmt.Sprintf("holt_winters(%s,%f,%f)", ranged, sf, tf)
+	case model.PREDICTLINEAR:
+		horizon := time.Duration(defaultPLScalar) * time.Second
+		if p.Horizon != "" {
+			d, err := time.ParseDuration(p.Horizon)
+			if err != nil {
+				log.Warnf("Not valid horizon '%s' of variable %s; using %v", p.Horizon, v.Name, horizon)
+			} else {
+				horizon = d
+			}
+		}
+		return fmt.Sprintf("predict_linear(%s,%s)", ranged, strconv.FormatFloat(horizon.Seconds(), 'f', -1, 64))
+	default:
+		return metric
+	}
+}
+
+// labelMapping returns the label mapping of a variable, falling back to the one of
+// the retriever and the default one
+func (r Retriever) labelMapping(v model.Variable) model.LabelMapping {
+	return v.Labels.Merge(r.Labels.Merge(defaultLabels))
+}
+
 func (r Retriever) prometheusRoot(agreement model.Agreement) string {
 	if agreement.Assessment.MonitoringURL != "" {
 		return agreement.Assessment.MonitoringURL
@@ -177,9 +410,9 @@ func (r Retriever) prometheusRoot(agreement model.Agreement) string {
 	return r.URL
 }
 
-func (r Retriever) request(url string) query {
+func (r Retriever) request(client *Client, url string) query {
 
-	resp, err := http.Get(url)
+	resp, err := client.Get(url)
 	if err != nil {
 		log.Error(err)
 		return query{}
@@ -202,34 +435,49 @@ func parse(r io.Reader, target *query) error {
 	return json.NewDecoder(r).Decode(&target)
 }
 
-func translateVector(query query, key string) []model.MetricValue {
+// translate returns the values in a vector or matrix query result
+func translate(query query, mapping model.LabelMapping) []model.MetricValue {
+	if query.Data.ResultType == matrixType {
+		return translateMatrix(query, mapping)
+	}
+	return translateVector(query, mapping)
+}
+
+func translateVector(query query, mapping model.LabelMapping) []model.MetricValue {
 
 	res := make([]model.MetricValue, 0, len(query.Data.Results))
 	for _, item := range query.Data.Results {
-		metric := translateMetric(key, item)
+		metric := translateMetric(mapping, item, item.Item)
 		res = append(res, metric)
 	}
 	return res
 }
 
-// this function should be made project-dependent
-func translateMetric(key string, item result) model.MetricValue {
-	// key
-	k := item.Metric.Call
-	if len(k) == 0 {
-		k = fmt.Sprintf("%s%s", item.Metric.Job, item.Metric.ExportedInstance)
+// translateMatrix returns the values of all the series in the result, sorted by time
+func translateMatrix(query query, mapping model.LabelMapping) []model.MetricValue {
+
+	res := make([]model.MetricValue, 0, len(query.Data.Results))
+	for _, item := range query.Data.Results {
+		for _, v := range item.Items {
+			metric := translateMetric(mapping, item, v)
+			res = append(res, metric)
+		}
 	}
+	sort.SliceStable(res, func(i, j int) bool {
+		return res[i].DateTime.Before(res[j].DateTime)
+	})
+	return res
+}
 
-	// resource
-	r := item.Metric.Function
+// translateMetric returns a value of a serie, with key and resource mapped from the serie labels
+func translateMetric(mapping model.LabelMapping, item result, v value) model.MetricValue {
+	k, r := mapping.Map(item.Metric)
 
 	return model.MetricValue{
-		//Key: fmt.Sprintf("%s{%s %s}", key, item.Metric.ExportedInstance, item.Metric.ExecutorId),
-		//Key: fmt.Sprintf("%s%s", item.Metric.ExportedInstance, item.Metric.ExecutorId),
-		//Key:      item.Metric.ExportedJob, //fmt.Sprintf("%s", item.Metric.ExportedJob),
 		Key:      k,
-		Value:    item.Item.Value,
-		DateTime: time.Time(item.Item.Timestamp),
+		Value:    v.Value,
+		DateTime: time.Time(v.Timestamp),
 		Resource: r,
+		Labels:   model.NewLabels(item.Metric),
 	}
 }
@@ -17,7 +17,11 @@ limitations under the License.
 package prometheus
 
 import (
+	"SLALite/assessment/monitor"
 	"SLALite/model"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
 	"testing"
 	"time"
@@ -30,9 +34,26 @@ func TestNew(t *testing.T) {
 
 	config.SetEnvPrefix("sla") // Env vars start with 'SLA_'
 	config.AutomaticEnv()
-	config.Set(PrometheusURLPropertyName, defaultURL)
 
-	New(config)
+	if _, err := New(config); err == nil {
+		t.Error("Expected error without Prometheus URL")
+	}
+	config.Set(PrometheusURLPropertyName+"_file", "testdata/url.txt")
+	r, err := New(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.URL != "http://prometheus:9090" {
+		t.Errorf("Unexpected URL read from file: %s", r.URL)
+	}
+	config.Set(PrometheusURLPropertyName, "http://localhost:9090")
+	if _, err := New(config); err != nil {
+		t.Error(err)
+	}
+	config.Set(CAFilePropertyName, "testdata/notexists.pem")
+	if _, err := New(config); err == nil {
+		t.Error("Expected error with not existing CA file")
+	}
 }
 
 func TestParseVector(t *testing.T) {
@@ -51,7 +72,7 @@ func TestParseVector(t *testing.T) {
 
 	result := query.Data.Results[0]
 
-	if expected, actual := "go_memstats_frees_total", result.Metric.Name; expected != actual {
+	if expected, actual := "go_memstats_frees_total", result.Metric["__name__"]; expected != actual {
 		t.Fatalf("Expected: %s; Actual: %s", expected, actual)
 	}
 
@@ -94,7 +115,7 @@ func TestParseMatrix(t *testing.T) {
 
 	result := query.Data.Results[0]
 
-	if expected, actual := "prometheus_http_response_size_bytes_count", result.Metric.Name; expected != actual {
+	if expected, actual := "prometheus_http_response_size_bytes_count", result.Metric["__name__"]; expected != actual {
 		t.Fatalf("Expected: %s; Actual: %s", expected, actual)
 	}
 
@@ -111,6 +132,200 @@ func TestParseMatrix(t *testing.T) {
 	}
 }
 
+func TestTranslateMatrix(t *testing.T) {
+	query, err := readFile("testdata/matrix.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := translate(query, defaultLabels)
+	if expected, actual := 4, len(values); actual != expected {
+		t.Fatalf("Expected: %d; Actual: %d", expected, actual)
+	}
+	for i := 1; i < len(values); i++ {
+		if values[i].DateTime.Before(values[i-1].DateTime) {
+			t.Errorf("Values not sorted by time: %v", values)
+		}
+	}
+	if expected, actual := float64(4), values[2].Value; actual != expected {
+		t.Errorf("Expected: %v; Actual: %v", expected, actual)
+	}
+}
+
+func TestLabelMapping(t *testing.T) {
+	query, err := readFile("testdata/vector2.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := Retriever{
+		Labels: model.LabelMapping{Key: []string{"handler"}},
+	}
+	v := model.Variable{Name: "m", Metric: "m"}
+	values := translate(query, r.labelMapping(v))
+	if expected, actual := "/api/v1/query", values[1].Key; actual != expected {
+		t.Errorf("Expected: %s; Actual: %s", expected, actual)
+	}
+	if expected, actual := "localhost:9090", values[1].Labels.Get("instance"); actual != expected {
+		t.Errorf("Expected: %s; Actual: %s", expected, actual)
+	}
+
+	v.Labels = &model.LabelMapping{Key: []string{"job+instance"}, Resource: []string{"handler"}}
+	values = translate(query, r.labelMapping(v))
+	if values[1].Key != "prometheuslocalhost:9090" || values[1].Resource != "/api/v1/query" {
+		t.Errorf("Unexpected key/resource: %s/%s", values[1].Key, values[1].Resource)
+	}
+
+	// default lithops mapping
+	values = translate(query, Retriever{}.labelMapping(model.Variable{}))
+	if values[1].Key != "" || values[1].Resource != "" {
+		t.Errorf("Unexpected key/resource: %s/%s", values[1].Key, values[1].Resource)
+	}
+}
+
+func TestExpression(t *testing.T) {
+	r := Retriever{}
+	real := model.Variable{Name: "r", Metric: "m"}
+	linear := model.Variable{Name: "l", Metric: "m",
+		Predict: &model.Prediction{Type: model.PREDICTLINEAR, Range: "5m", Horizon: "1m"}}
+	hw := model.Variable{Name: "h", Metric: "m[10m]",
+		Predict: &model.Prediction{Type: model.HOLTWINTERS, TrendFactor: 0.1}}
+	none := model.Variable{Name: "n", Metric: "m",
+		Predict: &model.Prediction{Type: model.NOPREDICTION}}
+
+	for _, c := range []struct {
+		v        model.Variable
+		expected string
+	}{
+		{real, "m"},
+		{linear, "predict_linear(m[5m],60)"},
+		{hw, "holt_winters(m[10m],0.500000,0.100000)"},
+		{none, "m"},
+		{model.Variable{Name: "e", Metric: "urlencoded:sum(m)%20by%20(job)"}, "sum(m) by (job)"},
+		{model.Variable{Name: "l", Metric: "sum(m)%20by%20(job)"}, "sum(m) by (job)"},
+	} {
+		if actual := r.expression(c.v); actual != c.expected {
+			t.Errorf("Expected: %s; Actual: %s", c.expected, actual)
+		}
+	}
+
+	// default prediction of the retriever
+	config := viper.New()
+	config.Set(PrometheusURLPropertyName, "http://localhost:9090")
+	config.Set(PrometheusPredictorPropertyName, "predict_linear")
+	r, _ = New(config)
+	if expected, actual := "predict_linear(m,30)", r.expression(real); actual != expected {
+		t.Errorf("Expected: %s; Actual: %s", expected, actual)
+	}
+	if expected, actual := "m", r.expression(none); actual != expected {
+		t.Errorf("Expected: %s; Actual: %s", expected, actual)
+	}
+}
+
+func TestAggregationPushDown(t *testing.T) {
+	r := Retriever{Step: 15 * time.Second, Aggregation: model.MONITORING}
+	p95 := model.Variable{Name: "p", Metric: "m",
+		Aggregation: &model.Aggregation{Type: model.P95, Window: 300}}
+	rate := model.Variable{Name: "r", Metric: "m",
+		Aggregation: &model.Aggregation{Type: model.RATE, Window: 60, WindowType: model.SLIDING}}
+	local := model.Variable{Name: "l", Metric: "m",
+		Aggregation: &model.Aggregation{Type: model.MAX, Window: 60, Processor: model.LOCAL}}
+	predicted := model.Variable{Name: "h", Metric: "m",
+		Aggregation: &model.Aggregation{Type: model.AVERAGE, Window: 60},
+		Predict:     &model.Prediction{Type: model.PREDICTLINEAR, Range: "5m"}}
+
+	for _, c := range []struct {
+		v        model.Variable
+		expected string
+	}{
+		{p95, "quantile_over_time(0.95,(m)[300s:15s])"},
+		{rate, "rate((m)[60s:15s])"},
+		{local, "m"},
+		{predicted, "avg_over_time((predict_linear(m[5m],30))[60s:15s])"},
+	} {
+		if actual := r.expression(c.v); actual != c.expected {
+			t.Errorf("Expected: %s; Actual: %s", c.expected, actual)
+		}
+	}
+
+	to := time.Date(2019, 10, 29, 12, 5, 0, 0, time.UTC)
+	if from := r.from(monitor.RetrievalItem{Var: p95, From: to.Add(-5 * time.Minute), To: to}); !from.IsZero() {
+		t.Errorf("Expected instant query of tumbling window; from: %v", from)
+	}
+	if from := r.from(monitor.RetrievalItem{Var: rate, From: to.Add(-2 * time.Minute), To: to}); !from.Equal(to.Add(-time.Minute)) {
+		t.Errorf("Unexpected from of sliding window: %v", from)
+	}
+	if from := r.from(monitor.RetrievalItem{Var: local, From: to.Add(-time.Minute), To: to}); !from.Equal(to.Add(-time.Minute)) {
+		t.Errorf("Unexpected from of local aggregation: %v", from)
+	}
+}
+
+func TestQueryURL(t *testing.T) {
+	to := time.Date(2019, 10, 29, 12, 5, 0, 0, time.UTC)
+	from := to.Add(-time.Minute)
+	r := Retriever{URL: "http://localhost:9090", Step: 15 * time.Second}
+
+	check := func(rawurl string, path string, expected map[string]string) {
+		u, err := url.Parse(rawurl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if u.Path != path {
+			t.Errorf("Expected: %s; Actual: %s", path, u.Path)
+		}
+		for k, v := range expected {
+			if actual := u.Query().Get(k); actual != v {
+				t.Errorf("Expected %s=%s; Actual: %s", k, v, actual)
+			}
+		}
+	}
+	// plain PromQL is encoded
+	check(r.queryURL(r.URL, "sum(m{job=\"a\"}) by (job)+1", from, to), "/api/v1/query_range", map[string]string{
+		"query": "sum(m{job=\"a\"}) by (job)+1",
+	})
+	check(r.queryURL(r.URL, "m", from.Add(time.Second), to), "/api/v1/query_range", map[string]string{
+		"query": "m",
+		"start": "2019-10-29T12:04:15Z",
+		"end":   "2019-10-29T12:05:00Z",
+		"step":  "15",
+	})
+	// window aligned to step: first point excluded
+	check(r.queryURL(r.URL, "m", from, to), "/api/v1/query_range", map[string]string{
+		"start": "2019-10-29T12:04:15Z",
+	})
+	// window shorter than step
+	check(r.queryURL(r.URL, "m", to.Add(time.Second), to.Add(5*time.Second)), "/api/v1/query", map[string]string{
+		"time": "2019-10-29T12:05:05Z",
+	})
+	// too many points
+	check(r.queryURL(r.URL, "m", to.Add(-24*time.Hour*30), to), "/api/v1/query_range", map[string]string{
+		"start": formatTime(to.Add(-15 * time.Second * (maxPoints - 1))),
+	})
+
+	r.Step = 0
+	check(r.queryURL(r.URL, "m", from, to), "/api/v1/query", map[string]string{
+		"time": "2019-10-29T12:05:00Z",
+	})
+}
+
+func TestRetrieveRange(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/query_range" {
+			t.Errorf("Unexpected path: %s", r.URL.Path)
+		}
+		http.ServeFile(w, r, "testdata/matrix.json")
+	}))
+	defer server.Close()
+
+	r := Retriever{URL: server.URL, Step: time.Minute}
+	v := model.Variable{Name: "m", Metric: "prometheus_http_response_size_bytes_count"}
+	to := time.Unix(1572339660, 0)
+	items := []monitor.RetrievalItem{{Var: v, From: to.Add(-2 * time.Minute), To: to}}
+
+	result := r.Retrieve()(model.Agreement{}, items)
+	if expected, actual := 4, len(result[v]); actual != expected {
+		t.Errorf("Expected: %d; Actual: %d", expected, actual)
+	}
+}
+
 func TestPrometheusRoot(t *testing.T) {
 	a1 := model.Agreement{}
 	a2 := model.Agreement{
@@ -0,0 +1,257 @@
+/*
+Copyright 2020 Atos
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package prometheus
+
+import (
+	"SLALite/model"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// EncodedPrefix marks a metric as URL encoded (e.g. "urlencoded:sum(m)%20by%20(job)")
+const EncodedPrefix = "urlencoded:"
+
+var (
+	escapeRegexp   = regexp.MustCompile(`%[0-9A-Fa-f]{2}`)
+	durationRegexp = regexp.MustCompile(`^(\d+(ms|s|m|h|d|w|y))+$`)
+	// plainRegexp matches the characters that are escaped when URL encoding a query
+	plainRegexp = regexp.MustCompile(`[\s()\[\]{}+*/^=!<>,"']`)
+)
+
+// DecodeQuery returns the plain PromQL of a query.
+//
+// Metrics of agreements were URL encoded before the retriever encoded
+// the queries. These are decoded for backward compatibility if they
+// start with EncodedPrefix, or if they are fully encoded: they contain
+// escapes, but no spaces, brackets or operators, and decode to printable
+// characters.
+//
+// Metrics of previous versions were also partially encoded, escaping only
+// spaces and '+' (e.g. "sum(m)%20by%20(job)"). The escapes of space, '+'
+// and '%' out of string literals are decoded when they cannot be read as a
+// modulo by a number (see decodeLegacy). The rest of queries (e.g. "x%10",
+// "x%20") are returned as is.
+func DecodeQuery(q string) (string, error) {
+	if strings.HasPrefix(q, EncodedPrefix) {
+		return url.QueryUnescape(strings.TrimPrefix(q, EncodedPrefix))
+	}
+	if !escapeRegexp.MatchString(q) {
+		return q, nil
+	}
+	if plainRegexp.MatchString(q) {
+		return decodeLegacy(q), nil
+	}
+	decoded, err := url.PathUnescape(q)
+	if err != nil || strings.IndexFunc(decoded, func(r rune) bool { return !unicode.IsPrint(r) }) >= 0 {
+		return q, nil
+	}
+	return decoded, nil
+}
+
+// ValidateQuery performs a lightweight syntax check of a PromQL query:
+// brackets must be balanced, range and subquery selectors must contain
+// valid durations, and characters not used by PromQL are rejected.
+//
+// It does not replace the Prometheus parser; a query that passes the check
+// may still be rejected by Prometheus.
+func ValidateQuery(q string) error {
+	q, err := DecodeQuery(q)
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(q) == "" {
+		return errors.New("empty query")
+	}
+
+	closing := map[rune]rune{')': '(', ']': '[', '}': '{'}
+	var stack []rune
+	var rangeStart int
+
+	runes := []rune(q)
+	for i := 0; i < len(runes); i++ {
+		c := runes[i]
+		switch c {
+		case '"', '\'', '`':
+			end := skipString(runes, i)
+			if end < 0 {
+				return fmt.Errorf("unterminated string at position %d", i)
+			}
+			i = end
+		case '#':
+			for i < len(runes) && runes[i] != '\n' {
+				i++
+			}
+		case '(', '{':
+			stack = append(stack, c)
+		case '[':
+			stack = append(stack, c)
+			rangeStart = i + 1
+		case ')', ']', '}':
+			if len(stack) == 0 || stack[len(stack)-1] != closing[c] {
+				return fmt.Errorf("unexpected '%c' at position %d", c, i)
+			}
+			stack = stack[:len(stack)-1]
+			if c == ']' {
+				if err := checkRange(string(runes[rangeStart:i])); err != nil {
+					return err
+				}
+			}
+		case ';', '$', '&', '|', '?', '\\':
+			return fmt.Errorf("unexpected '%c' at position %d", c, i)
+		}
+	}
+	if len(stack) > 0 {
+		return fmt.Errorf("unclosed '%c'", stack[len(stack)-1])
+	}
+	return nil
+}
+
+// decodeLegacy decodes the escapes of space, '+' and '%' of a partially
+// encoded query, skipping string literals.
+func decodeLegacy(q string) string {
+	runes := []rune(q)
+	result := make([]rune, 0, len(runes))
+	for i := 0; i < len(runes); i++ {
+		c := runes[i]
+		switch {
+		case c == '"' || c == '\'' || c == '`':
+			end := skipString(runes, i)
+			if end < 0 {
+				return q
+			}
+			result = append(result, runes[i:end+1]...)
+			i = end
+		case c == '%' && isLegacyEscape(runes, i):
+			result = append(result, legacyEscapes[strings.ToUpper(string(runes[i+1:i+3]))])
+			i += 2
+		default:
+			result = append(result, c)
+		}
+	}
+	return string(result)
+}
+
+// legacyEscapes are the escapes decoded in partially encoded queries
+var legacyEscapes = map[string]rune{"20": ' ', "2B": '+', "25": '%'}
+
+// isLegacyEscape returns if the '%' at runes[i] starts an escape of
+// legacyEscapes that is not a modulo by a number: "%2B" is never a number,
+// while "%20" and "%25" are escapes if followed by what cannot continue
+// a number (e.g. "%20by").
+func isLegacyEscape(runes []rune, i int) bool {
+	if i+2 >= len(runes) {
+		return false
+	}
+	code := strings.ToUpper(string(runes[i+1 : i+3]))
+	if _, ok := legacyEscapes[code]; !ok {
+		return false
+	}
+	if code == "2B" {
+		return true
+	}
+	if i+3 >= len(runes) {
+		return false
+	}
+	next := runes[i+3]
+	switch {
+	case next == 'e' || next == 'E':
+		/* exponent of a number (e.g. "x%20e3") */
+		return i+4 < len(runes) && !unicode.IsDigit(runes[i+4]) && runes[i+4] != '+' && runes[i+4] != '-'
+	case unicode.IsLetter(next) || next == '_' || next == '(' || next == '{':
+		return true
+	case next == '%':
+		return isLegacyEscape(runes, i+3)
+	}
+	return false
+}
+
+// skipString returns the position of the quote that closes the string
+// starting at runes[start], or -1 if not closed
+func skipString(runes []rune, start int) int {
+	quote := runes[start]
+	for i := start + 1; i < len(runes); i++ {
+		switch runes[i] {
+		case '\\':
+			if quote != '`' {
+				i++
+			}
+		case quote:
+			return i
+		}
+	}
+	return -1
+}
+
+// checkRange checks the contents of a range selector ("5m") or a
+// subquery ("1h:5m", "1h:")
+func checkRange(s string) error {
+	parts := strings.SplitN(strings.TrimSpace(s), ":", 2)
+	if !durationRegexp.MatchString(strings.TrimSpace(parts[0])) {
+		return fmt.Errorf("invalid range '[%s]'", s)
+	}
+	if len(parts) == 2 {
+		step := strings.TrimSpace(parts[1])
+		if step != "" && !durationRegexp.MatchString(step) {
+			return fmt.Errorf("invalid subquery step '[%s]'", s)
+		}
+	}
+	return nil
+}
+
+// validator decorates a model.Validator, validating the PromQL of the variables
+// of templates and agreements
+type validator struct {
+	model.Validator
+}
+
+// NewValidator returns a model.Validator that also checks the syntax of the
+// metrics of agreements and templates (see ValidateQuery).
+func NewValidator(next model.Validator) model.Validator {
+	return validator{Validator: next}
+}
+
+// ValidateTemplate implements model.Validator.ValidateTemplate
+func (val validator) ValidateTemplate(t *model.Template, mode model.ValidationMode) []error {
+	result := val.Validator.ValidateTemplate(t, mode)
+	return checkVariables(&t.Details, result)
+}
+
+// ValidateAgreement implements model.Validator.ValidateAgreement
+func (val validator) ValidateAgreement(a *model.Agreement, mode model.ValidationMode) []error {
+	result := val.Validator.ValidateAgreement(a, mode)
+	return checkVariables(&a.Details, result)
+}
+
+func checkVariables(d *model.Details, result []error) []error {
+	for _, v := range d.Variables {
+		if v.Metric == "" {
+			continue
+		}
+		if strings.Contains(v.Metric, "{{") {
+			/* metric with template placeholders; checked when the agreement is created */
+			continue
+		}
+		if err := ValidateQuery(v.Metric); err != nil {
+			result = append(result, fmt.Errorf("Variable['%s'].Metric is not a valid PromQL query: %v", v.Name, err))
+		}
+	}
+	return result
+}
@@ -0,0 +1,152 @@
+/*
+Copyright 2020 Atos
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package prometheus
+
+import (
+	"SLALite/model"
+	"testing"
+)
+
+func TestDecodeQuery(t *testing.T) {
+	for _, c := range []struct {
+		q        string
+		expected string
+	}{
+		{"urlencoded:sum(m)%20by%20(job)", "sum(m) by (job)"},
+		{"urlencoded:(a%20unless%20on(id)b)%2Bon(job)c", "(a unless on(id)b)+on(job)c"},
+		{"sum%28m%29%20by%20%28job%29", "sum(m) by (job)"},
+		{"sum(m)%20by%20(job)", "sum(m) by (job)"},
+		{
+			"sum(job_total_calls)%20by%20(job_id,function_name)-count(function_start)%20by%20(job_id,function_name)",
+			"sum(job_total_calls) by (job_id,function_name)-count(function_start) by (job_id,function_name)",
+		},
+		{
+			"(function_start%20unless%20on(call_id)function_end)%2Bon(job_id)group_left()(1.3*avg(function_end-function_start)by(job_id))",
+			"(function_start unless on(call_id)function_end)+on(job_id)group_left()(1.3*avg(function_end-function_start)by(job_id))",
+		},
+		{
+			"100-(avg%20by%20(instance)(irate(node_cpu_seconds_total{job=\"node\",mode=\"idle\"}[5m]))*100)",
+			"100-(avg by (instance)(irate(node_cpu_seconds_total{job=\"node\",mode=\"idle\"}[5m]))*100)",
+		},
+		{"m{job=\"a%20b\"}%20or%20n", "m{job=\"a%20b\"} or n"},
+		{"sum(x%20)", "sum(x%20)"},
+		{"sum(x)%20e3", "sum(x)%20e3"},
+		{"sum(x)%25", "sum(x)%25"},
+		{"sum(m) by (job) + 1", "sum(m) by (job) + 1"},
+		{"a % 2", "a % 2"},
+		{"rate(x[5m]) % 10", "rate(x[5m]) % 10"},
+		{"a + b", "a + b"},
+		{"x%10", "x%10"},
+		{"a %2F b", "a %2F b"},
+	} {
+		actual, err := DecodeQuery(c.q)
+		if err != nil {
+			t.Errorf("Unexpected error decoding %s: %v", c.q, err)
+		}
+		if actual != c.expected {
+			t.Errorf("Expected: %s; Actual: %s", c.expected, actual)
+		}
+	}
+
+	if _, err := DecodeQuery("urlencoded:m%zz"); err == nil {
+		t.Errorf("Expected error decoding wrong escape")
+	}
+}
+
+func TestValidateQuery(t *testing.T) {
+	for _, c := range []struct {
+		q     string
+		valid bool
+	}{
+		{"m", true},
+		{"sum(rate(m{job=\"a\",mode=~\"x|y\"}[5m])) by (job)", true},
+		{"urlencoded:sum%20by%20(reconciler)(60*rate(controller_reconcile_count[1m]))", true},
+		{"sum(job_total_calls)%20by%20(job_id,function_name)-count(function_start)%20by%20(job_id,function_name)", true},
+		{"max_over_time(m[1h:5m])", true},
+		{"max_over_time(m[1h30m:])", true},
+		{"m{job=\"a)\"}", true},
+		{"m # comment (", true},
+		{"", false},
+		{"sum(m", false},
+		{"sum(m))", false},
+		{"m{job=\"a\"]", false},
+		{"rate(m[5x])", false},
+		{"rate(m[])", false},
+		{"m{job=\"a}", false},
+		{"m; drop", false},
+		{"m&time=0", false},
+	} {
+		err := ValidateQuery(c.q)
+		if c.valid && err != nil {
+			t.Errorf("Unexpected error validating %s: %v", c.q, err)
+		}
+		if !c.valid && err == nil {
+			t.Errorf("Expected error validating %s", c.q)
+		}
+	}
+}
+
+func TestValidator(t *testing.T) {
+	val := NewValidator(model.NewDefaultValidator(false, true))
+	a := model.Agreement{
+		Id:    "a01",
+		Name:  "Agreement 01",
+		State: model.STARTED,
+		Details: model.Details{
+			Id:       "a01",
+			Name:     "Agreement 01",
+			Type:     model.AGREEMENT,
+			Provider: model.Provider{Id: "p01", Name: "Provider01"},
+			Client:   model.Client{Id: "c02", Name: "A client"},
+			Variables: []model.Variable{
+				{Name: "ok", Metric: "sum(m) by (job)"},
+			},
+			Guarantees: []model.Guarantee{
+				{Name: "TestGuarantee", Constraint: "ok < 10"},
+			},
+		},
+	}
+	if errs := a.Validate(val, model.CREATE); len(errs) != 0 {
+		t.Errorf("Unexpected errors: %v", errs)
+	}
+	a.Details.Variables = append(a.Details.Variables, model.Variable{Name: "ko", Metric: "sum(m by (job)"})
+	if errs := a.Validate(val, model.CREATE); len(errs) != 1 {
+		t.Errorf("Expected one error. Actual: %v", errs)
+	}
+
+	tpl := model.Template{
+		Id:   "t01",
+		Name: "Template 01",
+		Details: model.Details{
+			Id:       "t01",
+			Name:     "Template 01",
+			Type:     model.TEMPLATE,
+			Provider: model.Provider{Id: "p01", Name: "Provider01"},
+			Client:   model.Client{Id: "{{.ClientId}}", Name: "{{.ClientName}}"},
+			Variables: []model.Variable{
+				{Name: "placeholder", Metric: "m[{{.range}}]"},
+				{Name: "ko", Metric: "rate(m[5x])"},
+			},
+			Guarantees: []model.Guarantee{
+				{Name: "TestGuarantee", Constraint: "placeholder < 10"},
+			},
+		},
+	}
+	if errs := tpl.Validate(val, model.CREATE); len(errs) != 1 {
+		t.Errorf("Expected one error. Actual: %v", errs)
+	}
+}
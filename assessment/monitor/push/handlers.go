@@ -0,0 +1,327 @@
+/*
+Copyright 2020 Atos
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package push
+
+/*
+This file contains the HTTP ingestion API of the push buffer.
+
+POST /metrics receives a JSON list of samples. Timestamps are RFC3339 strings or
+Unix seconds; if not set, the time of reception is used.
+
+	[
+		{ "metric": "job_duration", "labels": { "job": "backup" }, "timestamp": "2019-10-29T10:00:00Z", "value": 95 }
+	]
+
+POST /api/v1/write receives a Prometheus remote write request (snappy compressed
+protobuf WriteRequest). The name of a serie is the value of its __name__ label.
+
+Both endpoints return 204 on success, 400 if the body is malformed and 429 if some
+samples were rejected because the buffer is full.
+*/
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// MetricsPath is the path of the JSON ingestion endpoint
+	MetricsPath = "/metrics"
+	// RemoteWritePath is the path of the Prometheus remote write endpoint
+	RemoteWritePath = "/api/v1/write"
+
+	// maxBodySize is the maximum size of a request body
+	maxBodySize = 10 << 20
+
+	nameLabel = "__name__"
+)
+
+// Register adds the ingestion endpoints to a router
+func (b *Buffer) Register(router *mux.Router) {
+	router.Methods("POST").Path(MetricsPath).HandlerFunc(b.ReceiveJSON)
+	router.Methods("POST").Path(RemoteWritePath).HandlerFunc(b.ReceiveRemoteWrite)
+}
+
+type jsonSample struct {
+	Metric    string            `json:"metric"`
+	Labels    map[string]string `json:"labels"`
+	Timestamp interface{}       `json:"timestamp"`
+	Value     *float64          `json:"value"`
+}
+
+// ReceiveJSON is the handler of the JSON ingestion endpoint
+func (b *Buffer) ReceiveJSON(w http.ResponseWriter, r *http.Request) {
+	var samples []jsonSample
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize)).Decode(&samples); err != nil {
+		respondError(w, http.StatusBadRequest, err)
+		return
+	}
+	now := b.now()
+	rejected := 0
+	for i, s := range samples {
+		t, err := jsonTimestamp(s.Timestamp, now)
+		if err == nil && s.Metric == "" {
+			err = errors.New("metric is not set")
+		}
+		if err == nil && s.Value == nil {
+			err = errors.New("value is not set")
+		}
+		if err != nil {
+			respondError(w, http.StatusBadRequest, fmt.Errorf("sample %d: %s", i, err.Error()))
+			return
+		}
+		if s.Labels == nil {
+			s.Labels = map[string]string{}
+		}
+		if err := b.Append(s.Metric, s.Labels, t, *s.Value); err != nil {
+			rejected++
+		}
+	}
+	b.respond(w, len(samples), rejected)
+}
+
+// ReceiveRemoteWrite is the handler of the Prometheus remote write endpoint
+func (b *Buffer) ReceiveRemoteWrite(w http.ResponseWriter, r *http.Request) {
+	compressed, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err)
+		return
+	}
+	size, err := snappy.DecodedLen(compressed)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err)
+		return
+	}
+	if size > maxBodySize {
+		respondError(w, http.StatusRequestEntityTooLarge,
+			fmt.Errorf("decoded body of %d bytes exceeds %d bytes", size, maxBodySize))
+		return
+	}
+	body, err := snappy.Decode(nil, compressed)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err)
+		return
+	}
+	series, err := decodeWriteRequest(body)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err)
+		return
+	}
+	total, rejected := 0, 0
+	for _, s := range series {
+		name := s.labels[nameLabel]
+		if name == "" {
+			respondError(w, http.StatusBadRequest, fmt.Errorf("serie without %s label", nameLabel))
+			return
+		}
+		delete(s.labels, nameLabel)
+		for _, smp := range s.samples {
+			total++
+			if err := b.Append(name, s.labels, smp.t, smp.value); err != nil {
+				rejected++
+			}
+		}
+	}
+	b.respond(w, total, rejected)
+}
+
+func (b *Buffer) respond(w http.ResponseWriter, total, rejected int) {
+	log.Debugf("Received %d samples; rejected %d", total, rejected)
+	if rejected > 0 {
+		respondError(w, http.StatusTooManyRequests,
+			fmt.Errorf("%d of %d samples rejected: %s", rejected, total, ErrTooManySeries.Error()))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func respondError(w http.ResponseWriter, code int, err error) {
+	log.Warnf("Error receiving pushed metrics: %s", err.Error())
+	http.Error(w, err.Error(), code)
+}
+
+func jsonTimestamp(ts interface{}, now time.Time) (time.Time, error) {
+	switch v := ts.(type) {
+	case nil:
+		return now, nil
+	case float64:
+		return fromSeconds(v), nil
+	case string:
+		if secs, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+			return fromSeconds(secs), nil
+		}
+		return time.Parse(time.RFC3339Nano, v)
+	default:
+		return time.Time{}, fmt.Errorf("invalid timestamp %v", ts)
+	}
+}
+
+func fromSeconds(secs float64) time.Time {
+	sec, frac := math.Modf(secs)
+	return time.Unix(int64(sec), int64(math.Round(frac*1e9)))
+}
+
+/*
+Decoding of the remote write protobuf messages. Only the needed fields are decoded;
+the rest (e.g. metadata) are skipped.
+
+	message WriteRequest { repeated TimeSeries timeseries = 1; }
+	message TimeSeries { repeated Label labels = 1; repeated Sample samples = 2; }
+	message Label { string name = 1; string value = 2; }
+	message Sample { double value = 1; int64 timestamp = 2; }
+*/
+
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+var errMalformed = errors.New("malformed protobuf message")
+
+// fields calls f with the number, wire type and contents of each field of a message.
+// The contents of a varint or fixed field are given in value; the contents of a
+// length delimited field are given in data.
+func fields(msg []byte, f func(num int, wire int, value uint64, data []byte) error) error {
+	for len(msg) > 0 {
+		key, n := binary.Uvarint(msg)
+		if n <= 0 {
+			return errMalformed
+		}
+		msg = msg[n:]
+		num, wire := int(key>>3), int(key&7)
+		var value uint64
+		var data []byte
+		switch wire {
+		case wireVarint:
+			value, n = binary.Uvarint(msg)
+			if n <= 0 {
+				return errMalformed
+			}
+			msg = msg[n:]
+		case wireFixed64:
+			if len(msg) < 8 {
+				return errMalformed
+			}
+			value = binary.LittleEndian.Uint64(msg)
+			msg = msg[8:]
+		case wireFixed32:
+			if len(msg) < 4 {
+				return errMalformed
+			}
+			value = uint64(binary.LittleEndian.Uint32(msg))
+			msg = msg[4:]
+		case wireBytes:
+			length, n := binary.Uvarint(msg)
+			if n <= 0 || uint64(len(msg)-n) < length {
+				return errMalformed
+			}
+			data = msg[n : n+int(length)]
+			msg = msg[n+int(length):]
+		default:
+			return errMalformed
+		}
+		if err := f(num, wire, value, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func decodeWriteRequest(msg []byte) ([]serie, error) {
+	var result []serie
+	err := fields(msg, func(num, wire int, _ uint64, data []byte) error {
+		if num != 1 || wire != wireBytes {
+			return nil
+		}
+		s, err := decodeTimeSeries(data)
+		if err == nil {
+			result = append(result, s)
+		}
+		return err
+	})
+	return result, err
+}
+
+func decodeTimeSeries(msg []byte) (serie, error) {
+	s := serie{labels: map[string]string{}}
+	err := fields(msg, func(num, wire int, _ uint64, data []byte) error {
+		if wire != wireBytes {
+			return nil
+		}
+		switch num {
+		case 1:
+			name, value, err := decodeLabel(data)
+			if err != nil {
+				return err
+			}
+			s.labels[name] = value
+		case 2:
+			smp, err := decodeSample(data)
+			if err != nil {
+				return err
+			}
+			s.samples = append(s.samples, smp)
+		}
+		return nil
+	})
+	return s, err
+}
+
+func decodeLabel(msg []byte) (name, value string, err error) {
+	err = fields(msg, func(num, wire int, _ uint64, data []byte) error {
+		if wire != wireBytes {
+			return nil
+		}
+		switch num {
+		case 1:
+			name = string(data)
+		case 2:
+			value = string(data)
+		}
+		return nil
+	})
+	return name, value, err
+}
+
+func decodeSample(msg []byte) (sample, error) {
+	var result sample
+	err := fields(msg, func(num, wire int, value uint64, _ []byte) error {
+		switch {
+		case num == 1 && wire == wireFixed64:
+			result.value = math.Float64frombits(value)
+		case num == 2 && wire == wireVarint:
+			ms := int64(value)
+			result.t = time.Unix(ms/1000, (ms%1000)*int64(time.Millisecond))
+		}
+		return nil
+	})
+	return result, err
+}
@@ -0,0 +1,286 @@
+/*
+Copyright 2020 Atos
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+/*
+Package push provides a Retriever of metrics pushed to the SLALite, for
+sources that cannot be scraped (e.g., batch jobs that finish before the next scrape).
+
+The samples are received by the HTTP ingestion API (see handlers.go) and kept in a
+bounded in-process buffer: a maximum number of series, a maximum number of
+samples per series and a retention time.
+
+The metric of a variable is the name of a pushed metric, optionally followed by
+a label selector with equality matchers (e.g. job_duration{job="backup"}). The
+values in the window (From, To] of the RetrievalItem are returned.
+*/
+package push
+
+import (
+	"SLALite/assessment/monitor"
+	"SLALite/assessment/monitor/genericadapter"
+	"SLALite/model"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+const (
+	// Name is the unique identifier of this adapter/retriever
+	Name = "push"
+
+	// MaxSeriesPropertyName is the config property name of the maximum number of series in the buffer
+	MaxSeriesPropertyName = "pushMaxSeries"
+	// MaxSamplesPropertyName is the config property name of the maximum number of samples of a serie
+	MaxSamplesPropertyName = "pushMaxSamples"
+	// RetentionPropertyName is the config property name of the time the samples are kept
+	RetentionPropertyName = "pushRetention"
+	// KeyLabelsPropertyName is the config property name of the labels mapped to the
+	// key of metric values (see model.LabelMapping)
+	KeyLabelsPropertyName = "pushKeyLabels"
+	// ResourceLabelsPropertyName is the config property name of the labels mapped to the
+	// resource of metric values (see model.LabelMapping)
+	ResourceLabelsPropertyName = "pushResourceLabels"
+
+	defaultMaxSeries  = 10000
+	defaultMaxSamples = 1000
+	defaultRetention  = "1h"
+)
+
+// ErrTooManySeries is returned when a sample of a new serie is appended to a full buffer
+var ErrTooManySeries = errors.New("too many series")
+
+// defaultLabels is the label mapping used if the Buffer does not set one
+var defaultLabels = model.LabelMapping{
+	Key:      []string{"key"},
+	Resource: []string{"resource"},
+}
+
+type sample struct {
+	t     time.Time
+	value float64
+}
+
+type serie struct {
+	name    string
+	labels  map[string]string
+	samples []sample
+}
+
+// Buffer is a bounded in-process time series buffer of pushed samples.
+// It is safe for concurrent use.
+type Buffer struct {
+	// Labels is the mapping of labels to MetricValues, if not set in the variable
+	Labels model.LabelMapping
+
+	maxSeries  int
+	maxSamples int
+	retention  time.Duration
+	now        func() time.Time
+
+	mutex  sync.RWMutex
+	series map[string]*serie
+}
+
+// New constructs a push Buffer from a Viper configuration
+func New(config *viper.Viper) *Buffer {
+	config.SetDefault(MaxSeriesPropertyName, defaultMaxSeries)
+	config.SetDefault(MaxSamplesPropertyName, defaultMaxSamples)
+	config.SetDefault(RetentionPropertyName, defaultRetention)
+	config.SetDefault(KeyLabelsPropertyName, defaultLabels.Key)
+	config.SetDefault(ResourceLabelsPropertyName, defaultLabels.Resource)
+
+	b := _new(config.GetInt(MaxSeriesPropertyName), config.GetInt(MaxSamplesPropertyName),
+		config.GetDuration(RetentionPropertyName), time.Now)
+	b.Labels = model.LabelMapping{
+		Key:      config.GetStringSlice(KeyLabelsPropertyName),
+		Resource: config.GetStringSlice(ResourceLabelsPropertyName),
+	}
+	log.Infof("Push buffer configuration:\n"+
+		"\tMax series: %d\n"+
+		"\tMax samples per serie: %d\n"+
+		"\tRetention: %v\n"+
+		"\tKey labels: %v\n"+
+		"\tResource labels: %v",
+		b.maxSeries, b.maxSamples, b.retention, b.Labels.Key, b.Labels.Resource)
+	return b
+}
+
+func _new(maxSeries, maxSamples int, retention time.Duration, now func() time.Time) *Buffer {
+	return &Buffer{
+		maxSeries:  maxSeries,
+		maxSamples: maxSamples,
+		retention:  retention,
+		now:        now,
+		series:     map[string]*serie{},
+	}
+}
+
+// Append adds a sample to the serie of a metric with labels.
+//
+// Samples older than the retention are discarded. If the serie is full, its oldest
+// sample is removed. ErrTooManySeries is returned if the serie is new and the
+// buffer is full.
+func (b *Buffer) Append(name string, labels map[string]string, t time.Time, value float64) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	limit := b.now().Add(-b.retention)
+	if b.retention > 0 && !t.After(limit) {
+		return nil
+	}
+	id := serieID(name, labels)
+	s, ok := b.series[id]
+	if !ok {
+		if b.maxSeries > 0 && len(b.series) >= b.maxSeries {
+			return ErrTooManySeries
+		}
+		s = &serie{name: name, labels: labels}
+		b.series[id] = s
+	}
+	s.insert(sample{t: t, value: value})
+	if b.maxSamples > 0 && len(s.samples) > b.maxSamples {
+		s.samples = s.samples[len(s.samples)-b.maxSamples:]
+	}
+	return nil
+}
+
+// insert adds a sample keeping the samples sorted by time. A sample with the same
+// time of an existing one replaces it.
+func (s *serie) insert(smp sample) {
+	n := len(s.samples)
+	if n == 0 || s.samples[n-1].t.Before(smp.t) {
+		s.samples = append(s.samples, smp)
+		return
+	}
+	i := sort.Search(n, func(i int) bool { return !s.samples[i].t.Before(smp.t) })
+	if s.samples[i].t.Equal(smp.t) {
+		s.samples[i] = smp
+		return
+	}
+	s.samples = append(s.samples, sample{})
+	copy(s.samples[i+1:], s.samples[i:])
+	s.samples[i] = smp
+}
+
+// expire removes the samples older than the retention, and the empty series
+func (b *Buffer) expire() {
+	if b.retention <= 0 {
+		return
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	limit := b.now().Add(-b.retention)
+	for id, s := range b.series {
+		i := sort.Search(len(s.samples), func(i int) bool { return s.samples[i].t.After(limit) })
+		s.samples = s.samples[i:]
+		if len(s.samples) == 0 {
+			delete(b.series, id)
+		}
+	}
+}
+
+// Retrieve implements genericadapter.Retrieve
+func (b *Buffer) Retrieve() genericadapter.Retrieve {
+
+	return func(agreement model.Agreement,
+		items []monitor.RetrievalItem) map[model.Variable][]model.MetricValue {
+
+		b.expire()
+		result := make(map[model.Variable][]model.MetricValue)
+		for _, item := range items {
+			name, matchers, err := genericadapter.ParseSelector(item.Var.Metric)
+			if err != nil {
+				log.Errorf("Invalid metric '%s' of variable %s: %s", item.Var.Metric, item.Var.Name, err.Error())
+				result[item.Var] = []model.MetricValue{}
+				continue
+			}
+			mapping := item.Var.Labels.Merge(b.Labels.Merge(defaultLabels))
+			result[item.Var] = b.values(name, matchers, item.From, item.To, mapping)
+		}
+		return result
+	}
+}
+
+// values returns the values of the series of a metric matching the labels in the
+// window (from, to], sorted by time. A zero from is not considered.
+func (b *Buffer) values(name string, matchers map[string]string, from, to time.Time,
+	mapping model.LabelMapping) []model.MetricValue {
+
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	result := make([]model.MetricValue, 0)
+	for _, s := range b.series {
+		if s.name != name || !matches(s.labels, matchers) {
+			continue
+		}
+		k, rsc := mapping.Map(s.labels)
+		labels := model.NewLabels(s.labels)
+		start := 0
+		if !from.IsZero() {
+			start = sort.Search(len(s.samples), func(i int) bool { return s.samples[i].t.After(from) })
+		}
+		for _, smp := range s.samples[start:] {
+			if smp.t.After(to) {
+				break
+			}
+			result = append(result, model.MetricValue{
+				Key:      k,
+				Value:    smp.value,
+				DateTime: smp.t,
+				Resource: rsc,
+				Labels:   labels,
+			})
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].DateTime.Before(result[j].DateTime)
+	})
+	return result
+}
+
+func matches(labels map[string]string, matchers map[string]string) bool {
+	for k, v := range matchers {
+		if labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// serieID returns the identifier of a serie: its name and sorted labels
+func serieID(name string, labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	b.WriteString(name)
+	for _, k := range keys {
+		b.WriteByte(0)
+		b.WriteString(k)
+		b.WriteByte(0)
+		b.WriteString(labels[k])
+	}
+	return b.String()
+}
@@ -0,0 +1,269 @@
+/*
+Copyright 2020 Atos
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package push
+
+import (
+	"SLALite/assessment"
+	"SLALite/assessment/monitor"
+	"SLALite/assessment/monitor/genericadapter"
+	"SLALite/model"
+	"bytes"
+	"encoding/binary"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/gorilla/mux"
+	"github.com/spf13/viper"
+)
+
+var t0 = time.Date(2019, 10, 29, 10, 0, 0, 0, time.UTC)
+
+func clock(t time.Time) func() time.Time {
+	return func() time.Time { return t }
+}
+
+func TestNew(t *testing.T) {
+	b := New(viper.New())
+	if b.maxSeries != defaultMaxSeries || b.maxSamples != defaultMaxSamples || b.retention != time.Hour {
+		t.Errorf("Unexpected buffer: %v", b)
+	}
+}
+
+func TestAppend(t *testing.T) {
+	b := _new(2, 3, time.Hour, clock(t0))
+
+	labels := map[string]string{"host": "node1"}
+	for _, d := range []time.Duration{-3, -1, -2, -1} {
+		if err := b.Append("cpu", labels, t0.Add(d*time.Minute), float64(d)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s := b.series[serieID("cpu", labels)]
+	if len(s.samples) != 3 || !s.samples[0].t.Equal(t0.Add(-3*time.Minute)) || !s.samples[2].t.Equal(t0.Add(-time.Minute)) {
+		t.Errorf("Unexpected samples: %v", s.samples)
+	}
+
+	/* max samples */
+	b.Append("cpu", labels, t0, 0)
+	if len(s.samples) != 3 || !s.samples[0].t.Equal(t0.Add(-2*time.Minute)) {
+		t.Errorf("Unexpected samples: %v", s.samples)
+	}
+
+	/* retention */
+	b.Append("cpu", labels, t0.Add(-2*time.Hour), 0)
+	if len(s.samples) != 3 {
+		t.Errorf("Expected sample older than retention to be discarded: %v", s.samples)
+	}
+
+	/* max series */
+	if err := b.Append("cpu", map[string]string{"host": "node2"}, t0, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Append("cpu", map[string]string{"host": "node3"}, t0, 0); err != ErrTooManySeries {
+		t.Errorf("Expected ErrTooManySeries; Actual: %v", err)
+	}
+}
+
+func TestRetrieve(t *testing.T) {
+	now := t0
+	b := _new(0, 0, time.Hour, func() time.Time { return now })
+	b.Append("cpu", map[string]string{"host": "node1", "key": "a"}, t0.Add(-2*time.Minute), 10)
+	b.Append("cpu", map[string]string{"host": "node2", "key": "b"}, t0.Add(-time.Minute), 20)
+	b.Append("cpu", map[string]string{"host": "node1", "key": "a"}, t0, 30)
+	b.Append("mem", map[string]string{"host": "node1"}, t0, 40)
+
+	all := model.Variable{Name: "cpu", Metric: "cpu"}
+	node1 := model.Variable{Name: "cpu1", Metric: `cpu{host="node1"}`}
+	items := []monitor.RetrievalItem{
+		{Var: all, From: t0.Add(-2 * time.Minute), To: t0},
+		{Var: node1, To: t0},
+	}
+	result := b.Retrieve()(model.Agreement{}, items)
+
+	if values := result[all]; len(values) != 2 || values[0].Key != "b" || values[1].Value != 30.0 {
+		t.Errorf("Unexpected values of %s: %v", all.Name, values)
+	}
+	if values := result[node1]; len(values) != 2 || values[0].Value != 10.0 {
+		t.Errorf("Unexpected values of %s: %v", node1.Name, values)
+	}
+
+	now = t0.Add(time.Hour)
+	if values := b.Retrieve()(model.Agreement{}, items)[node1]; len(values) != 0 {
+		t.Errorf("Expected expired values: %v", values)
+	}
+	if len(b.series) != 0 {
+		t.Errorf("Expected expired series: %v", b.series)
+	}
+}
+
+func TestReceiveJSON(t *testing.T) {
+	b := _new(2, 0, time.Hour, clock(t0))
+	router := mux.NewRouter()
+	b.Register(router)
+
+	body := `[
+		{ "metric": "job_duration", "labels": { "job": "backup" }, "timestamp": "2019-10-29T09:59:00Z", "value": 95 },
+		{ "metric": "job_duration", "labels": { "job": "backup" }, "timestamp": 1572343110, "value": 90 },
+		{ "metric": "job_duration", "value": 0 }
+	]`
+	if code := post(router, MetricsPath, []byte(body)); code != http.StatusNoContent {
+		t.Errorf("Unexpected status: %d", code)
+	}
+	s := b.series[serieID("job_duration", map[string]string{"job": "backup"})]
+	if len(s.samples) != 2 || s.samples[0].value != 90 {
+		t.Errorf("Unexpected samples: %v", s.samples)
+	}
+	if s := b.series[serieID("job_duration", map[string]string{})]; !s.samples[0].t.Equal(t0) {
+		t.Errorf("Expected time of reception: %v", s.samples)
+	}
+
+	for _, body := range []string{
+		`{`,
+		`[{ "value": 1 }]`,
+		`[{ "metric": "m" }]`,
+		`[{ "metric": "m", "value": 1, "timestamp": "yesterday" }]`,
+	} {
+		if code := post(router, MetricsPath, []byte(body)); code != http.StatusBadRequest {
+			t.Errorf("Unexpected status of %s: %d", body, code)
+		}
+	}
+	if code := post(router, MetricsPath, []byte(`[{ "metric": "new", "value": 1 }]`)); code != http.StatusTooManyRequests {
+		t.Errorf("Unexpected status: %d", code)
+	}
+}
+
+func TestReceiveRemoteWrite(t *testing.T) {
+	b := _new(0, 0, time.Hour, clock(t0))
+	router := mux.NewRouter()
+	b.Register(router)
+
+	ms := t0.UnixNano() / int64(time.Millisecond)
+	req := writeRequest(
+		timeSeries(map[string]string{"__name__": "up", "job": "api"}, [][2]float64{{1, float64(ms - 1500)}, {0, float64(ms)}}),
+		timeSeries(map[string]string{"__name__": "latency", "job": "api"}, [][2]float64{{0.25, float64(ms)}}),
+	)
+	if code := post(router, RemoteWritePath, snappy.Encode(nil, req)); code != http.StatusNoContent {
+		t.Fatalf("Unexpected status: %d", code)
+	}
+	up := b.series[serieID("up", map[string]string{"job": "api"})]
+	if up == nil || len(up.samples) != 2 || up.samples[0].value != 1 ||
+		!up.samples[0].t.Equal(t0.Add(-1500*time.Millisecond)) {
+		t.Errorf("Unexpected serie: %v", up)
+	}
+	if latency := b.series[serieID("latency", map[string]string{"job": "api"})]; latency == nil || latency.samples[0].value != 0.25 {
+		t.Errorf("Unexpected serie: %v", latency)
+	}
+
+	if code := post(router, RemoteWritePath, []byte("not snappy")); code != http.StatusBadRequest {
+		t.Errorf("Unexpected status: %d", code)
+	}
+	if code := post(router, RemoteWritePath, snappy.Encode(nil, req[:len(req)-3])); code != http.StatusBadRequest {
+		t.Errorf("Unexpected status of truncated message: %d", code)
+	}
+	unnamed := writeRequest(timeSeries(map[string]string{"job": "api"}, [][2]float64{{1, float64(ms)}}))
+	if code := post(router, RemoteWritePath, snappy.Encode(nil, unnamed)); code != http.StatusBadRequest {
+		t.Errorf("Unexpected status of serie without name: %d", code)
+	}
+	huge := snappy.Encode(nil, make([]byte, maxBodySize+1))
+	if code := post(router, RemoteWritePath, huge); code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Unexpected status of too large message: %d", code)
+	}
+}
+
+func TestPushedIncident(t *testing.T) {
+	b := _new(0, 0, time.Hour, clock(t0))
+	router := mux.NewRouter()
+	b.Register(router)
+	body := `[
+		{ "metric": "cpu", "timestamp": "2019-10-29T09:58:00Z", "value": 95 },
+		{ "metric": "cpu", "timestamp": "2019-10-29T09:59:00Z", "value": 50 },
+		{ "metric": "cpu", "timestamp": "2019-10-29T10:00:00Z", "value": 99 }
+	]`
+	if code := post(router, MetricsPath, []byte(body)); code != http.StatusNoContent {
+		t.Fatalf("Unexpected status: %d", code)
+	}
+	a := model.Agreement{
+		Id:    "a01",
+		Name:  "a01",
+		State: model.STARTED,
+		Details: model.Details{
+			Id:         "a01",
+			Name:       "a01",
+			Type:       model.AGREEMENT,
+			Creation:   t0.Add(-5 * time.Minute),
+			Guarantees: []model.Guarantee{{Name: "cpu_high", Constraint: "cpu < 90"}},
+		},
+	}
+	cfg := assessment.Config{
+		Now:     t0,
+		Adapter: genericadapter.New(b.Retrieve(), genericadapter.Identity),
+	}
+	result := assessment.AssessAgreement(&a, cfg)
+	if violations := result.Violated["cpu_high"].Violations; len(violations) != 2 {
+		t.Errorf("Unexpected violations: %v", violations)
+	}
+}
+
+func post(router *mux.Router, path string, body []byte) int {
+	req := httptest.NewRequest("POST", path, bytes.NewReader(body))
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	return rr.Code
+}
+
+/*
+Encoding of remote write messages
+*/
+
+func uvarint(buf []byte, v uint64) []byte {
+	tmp := make([]byte, binary.MaxVarintLen64)
+	return append(buf, tmp[:binary.PutUvarint(tmp, v)]...)
+}
+
+func field(num int, data []byte) []byte {
+	buf := uvarint(nil, uint64(num<<3|wireBytes))
+	buf = uvarint(buf, uint64(len(data)))
+	return append(buf, data...)
+}
+
+func writeRequest(series ...[]byte) []byte {
+	var buf []byte
+	for _, s := range series {
+		buf = append(buf, field(1, s)...)
+	}
+	return buf
+}
+
+func timeSeries(labels map[string]string, samples [][2]float64) []byte {
+	var buf []byte
+	for name, value := range labels {
+		buf = append(buf, field(1, append(field(1, []byte(name)), field(2, []byte(value))...))...)
+	}
+	for _, s := range samples {
+		smp := make([]byte, 9)
+		smp[0] = 1<<3 | wireFixed64
+		binary.LittleEndian.PutUint64(smp[1:], math.Float64bits(s[0]))
+		smp = append(smp, 2<<3|wireVarint)
+		smp = uvarint(smp, uint64(int64(s[1])))
+		buf = append(buf, field(2, smp)...)
+	}
+	return buf
+}
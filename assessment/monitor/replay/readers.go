@@ -0,0 +1,195 @@
+/*
+Copyright 2020 Atos
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package replay
+
+/*
+This file contains the readers of the supported formats of recorded metrics.
+
+CSV: the header must contain the metric, timestamp and value columns; the rest of
+columns are labels. Timestamps are RFC3339 or Unix seconds.
+
+	metric,timestamp,value,host
+	cpu,2019-10-29T10:00:00Z,95,node1
+
+JSON: a list of samples. Timestamps are RFC3339 strings or Unix seconds.
+
+	[
+		{ "metric": "cpu", "timestamp": "2019-10-29T10:00:00Z", "value": 95, "labels": { "host": "node1" } }
+	]
+
+Prometheus text format (.prom) and OpenMetrics (.om): one sample per line; lines
+without timestamp are skipped.
+
+	cpu{host="node1"} 95 1572343200000
+*/
+
+import (
+	"SLALite/assessment/monitor/genericadapter"
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	metricColumn    = "metric"
+	timestampColumn = "timestamp"
+	valueColumn     = "value"
+)
+
+// reader reads the samples in r, passing each one to add
+type reader func(r io.Reader, add func(name string, s sample)) error
+
+var readers = map[string]reader{
+	".csv":  readCSV,
+	".json": readJSON,
+	".prom": func(r io.Reader, add func(string, sample)) error { return readText(r, time.Millisecond, add) },
+	".om":   func(r io.Reader, add func(string, sample)) error { return readText(r, time.Second, add) },
+}
+
+func readCSV(r io.Reader, add func(string, sample)) error {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	reader.Comment = '#'
+
+	header, err := reader.Read()
+	if err != nil {
+		return err
+	}
+	metricIdx, timeIdx, valueIdx := -1, -1, -1
+	for i, col := range header {
+		switch strings.TrimSpace(col) {
+		case metricColumn:
+			metricIdx = i
+		case timestampColumn:
+			timeIdx = i
+		case valueColumn:
+			valueIdx = i
+		}
+	}
+	if metricIdx < 0 || timeIdx < 0 || valueIdx < 0 {
+		return fmt.Errorf("the header must contain the columns %s, %s and %s",
+			metricColumn, timestampColumn, valueColumn)
+	}
+	for line := 2; ; line++ {
+		row, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		t, err := parseTimestamp(row[timeIdx])
+		if err != nil {
+			return fmt.Errorf("line %d: %s", line, err.Error())
+		}
+		value, err := strconv.ParseFloat(row[valueIdx], 64)
+		if err != nil {
+			return fmt.Errorf("line %d: %s", line, err.Error())
+		}
+		labels := map[string]string{}
+		for i, col := range header {
+			if i != metricIdx && i != timeIdx && i != valueIdx && row[i] != "" {
+				labels[strings.TrimSpace(col)] = row[i]
+			}
+		}
+		add(row[metricIdx], sample{labels: labels, t: t, value: value})
+	}
+}
+
+type jsonSample struct {
+	Metric    string            `json:"metric"`
+	Timestamp interface{}       `json:"timestamp"`
+	Value     float64           `json:"value"`
+	Labels    map[string]string `json:"labels"`
+}
+
+func readJSON(r io.Reader, add func(string, sample)) error {
+	var samples []jsonSample
+	if err := json.NewDecoder(r).Decode(&samples); err != nil {
+		return err
+	}
+	for i, s := range samples {
+		var t time.Time
+		var err error
+		switch ts := s.Timestamp.(type) {
+		case string:
+			t, err = parseTimestamp(ts)
+		case float64:
+			t = fromSeconds(ts)
+		default:
+			err = fmt.Errorf("invalid timestamp %v", s.Timestamp)
+		}
+		if err != nil {
+			return fmt.Errorf("sample %d: %s", i, err.Error())
+		}
+		if s.Labels == nil {
+			s.Labels = map[string]string{}
+		}
+		add(s.Metric, sample{labels: s.Labels, t: t, value: s.Value})
+	}
+	return nil
+}
+
+// readText reads the Prometheus and OpenMetrics text formats, whose timestamps are
+// expressed in unit
+func readText(r io.Reader, unit time.Duration, add func(string, sample)) error {
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		name, labels, rest, err := genericadapter.ParseSeries(text)
+		if err != nil {
+			return fmt.Errorf("line %d: %s", line, err.Error())
+		}
+		fields := strings.Fields(rest)
+		if len(fields) < 2 {
+			/* no timestamp: cannot be replayed */
+			continue
+		}
+		value, err := strconv.ParseFloat(fields[0], 64)
+		if err != nil {
+			return fmt.Errorf("line %d: %s", line, err.Error())
+		}
+		ts, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			return fmt.Errorf("line %d: %s", line, err.Error())
+		}
+		add(name, sample{labels: labels, t: fromSeconds(ts * unit.Seconds()), value: value})
+	}
+	return scanner.Err()
+}
+
+func parseTimestamp(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if secs, err := strconv.ParseFloat(s, 64); err == nil {
+		return fromSeconds(secs), nil
+	}
+	return time.Parse(time.RFC3339Nano, s)
+}
+
+func fromSeconds(secs float64) time.Time {
+	sec, frac := math.Modf(secs)
+	return time.Unix(int64(sec), int64(math.Round(frac*1e9)))
+}
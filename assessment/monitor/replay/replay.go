@@ -0,0 +1,233 @@
+/*
+Copyright 2020 Atos
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+/*
+Package replay provides a Retriever that replays metric series recorded in files,
+to evaluate agreements offline (e.g., to check which guarantees would have been
+violated during a production incident).
+
+The files are read on creation of the retriever. The format is given by the
+extension (see readers.go):
+
+	.csv    metric,timestamp,value and one column per label
+	.json   [{"metric": "cpu", "timestamp": "2019-10-29T10:00:00Z", "value": 95, "labels": {"host": "a"}}]
+	.prom   Prometheus text format, with timestamps in milliseconds
+	.om     OpenMetrics text format, with timestamps in seconds
+
+The metric of a variable is the name of a recorded metric, optionally followed by
+a label selector with equality matchers (e.g. cpu{host="a"}). The values in the
+window (From, To] of the RetrievalItem are returned.
+
+Usage:
+
+	r, err := replay.Load("incident.csv")
+	adapter := genericadapter.New(r.Retrieve(), genericadapter.Identity)
+	result := assessment.AssessAgreement(&agreement, assessment.Config{Now: t, Adapter: adapter})
+*/
+package replay
+
+import (
+	"SLALite/assessment/monitor"
+	"SLALite/assessment/monitor/genericadapter"
+	"SLALite/model"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+const (
+	// Name is the unique identifier of this adapter/retriever
+	Name = "replay"
+
+	// PathPropertyName is the config property name of the file or directory with
+	// the recorded metrics
+	PathPropertyName = "replayPath"
+	// KeyLabelsPropertyName is the config property name of the labels mapped to the
+	// key of metric values (see model.LabelMapping)
+	KeyLabelsPropertyName = "replayKeyLabels"
+	// ResourceLabelsPropertyName is the config property name of the labels mapped to the
+	// resource of metric values (see model.LabelMapping)
+	ResourceLabelsPropertyName = "replayResourceLabels"
+)
+
+// defaultLabels is the label mapping used if the Retriever does not set one
+var defaultLabels = model.LabelMapping{
+	Key:      []string{"key"},
+	Resource: []string{"resource"},
+}
+
+// sample is a recorded value of a metric
+type sample struct {
+	labels map[string]string
+	t      time.Time
+	value  float64
+}
+
+// Retriever implements genericadapter.Retrieve
+type Retriever struct {
+	// Labels is the mapping of labels to MetricValues, if not set in the variable
+	Labels  model.LabelMapping
+	samples map[string][]sample
+}
+
+// New constructs a replay adapter from a Viper configuration
+func New(config *viper.Viper) (Retriever, error) {
+	config.SetDefault(KeyLabelsPropertyName, defaultLabels.Key)
+	config.SetDefault(ResourceLabelsPropertyName, defaultLabels.Resource)
+
+	path := config.GetString(PathPropertyName)
+	if path == "" {
+		return Retriever{}, fmt.Errorf("%s is not set", PathPropertyName)
+	}
+	paths, err := expand(path)
+	if err != nil {
+		return Retriever{}, err
+	}
+	r, err := Load(paths...)
+	if err != nil {
+		return Retriever{}, err
+	}
+	r.Labels = model.LabelMapping{
+		Key:      config.GetStringSlice(KeyLabelsPropertyName),
+		Resource: config.GetStringSlice(ResourceLabelsPropertyName),
+	}
+	log.Infof("Replay configuration:\n"+
+		"\tPath: %s\n"+
+		"\tMetrics: %d\n"+
+		"\tKey labels: %v\n"+
+		"\tResource labels: %v",
+		path, len(r.samples), r.Labels.Key, r.Labels.Resource)
+	return r, nil
+}
+
+// expand returns the files with a known extension in path, if it is a directory, or path
+func expand(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+	files, err := ioutil.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]string, 0, len(files))
+	for _, f := range files {
+		if _, ok := readers[filepath.Ext(f.Name())]; ok && !f.IsDir() {
+			result = append(result, filepath.Join(path, f.Name()))
+		}
+	}
+	return result, nil
+}
+
+// Load returns a Retriever with the metrics recorded in the files
+func Load(paths ...string) (Retriever, error) {
+	r := Retriever{samples: map[string][]sample{}}
+	for _, path := range paths {
+		read, ok := readers[filepath.Ext(path)]
+		if !ok {
+			return r, fmt.Errorf("Unknown format of file %s", path)
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return r, err
+		}
+		err = read(f, r.add)
+		f.Close()
+		if err != nil {
+			return r, fmt.Errorf("Error reading %s: %s", path, err.Error())
+		}
+	}
+	for name := range r.samples {
+		samples := r.samples[name]
+		sort.SliceStable(samples, func(i, j int) bool {
+			return samples[i].t.Before(samples[j].t)
+		})
+	}
+	return r, nil
+}
+
+func (r Retriever) add(name string, s sample) {
+	r.samples[name] = append(r.samples[name], s)
+}
+
+// Retrieve implements genericadapter.Retrieve
+func (r Retriever) Retrieve() genericadapter.Retrieve {
+
+	return func(agreement model.Agreement,
+		items []monitor.RetrievalItem) map[model.Variable][]model.MetricValue {
+
+		result := make(map[model.Variable][]model.MetricValue)
+		for _, item := range items {
+			name, matchers, err := genericadapter.ParseSelector(item.Var.Metric)
+			if err != nil {
+				log.Errorf("Invalid metric '%s' of variable %s: %s", item.Var.Metric, item.Var.Name, err.Error())
+				result[item.Var] = []model.MetricValue{}
+				continue
+			}
+			mapping := item.Var.Labels.Merge(r.Labels.Merge(defaultLabels))
+			result[item.Var] = r.values(name, matchers, item.From, item.To, mapping)
+		}
+		return result
+	}
+}
+
+// values returns the values of a metric matching the labels in the window (from, to].
+// A zero from is not considered.
+func (r Retriever) values(name string, matchers map[string]string, from, to time.Time,
+	mapping model.LabelMapping) []model.MetricValue {
+
+	samples := r.samples[name]
+	start := 0
+	if !from.IsZero() {
+		start = sort.Search(len(samples), func(i int) bool { return samples[i].t.After(from) })
+	}
+	result := make([]model.MetricValue, 0)
+	for _, s := range samples[start:] {
+		if s.t.After(to) {
+			break
+		}
+		if !matches(s.labels, matchers) {
+			continue
+		}
+		k, rsc := mapping.Map(s.labels)
+		result = append(result, model.MetricValue{
+			Key:      k,
+			Value:    s.value,
+			DateTime: s.t,
+			Resource: rsc,
+			Labels:   model.NewLabels(s.labels),
+		})
+	}
+	return result
+}
+
+func matches(labels map[string]string, matchers map[string]string) bool {
+	for k, v := range matchers {
+		if labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
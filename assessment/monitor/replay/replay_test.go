@@ -0,0 +1,134 @@
+/*
+Copyright 2020 Atos
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package replay
+
+import (
+	"SLALite/assessment"
+	"SLALite/assessment/monitor"
+	"SLALite/assessment/monitor/genericadapter"
+	"SLALite/model"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+var t0 = time.Date(2019, 10, 29, 10, 0, 0, 0, time.UTC)
+
+func TestNew(t *testing.T) {
+	config := viper.New()
+	if _, err := New(config); err == nil {
+		t.Errorf("Expected error if path is not set")
+	}
+	config.Set(PathPropertyName, "testdata")
+	r, err := New(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, expected := range map[string]int{"cpu": 5, "latency": 2, "errors_total": 2, "up": 2} {
+		if actual := len(r.samples[name]); actual != expected {
+			t.Errorf("Unexpected samples of %s. Expected: %d; Actual: %d", name, expected, actual)
+		}
+	}
+	if _, err := Load("testdata/notexists.csv"); err == nil {
+		t.Errorf("Expected error reading not existing file")
+	}
+	if _, err := Load("replay.go"); err == nil {
+		t.Errorf("Expected error reading unknown format")
+	}
+}
+
+func TestTimestamps(t *testing.T) {
+	r, err := Load("testdata/incident.json", "testdata/incident.prom", "testdata/incident.om")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, expected := range map[string][]time.Time{
+		"latency":      {t0.Add(time.Minute), t0.Add(2 * time.Minute)},
+		"errors_total": {t0.Add(time.Minute), t0.Add(2 * time.Minute)},
+		"up":           {t0.Add(time.Minute), t0.Add(2*time.Minute + 500*time.Millisecond)},
+	} {
+		for i, s := range r.samples[name] {
+			if !s.t.Equal(expected[i]) {
+				t.Errorf("Unexpected time of %s[%d]. Expected: %v; Actual: %v", name, i, expected[i], s.t)
+			}
+		}
+	}
+	if labels := r.samples["errors_total"][0].labels; !reflect.DeepEqual(labels, map[string]string{"host": "node1", "code": "500"}) {
+		t.Errorf("Unexpected labels: %v", labels)
+	}
+}
+
+func TestRetrieve(t *testing.T) {
+	r, err := Load("testdata/incident.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	all := model.Variable{Name: "cpu", Metric: "cpu"}
+	node1 := model.Variable{Name: "cpu1", Metric: `cpu{host="node1"}`}
+	items := []monitor.RetrievalItem{
+		{Var: all, From: t0, To: t0.Add(2 * time.Minute)},
+		{Var: node1, To: t0.Add(time.Minute)},
+	}
+	result := r.Retrieve()(model.Agreement{}, items)
+
+	if values := result[all]; len(values) != 3 || values[1].Key != "b" || values[1].Value != 40.0 {
+		t.Errorf("Unexpected values of %s: %v", all.Name, values)
+	}
+	if values := result[node1]; len(values) != 2 || values[1].Labels.Get("host") != "node1" {
+		t.Errorf("Unexpected values of %s: %v", node1.Name, values)
+	}
+}
+
+func TestReplayIncident(t *testing.T) {
+	r, err := Load("testdata/incident.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	creation := t0.Add(-time.Minute)
+	a := model.Agreement{
+		Id:    "a01",
+		Name:  "a01",
+		State: model.STARTED,
+		Details: model.Details{
+			Id:       "a01",
+			Name:     "a01",
+			Type:     model.AGREEMENT,
+			Creation: creation,
+			Variables: []model.Variable{
+				{Name: "cpu", Metric: `cpu{host="node1"}`},
+			},
+			Guarantees: []model.Guarantee{
+				{Name: "cpu_high", Constraint: "cpu < 90"},
+			},
+		},
+	}
+	cfg := assessment.Config{
+		Now:     t0.Add(3 * time.Minute),
+		Adapter: genericadapter.New(r.Retrieve(), genericadapter.Identity),
+	}
+	result := assessment.AssessAgreement(&a, cfg)
+
+	violations := result.Violated["cpu_high"].Violations
+	if len(violations) != 2 {
+		t.Fatalf("Unexpected violations: %v", violations)
+	}
+	if !violations[0].Datetime.Equal(t0.Add(time.Minute)) || !violations[1].Datetime.Equal(t0.Add(2*time.Minute)) {
+		t.Errorf("Unexpected times of violations: %v, %v", violations[0].Datetime, violations[1].Datetime)
+	}
+}
@@ -0,0 +1,146 @@
+/*
+Copyright 2020 Atos
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package notifier
+
+import (
+	assessment_model "SLALite/assessment/model"
+	"SLALite/model"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// EnrichersPropertyName is the config property name of the map that binds
+	// guarantee names to the list of enrichers to apply to their violations.
+	// E.g.:
+	//   enrichers:
+	//     notstarted: [notstarted]
+	EnrichersPropertyName = "enrichers"
+)
+
+// Enricher adds information to a violation (usually in Violation.Fields) before
+// it is notified.
+type Enricher interface {
+	Enrich(agreement *model.Agreement, v *model.Violation) error
+}
+
+// EnricherFunc is an adapter to use ordinary functions as Enrichers.
+type EnricherFunc func(agreement *model.Agreement, v *model.Violation) error
+
+// Enrich implements Enricher
+func (f EnricherFunc) Enrich(agreement *model.Agreement, v *model.Violation) error {
+	return f(agreement, v)
+}
+
+/*
+EnricherRegistry contains the available enrichers and which ones are applied
+to each guarantee.
+
+The enrichers applied to the violations of a guarantee are the ones listed in
+Guarantee.Enrichers, plus the ones bound to the guarantee name with Bind.
+Guarantee names and enricher names are case insensitive.
+*/
+type EnricherRegistry struct {
+	enrichers  map[string]Enricher
+	guarantees map[string][]string
+}
+
+// NewEnricherRegistry returns an empty registry
+func NewEnricherRegistry() *EnricherRegistry {
+	return &EnricherRegistry{
+		enrichers:  map[string]Enricher{},
+		guarantees: map[string][]string{},
+	}
+}
+
+// Register adds an enricher to the registry with the given name
+func (r *EnricherRegistry) Register(name string, e Enricher) {
+	r.enrichers[strings.ToLower(name)] = e
+}
+
+// Bind applies the enrichers identified by names to the violations of every
+// guarantee called gtname
+func (r *EnricherRegistry) Bind(gtname string, names ...string) {
+	key := strings.ToLower(gtname)
+	r.guarantees[key] = append(r.guarantees[key], names...)
+}
+
+// BindAll binds guarantee names to enrichers as read from EnrichersPropertyName config
+func (r *EnricherRegistry) BindAll(bindings map[string][]string) {
+	for gtname, names := range bindings {
+		r.Bind(gtname, names...)
+	}
+}
+
+// Enrich applies the corresponding enrichers to all the violations in result.
+//
+// An enricher that fails does not prevent the rest of enrichers from being applied.
+func (r *EnricherRegistry) Enrich(agreement *model.Agreement, result *assessment_model.Result) {
+	for gtname, gtresult := range result.Violated {
+		names := r.enrichersOf(agreement, gtname)
+		if len(names) == 0 {
+			continue
+		}
+		for i := range gtresult.Violations {
+			v := &gtresult.Violations[i]
+			for _, name := range names {
+				e, ok := r.enrichers[strings.ToLower(name)]
+				if !ok {
+					log.Warnf("Enricher '%s' of guarantee %s not found", name, gtname)
+					continue
+				}
+				if v.Fields == nil {
+					v.Fields = map[string]interface{}{}
+				}
+				if err := e.Enrich(agreement, v); err != nil {
+					log.Warnf("Error applying enricher '%s' to violation of %s[%s]: %s",
+						name, agreement.Id, gtname, err.Error())
+				}
+			}
+		}
+	}
+}
+
+func (r *EnricherRegistry) enrichersOf(agreement *model.Agreement, gtname string) []string {
+	result := []string{}
+	for _, gt := range agreement.Details.Guarantees {
+		if gt.Name == gtname {
+			result = append(result, gt.Enrichers...)
+		}
+	}
+	return append(result, r.guarantees[strings.ToLower(gtname)]...)
+}
+
+type enrichingNotifier struct {
+	registry *EnricherRegistry
+	next     ViolationNotifier
+}
+
+// NewEnrichingNotifier returns a ViolationNotifier that applies the enrichers in
+// registry to the violations before passing them to the next notifier.
+func NewEnrichingNotifier(registry *EnricherRegistry, next ViolationNotifier) ViolationNotifier {
+	return enrichingNotifier{
+		registry: registry,
+		next:     next,
+	}
+}
+
+// NotifyViolations implements ViolationNotifier interface
+func (n enrichingNotifier) NotifyViolations(agreement *model.Agreement, result *assessment_model.Result) {
+	n.registry.Enrich(agreement, result)
+	n.next.NotifyViolations(agreement, result)
+}
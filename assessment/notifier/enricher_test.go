@@ -0,0 +1,97 @@
+/*
+Copyright 2020 Atos
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package notifier
+
+import (
+	assessment_model "SLALite/assessment/model"
+	"SLALite/model"
+	"errors"
+	"testing"
+	"time"
+)
+
+type recorder struct {
+	result *assessment_model.Result
+}
+
+func (n *recorder) NotifyViolations(agreement *model.Agreement, result *assessment_model.Result) {
+	n.result = result
+}
+
+func TestEnrichingNotifier(t *testing.T) {
+	a := model.Agreement{
+		Id: "a01",
+		Details: model.Details{
+			Guarantees: []model.Guarantee{
+				{Name: "g1", Constraint: "m > 0", Enrichers: []string{"first"}},
+				{Name: "G2", Constraint: "n > 0"},
+				{Name: "g3", Constraint: "o > 0"},
+			},
+		},
+	}
+	result := assessment_model.Result{
+		Violated: map[string]assessment_model.EvaluationGtResult{
+			"g1": {Violations: []model.Violation{newViolation("g1"), newViolation("g1")}},
+			"G2": {Violations: []model.Violation{newViolation("G2")}},
+			"g3": {Violations: []model.Violation{newViolation("g3")}},
+		},
+	}
+
+	registry := NewEnricherRegistry()
+	registry.Register("first", EnricherFunc(func(a *model.Agreement, v *model.Violation) error {
+		v.Fields["first"] = a.Id
+		return nil
+	}))
+	registry.Register("Second", EnricherFunc(func(a *model.Agreement, v *model.Violation) error {
+		v.Fields["second"] = v.Guarantee
+		return nil
+	}))
+	registry.Register("failing", EnricherFunc(func(a *model.Agreement, v *model.Violation) error {
+		return errors.New("failing enricher")
+	}))
+	registry.BindAll(map[string][]string{
+		"g1": {"second"},
+		"g2": {"failing", "notexists", "second"},
+	})
+
+	next := &recorder{}
+	not := NewEnrichingNotifier(registry, next)
+	not.NotifyViolations(&a, &result)
+
+	if next.result != &result {
+		t.Fatalf("Result not passed to next notifier")
+	}
+	for _, v := range result.Violated["g1"].Violations {
+		if v.Fields["first"] != "a01" || v.Fields["second"] != "g1" {
+			t.Errorf("Unexpected fields in g1 violation: %v", v.Fields)
+		}
+	}
+	if v := result.Violated["G2"].Violations[0]; len(v.Fields) != 1 || v.Fields["second"] != "G2" {
+		t.Errorf("Unexpected fields in G2 violation: %v", v.Fields)
+	}
+	if v := result.Violated["g3"].Violations[0]; v.Fields != nil {
+		t.Errorf("Unexpected fields in g3 violation: %v", v.Fields)
+	}
+}
+
+func newViolation(gtname string) model.Violation {
+	return model.Violation{
+		AgreementId: "a01",
+		Guarantee:   gtname,
+		Datetime:    time.Now(),
+		Values:      []model.MetricValue{{Key: "m", Value: 0, DateTime: time.Now()}},
+	}
+}
@@ -0,0 +1,321 @@
+/*
+Copyright 2020 Atos
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package kafka contains a ViolationNotifier that publishes violations to a Kafka topic.
+//
+// Each violation, and each incident closed when a guarantee term is fulfilled again,
+// is sent as a JSON message. The message key is configurable (agreement id,
+// guarantee name or both), and the message carries the headers event
+// (violated or recovered), agreement_id and guarantee, plus the ones set in configuration.
+// If notifications of the agreement were aggregated or dropped by rate limiting, a
+// message with event summary and the Summary is also sent.
+package kafka
+
+import (
+	amodel "SLALite/assessment/model"
+	"SLALite/assessment/notifier"
+	"SLALite/model"
+	"SLALite/utils"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Shopify/sarama"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+const (
+	// Name is the unique identifier of this notifier
+	Name = "kafka"
+
+	// BrokersPropertyName is the config property name of the list of Kafka brokers
+	BrokersPropertyName = "kafkaBrokers"
+	// TopicPropertyName is the config property name of the topic where to publish
+	TopicPropertyName = "kafkaTopic"
+	// KeyPropertyName is the config property name of the message key type
+	// (agreement, guarantee or agreement_guarantee)
+	KeyPropertyName = "kafkaKey"
+	// HeadersPropertyName is the config property name of the map of headers added to every message
+	HeadersPropertyName = "kafkaHeaders"
+	// BatchSizePropertyName is the config property name of the maximum number of messages
+	// sent in a single request
+	BatchSizePropertyName = "kafkaBatchSize"
+	// BatchTimeoutPropertyName is the config property name of the maximum time to wait
+	// for a batch to be filled before sending it
+	BatchTimeoutPropertyName = "kafkaBatchTimeout"
+	// VersionPropertyName is the config property name of the Kafka version of the brokers
+	VersionPropertyName = "kafkaVersion"
+
+	// TLSPropertyName is the config property name that enables TLS
+	TLSPropertyName = "kafkaTls"
+	// TLSCAPathPropertyName is the config property name of the CA file used to verify the brokers
+	TLSCAPathPropertyName = "kafkaTlsCAPath"
+	// TLSCertPathPropertyName is the config property name of the client certificate
+	TLSCertPathPropertyName = "kafkaTlsCertPath"
+	// TLSKeyPathPropertyName is the config property name of the client certificate key
+	TLSKeyPathPropertyName = "kafkaTlsKeyPath"
+	// TLSInsecurePropertyName is the config property name that disables the verification of brokers
+	TLSInsecurePropertyName = "kafkaTlsInsecure"
+
+	// SASLMechanismPropertyName is the config property name of the SASL mechanism (only PLAIN supported).
+	// SASL is disabled if empty.
+	SASLMechanismPropertyName = "kafkaSaslMechanism"
+	// SASLUserPropertyName is the config property name of the SASL user
+	SASLUserPropertyName = "kafkaSaslUser"
+	// SASLPasswordPropertyName is the config property name of the SASL password
+	SASLPasswordPropertyName = "kafkaSaslPassword"
+
+	// ViolatedEvent is the value of the event header in violation messages
+	ViolatedEvent = "violated"
+	// RecoveredEvent is the value of the event header in recovery messages (closed incidents)
+	RecoveredEvent = "recovered"
+	// SummaryEvent is the value of the event header in summary messages (aggregated or
+	// dropped notifications)
+	SummaryEvent = "summary"
+
+	// AgreementKey sets the agreement id as message key
+	AgreementKey = "agreement"
+	// GuaranteeKey sets the guarantee name as message key
+	GuaranteeKey = "guarantee"
+	// AgreementGuaranteeKey sets <agreement id>/<guarantee name> as message key
+	AgreementGuaranteeKey = "agreement_guarantee"
+
+	defaultTopic        = "sla-violations"
+	defaultKey          = AgreementKey
+	defaultBatchSize    = 100
+	defaultBatchTimeout = 100 * time.Millisecond
+	defaultVersion      = "1.0.0"
+)
+
+type settings struct {
+	topic     string
+	key       string
+	headers   map[string]string
+	batchSize int
+}
+
+type _notifier struct {
+	settings
+	producer sarama.SyncProducer
+}
+
+// New constructs a Kafka Notifier, connecting to the configured brokers.
+//
+// An error is returned if the configuration is not valid or brokers cannot be reached.
+func New(config *viper.Viper) (notifier.ViolationNotifier, error) {
+	config.SetDefault(TopicPropertyName, defaultTopic)
+	config.SetDefault(KeyPropertyName, defaultKey)
+	config.SetDefault(BatchSizePropertyName, defaultBatchSize)
+	config.SetDefault(BatchTimeoutPropertyName, defaultBatchTimeout)
+	config.SetDefault(VersionPropertyName, defaultVersion)
+
+	brokers := config.GetStringSlice(BrokersPropertyName)
+	if len(brokers) == 0 {
+		return nil, fmt.Errorf("%s is not set", BrokersPropertyName)
+	}
+	s, err := newSettings(config)
+	if err != nil {
+		return nil, err
+	}
+	saramaCfg, err := newSaramaConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	logConfig(config, brokers)
+
+	producer, err := sarama.NewSyncProducer(brokers, saramaCfg)
+	if err != nil {
+		return nil, fmt.Errorf("Error connecting to Kafka brokers %v: %s", brokers, err.Error())
+	}
+	return _new(s, producer), nil
+}
+
+func _new(s settings, producer sarama.SyncProducer) notifier.ViolationNotifier {
+	return _notifier{
+		settings: s,
+		producer: producer,
+	}
+}
+
+func newSettings(config *viper.Viper) (settings, error) {
+	s := settings{
+		topic:     config.GetString(TopicPropertyName),
+		key:       config.GetString(KeyPropertyName),
+		headers:   config.GetStringMapString(HeadersPropertyName),
+		batchSize: config.GetInt(BatchSizePropertyName),
+	}
+	switch s.key {
+	case AgreementKey, GuaranteeKey, AgreementGuaranteeKey:
+	default:
+		return s, fmt.Errorf("Not valid %s: %s", KeyPropertyName, s.key)
+	}
+	if s.batchSize <= 0 {
+		return s, fmt.Errorf("Not valid %s: %d", BatchSizePropertyName, s.batchSize)
+	}
+	return s, nil
+}
+
+func newSaramaConfig(config *viper.Viper) (*sarama.Config, error) {
+	cfg := sarama.NewConfig()
+	cfg.ClientID = "slalite"
+	cfg.Producer.Return.Successes = true
+	cfg.Producer.RequiredAcks = sarama.WaitForAll
+	cfg.Producer.Flush.Messages = config.GetInt(BatchSizePropertyName)
+	cfg.Producer.Flush.Frequency = config.GetDuration(BatchTimeoutPropertyName)
+
+	version, err := sarama.ParseKafkaVersion(config.GetString(VersionPropertyName))
+	if err != nil {
+		return nil, err
+	}
+	cfg.Version = version
+
+	if config.GetBool(TLSPropertyName) {
+		tlsCfg, err := utils.NewTLSConfig(
+			config.GetString(TLSCAPathPropertyName),
+			config.GetString(TLSCertPathPropertyName),
+			config.GetString(TLSKeyPathPropertyName),
+			config.GetBool(TLSInsecurePropertyName))
+		if err != nil {
+			return nil, err
+		}
+		cfg.Net.TLS.Enable = true
+		cfg.Net.TLS.Config = tlsCfg
+	}
+
+	if mechanism := config.GetString(SASLMechanismPropertyName); mechanism != "" {
+		if mechanism != sarama.SASLTypePlaintext {
+			return nil, fmt.Errorf("Not supported %s: %s", SASLMechanismPropertyName, mechanism)
+		}
+		password, err := utils.GetSecret(config, SASLPasswordPropertyName)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Net.SASL.Enable = true
+		cfg.Net.SASL.Mechanism = sarama.SASLMechanism(mechanism)
+		cfg.Net.SASL.User = config.GetString(SASLUserPropertyName)
+		cfg.Net.SASL.Password = password
+	}
+
+	return cfg, cfg.Validate()
+}
+
+func logConfig(config *viper.Viper, brokers []string) {
+	log.Infof("KafkaNotifier configuration\n"+
+		"\tBrokers: %v\n"+
+		"\tTopic: %s\n"+
+		"\tKey: %s\n"+
+		"\tBatch size: %d\n"+
+		"\tBatch timeout: %v\n"+
+		"\tTLS: %v\n"+
+		"\tSASL: %s\n",
+		brokers,
+		config.GetString(TopicPropertyName),
+		config.GetString(KeyPropertyName),
+		config.GetInt(BatchSizePropertyName),
+		config.GetDuration(BatchTimeoutPropertyName),
+		config.GetBool(TLSPropertyName),
+		config.GetString(SASLMechanismPropertyName))
+}
+
+// NotifyViolations implements ViolationNotifier interface
+func (n _notifier) NotifyViolations(agreement *model.Agreement, result *amodel.Result) {
+	msgs, err := n.buildMessages(agreement.Id, result.GetViolations(), result.GetRecoveries(), result.Summary)
+	if err != nil {
+		log.Errorf("KafkaNotifier error: %s", err.Error())
+		return
+	}
+
+	for len(msgs) > 0 {
+		size := n.batchSize
+		if size > len(msgs) {
+			size = len(msgs)
+		}
+		if err := n.producer.SendMessages(msgs[:size]); err != nil {
+			log.Errorf("KafkaNotifier error sending events of agreement %s: %s", agreement.Id, err.Error())
+		} else {
+			log.Infof("KafkaNotifier. Sent %d events of agreement %s to topic %s", size, agreement.Id, n.topic)
+		}
+		msgs = msgs[size:]
+	}
+}
+
+type summaryInfo struct {
+	AgreementID string `json:"agreement_id"`
+	*amodel.Summary
+}
+
+func (n _notifier) buildMessages(agreementID string, vs []model.Violation, incidents []model.Incident,
+	summary *amodel.Summary) ([]*sarama.ProducerMessage, error) {
+
+	result := make([]*sarama.ProducerMessage, 0, len(vs)+len(incidents)+1)
+	for _, v := range vs {
+		msg, err := n.buildMessage(ViolatedEvent, v.AgreementId, v.Guarantee, v)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, msg)
+	}
+	for _, incident := range incidents {
+		msg, err := n.buildMessage(RecoveredEvent, incident.AgreementId, incident.Guarantee, incident)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, msg)
+	}
+	if summary != nil {
+		msg, err := n.buildMessage(SummaryEvent, agreementID, "", summaryInfo{AgreementID: agreementID, Summary: summary})
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, msg)
+	}
+	return result, nil
+}
+
+func (n _notifier) buildMessage(event, agreementID, gtname string, content interface{}) (*sarama.ProducerMessage, error) {
+	value, err := json.Marshal(content)
+	if err != nil {
+		return nil, err
+	}
+	headers := []sarama.RecordHeader{
+		{Key: []byte("event"), Value: []byte(event)},
+		{Key: []byte("agreement_id"), Value: []byte(agreementID)},
+		{Key: []byte("guarantee"), Value: []byte(gtname)},
+	}
+	for k, h := range n.headers {
+		headers = append(headers, sarama.RecordHeader{Key: []byte(k), Value: []byte(h)})
+	}
+	return &sarama.ProducerMessage{
+		Topic:   n.topic,
+		Key:     sarama.StringEncoder(n.messageKey(agreementID, gtname)),
+		Value:   sarama.ByteEncoder(value),
+		Headers: headers,
+	}, nil
+}
+
+func (n _notifier) messageKey(agreementID, gtname string) string {
+	switch n.key {
+	case GuaranteeKey:
+		return gtname
+	case AgreementGuaranteeKey:
+		return strings.Join([]string{agreementID, gtname}, "/")
+	default:
+		return agreementID
+	}
+}
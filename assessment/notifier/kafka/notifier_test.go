@@ -0,0 +1,199 @@
+/*
+Copyright 2020 Atos
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package kafka
+
+import (
+	amodel "SLALite/assessment/model"
+	"SLALite/model"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/spf13/viper"
+)
+
+var agreement = model.Agreement{Id: "a01"}
+
+var result = amodel.Result{
+	Violated: map[string]amodel.EvaluationGtResult{
+		"g1": {
+			Violations: []model.Violation{
+				newViolation("g1", 1), newViolation("g1", 2), newViolation("g1", 3),
+			},
+		},
+	},
+}
+
+/*
+fakeBroker starts an in-process Kafka broker that accepts produce requests
+on topic. Produce responses are version 3, as headers need Kafka >= 0.11
+*/
+func fakeBroker(t *testing.T, topic string) *sarama.MockBroker {
+	broker := sarama.NewMockBroker(t, 1)
+	broker.SetHandlerByMap(map[string]sarama.MockResponse{
+		"MetadataRequest": sarama.NewMockMetadataResponse(t).
+			SetBroker(broker.Addr(), broker.BrokerID()).
+			SetLeader(topic, 0, broker.BrokerID()),
+		"ProduceRequest": sarama.NewMockProduceResponse(t).
+			SetVersion(3).
+			SetError(topic, 0, sarama.ErrNoError),
+	})
+	return broker
+}
+
+func TestNew(t *testing.T) {
+	config := viper.New()
+	if _, err := New(config); err == nil {
+		t.Errorf("Expected error on missing brokers")
+	}
+
+	broker := fakeBroker(t, defaultTopic)
+	defer broker.Close()
+
+	config.Set(BrokersPropertyName, []string{broker.Addr()})
+	config.Set(KeyPropertyName, "wrong")
+	if _, err := New(config); err == nil {
+		t.Errorf("Expected error on wrong key")
+	}
+
+	config.Set(KeyPropertyName, GuaranteeKey)
+	config.Set(SASLMechanismPropertyName, "GSSAPI")
+	if _, err := New(config); err == nil {
+		t.Errorf("Expected error on not supported SASL mechanism")
+	}
+
+	config.Set(SASLMechanismPropertyName, "")
+	config.Set(TLSPropertyName, true)
+	config.Set(TLSCAPathPropertyName, "testdata/notexists.pem")
+	if _, err := New(config); err == nil {
+		t.Errorf("Expected error on missing CA file")
+	}
+}
+
+func TestSend(t *testing.T) {
+	topic := "violations"
+	broker := fakeBroker(t, topic)
+	defer broker.Close()
+
+	config := viper.New()
+	config.Set(BrokersPropertyName, []string{broker.Addr()})
+	config.Set(TopicPropertyName, topic)
+	config.Set(BatchSizePropertyName, 2)
+
+	not, err := New(config)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	not.NotifyViolations(&agreement, &result)
+	not.NotifyViolations(&agreement, &amodel.Result{})
+
+	produced := 0
+	for _, rr := range broker.History() {
+		if _, ok := rr.Request.(*sarama.ProduceRequest); ok {
+			produced++
+		}
+	}
+	// 3 violations in batches of 2
+	if produced != 2 {
+		t.Errorf("Unexpected number of produce requests. Expected: %d; Actual: %d", 2, produced)
+	}
+}
+
+func TestBuildMessages(t *testing.T) {
+	n := _notifier{
+		settings: settings{
+			topic:     "violations",
+			key:       AgreementGuaranteeKey,
+			headers:   map[string]string{"source": "slalite"},
+			batchSize: 1,
+		},
+	}
+	vs := result.GetViolations()
+	end := time.Now()
+	incidents := []model.Incident{{AgreementId: "a01", Guarantee: "g2", Start: end, End: &end}}
+	summary := &amodel.Summary{From: end.Add(-time.Minute), To: end, Dropped: 4}
+	msgs, err := n.buildMessages("a01", vs, incidents, summary)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if len(msgs) != len(vs)+2 {
+		t.Fatalf("Unexpected number of messages. Expected: %d; Actual: %d", len(vs)+2, len(msgs))
+	}
+	msg := msgs[0]
+	if msg.Topic != "violations" {
+		t.Errorf("Unexpected topic: %s", msg.Topic)
+	}
+	if key, _ := msg.Key.Encode(); string(key) != "a01/g1" {
+		t.Errorf("Unexpected key: %s", key)
+	}
+	headers := map[string]string{}
+	for _, h := range msg.Headers {
+		headers[string(h.Key)] = string(h.Value)
+	}
+	if headers["event"] != ViolatedEvent || headers["agreement_id"] != "a01" ||
+		headers["guarantee"] != "g1" || headers["source"] != "slalite" {
+		t.Errorf("Unexpected headers: %v", headers)
+	}
+	value, _ := msg.Value.Encode()
+	var v model.Violation
+	if err := json.Unmarshal(value, &v); err != nil {
+		t.Fatalf("Error decoding message value: %s", err.Error())
+	}
+	if v.AgreementId != "a01" || v.Guarantee != "g1" || len(v.Values) != 1 {
+		t.Errorf("Unexpected violation: %v", v)
+	}
+
+	recovery := msgs[len(msgs)-2]
+	if key, _ := recovery.Key.Encode(); string(key) != "a01/g2" {
+		t.Errorf("Unexpected key: %s", key)
+	}
+	if h := recovery.Headers[0]; string(h.Key) != "event" || string(h.Value) != RecoveredEvent {
+		t.Errorf("Unexpected header: %s=%s", h.Key, h.Value)
+	}
+
+	last := msgs[len(msgs)-1]
+	if h := last.Headers[0]; string(h.Key) != "event" || string(h.Value) != SummaryEvent {
+		t.Errorf("Unexpected header: %s=%s", h.Key, h.Value)
+	}
+	value, _ = last.Value.Encode()
+	var info map[string]interface{}
+	if err := json.Unmarshal(value, &info); err != nil {
+		t.Fatalf("Error decoding message value: %s", err.Error())
+	}
+	if info["agreement_id"] != "a01" || info["dropped"] != 4.0 {
+		t.Errorf("Unexpected summary: %v", info)
+	}
+
+	n.key = GuaranteeKey
+	if key := n.messageKey("a01", "g1"); key != "g1" {
+		t.Errorf("Unexpected key: %s", key)
+	}
+	n.key = AgreementKey
+	if key := n.messageKey("a01", "g1"); key != "a01" {
+		t.Errorf("Unexpected key: %s", key)
+	}
+}
+
+func newViolation(gtname string, value float64) model.Violation {
+	return model.Violation{
+		AgreementId: "a01",
+		Guarantee:   gtname,
+		Datetime:    time.Now(),
+		Constraint:  "m > 5",
+		Values:      []model.MetricValue{{Key: "m", Value: value, DateTime: time.Now()}},
+	}
+}
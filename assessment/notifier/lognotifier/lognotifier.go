@@ -30,7 +30,9 @@ type LogNotifier struct {
 
 // NotifyViolations implements ViolationNotifier interface
 func (n LogNotifier) NotifyViolations(agreement *model.Agreement, result *assessment_model.Result) {
-	log.Info("Violation of agreement: " + agreement.Id)
+	if len(result.Violated) > 0 {
+		log.Info("Violation of agreement: " + agreement.Id)
+	}
 	for k, v := range result.Violated {
 		if len(v.Violations) > 0 {
 			log.Info("Failed guarantee: " + k)
@@ -39,4 +41,12 @@ func (n LogNotifier) NotifyViolations(agreement *model.Agreement, result *assess
 			}
 		}
 	}
+	if sm := result.Summary; sm != nil {
+		log.Infof("Notifications of agreement %s from %s to %s: %d aggregated; %d dropped",
+			agreement.Id, sm.From, sm.To, sm.Aggregated, sm.Dropped)
+	}
+	for _, incident := range result.Recovered {
+		log.Infof("Recovered guarantee %v of agreement %s at %s after %vs",
+			incident.Guarantee, incident.AgreementId, incident.End, incident.Duration)
+	}
 }
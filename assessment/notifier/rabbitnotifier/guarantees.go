@@ -19,9 +19,11 @@ limitations under the License.
 package rabbitpushgnotifier
 
 import (
+	"SLALite/assessment/monitor/prometheus"
+	"SLALite/model"
 	"encoding/json"
 	"fmt"
-	"net/http"
+	"net/url"
 	"strconv"
 
 	log "github.com/sirupsen/logrus"
@@ -57,14 +59,23 @@ type metric struct {
  * Query single query to prometheus
  */
 func Query(m string, prometheusRootURL string) (QueryResp, error) {
-	url := fmt.Sprintf("%s/api/v1/query?query=%s", prometheusRootURL, m)
+	return QueryWithClient(nil, m, prometheusRootURL)
+}
+
+/**
+ * QueryWithClient single query to prometheus, with the credentials and headers of client
+ */
+func QueryWithClient(client *prometheus.Client, m string, prometheusRootURL string) (QueryResp, error) {
+	params := url.Values{}
+	params.Set("query", m)
+	url := fmt.Sprintf("%s/api/v1/query?%s", prometheusRootURL, params.Encode())
 	log.Debugf("guarantees [Query] url: %s", url)
-	return request(url)
+	return request(client, url)
 }
 
 // http request
-func request(url string) (QueryResp, error) {
-	resp, err := http.Get(url)
+func request(client *prometheus.Client, url string) (QueryResp, error) {
+	resp, err := client.Get(url)
 	if err != nil {
 		log.Error(err)
 		return QueryResp{}, err
@@ -87,26 +98,60 @@ func request(url string) (QueryResp, error) {
 	return result, nil
 }
 
+const (
+	// NotStartedEnricherName is the name of the enricher that adds the not started functions
+	NotStartedEnricherName = "notstarted"
+	// NotStartedField is the violation field that contains the list of not started functions
+	NotStartedField = "notStarted"
+	// NotStartedDroppedField is the message field that contains the number of not started
+	// functions whose messages were dropped by the notification limits
+	NotStartedDroppedField = "notStartedDropped"
+)
+
+// NotStartedEnricher is a notifier.Enricher that adds to a violation the list of
+// the functions of the violated job that did not start.
+type NotStartedEnricher struct {
+	// PrometheusURL is used if the agreement does not set its own MonitoringURL
+	PrometheusURL string
+	// Clients are the HTTP clients of the Prometheus URLs. Plain requests are performed if nil.
+	Clients *prometheus.Clients
+}
+
+// Enrich implements notifier.Enricher
+func (e NotStartedEnricher) Enrich(agreement *model.Agreement, v *model.Violation) error {
+	if len(v.Values) == 0 {
+		return fmt.Errorf("violation without values")
+	}
+	rootURL := prometheusRoot(*agreement, e.PrometheusURL)
+	if rootURL == "" {
+		return fmt.Errorf("Prometheus URL not set")
+	}
+	funcList := notStarted(e.Clients.For(rootURL), rootURL, v.Values[0].Key, v.Values[0].Resource)
+	log.Debugf("List of not started functions: %v", funcList)
+	v.Fields[NotStartedField] = funcList
+	return nil
+}
+
 /**
  * ChecknotStartedFunctions queries Prometheus for the functions that didn't start from a job.
  * Returns a []string with the instances ids of no started functions, e.g. []string{"935882-0-A000-00002", "935882-0-A000-00003"}
  */
 func ChecknotStartedFunctions(prometheusRootURL string, jobId string, resource string) []string {
-	return notStarted(prometheusRootURL, jobId, resource)
+	return notStarted(nil, prometheusRootURL, jobId, resource)
 }
 
 /**
  * notStarted this function queries Prometheus for the functions that didn't start from a job.
  * Returns a []string with the instances ids of no started functions, e.g. []string{"935882-0-A000-00002", "935882-0-A000-00003"}
  */
-func notStarted(prometheusRootURL string, jobId string, resource string) []string {
+func notStarted(client *prometheus.Client, prometheusRootURL string, jobId string, resource string) []string {
 	log.Debugf("guarantees [notStarted] jobId:  %s , resource: %s, prometheus URL: %s", jobId, resource, prometheusRootURL)
 
 	// 1. get total calls: "job_total_calls{job_id='935882-1-A000'}"
 	queryStr := "job_total_calls{job_id='" + jobId + "'}"
 
 	log.Debugf("guarantees [notStarted] Getting 'jobTotalCalls' value from Prometheus > queryStr: %s", queryStr)
-	resQ, err := Query(queryStr, prometheusRootURL)
+	resQ, err := QueryWithClient(client, queryStr, prometheusRootURL)
 	if err == nil && len(resQ.Data.Results) > 0 && len(resQ.Data.Results[0].Values) > 1 {
 
 		jobTotalCalls, err := strconv.Atoi(resQ.Data.Results[0].Values[1].(string))
@@ -126,7 +171,7 @@ func notStarted(prometheusRootURL string, jobId string, resource string) []strin
 			log.Debugf("guarantees [notStarted] > Getting all 'function_start' values from Prometheus > queryStr: %s", queryStr)
 
 			// execut query
-			resQ, err = Query(queryStr, prometheusRootURL)
+			resQ, err = QueryWithClient(client, queryStr, prometheusRootURL)
 			if err == nil && len(resQ.Data.Results) > 0 {
 				list = processQuery(resQ, jobTotalCalls, jobId, job_id) // return []string{}
 			} else if err == nil && len(resQ.Data.Results) == 0 {
@@ -17,12 +17,17 @@ package main
 
 import (
 	rabbitpushgnotifier "SLALite/assessment/notifier/rabbitnotifier"
+	"os"
 
 	"github.com/prometheus/common/log"
 )
 
 func main() {
-	rq, err := rabbitpushgnotifier.Query("job_total_calls{function_name='test_function_1',executor_id='935882-0'}", "http://77.231.202.2:30001")
+	prometheusURL, ok := os.LookupEnv("SLA_PROMETHEUSURL")
+	if !ok {
+		log.Fatal("SLA_PROMETHEUSURL env var is not set")
+	}
+	rq, err := rabbitpushgnotifier.Query("job_total_calls{function_name='test_function_1',executor_id='935882-0'}", prometheusURL)
 	if err != nil {
 		log.Errorf("Error in call to Prometheus %s", err.Error())
 	}
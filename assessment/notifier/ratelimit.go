@@ -0,0 +1,362 @@
+/*
+Copyright 2020 Atos
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package notifier
+
+import (
+	assessment_model "SLALite/assessment/model"
+	"SLALite/model"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+const (
+	// NotificationWindowPropertyName is the config property name of the window
+	// where rate limits are applied and violations are digested
+	NotificationWindowPropertyName = "notificationWindow"
+	// AgreementRateLimitPropertyName is the config property name of the maximum number
+	// of notifications of an agreement in a window (0 is unlimited)
+	AgreementRateLimitPropertyName = "notificationAgreementLimit"
+	// SinkRateLimitPropertyName is the config property name of the maximum number
+	// of notifications sent to the notifier in a window (0 is unlimited)
+	SinkRateLimitPropertyName = "notificationSinkLimit"
+	// DigestPropertyName is the config property name that enables the digest mode:
+	// the notifications of an agreement in a window are aggregated in one notification
+	DigestPropertyName = "notificationDigest"
+
+	defaultNotificationWindow = "60s"
+)
+
+// Flusher is implemented by notifiers that buffer notifications.
+//
+// Flush sends the buffered notifications that are due. It is called at the end of
+// every assessment.
+type Flusher interface {
+	Flush()
+}
+
+type agreementWindow struct {
+	agreement model.Agreement
+	sent      int
+	// dropped since last notification sent; windowDropped in current window
+	dropped       int
+	windowDropped int
+	from          time.Time
+	pending       *assessment_model.Result
+	aggregated    int
+}
+
+type notification struct {
+	agreement model.Agreement
+	result    *assessment_model.Result
+}
+
+/*
+RateLimitingNotifier is a ViolationNotifier that limits the notifications passed
+to the next notifier, per agreement and in total, in fixed windows of time.
+
+Results over the limits are dropped, except their recoveries, that are always passed
+so that consumers can resolve their alerts.
+
+In digest mode, the results of an agreement are aggregated during the window and
+passed as one result when the window ends.
+
+The number of dropped or aggregated results is reported in Result.Summary.
+*/
+type RateLimitingNotifier struct {
+	window         time.Duration
+	agreementLimit int
+	sinkLimit      int
+	digest         bool
+	next           ViolationNotifier
+	now            func() time.Time
+
+	mutex      sync.Mutex
+	start      time.Time
+	sent       int
+	agreements map[string]*agreementWindow
+}
+
+// NewRateLimitingNotifier returns a ViolationNotifier that applies the rate limits
+// and digest mode in config to the next notifier.
+//
+// If no limits are set and digest mode is disabled, next is returned.
+func NewRateLimitingNotifier(config *viper.Viper, next ViolationNotifier) ViolationNotifier {
+	config.SetDefault(NotificationWindowPropertyName, defaultNotificationWindow)
+
+	window := config.GetDuration(NotificationWindowPropertyName)
+	agreementLimit := config.GetInt(AgreementRateLimitPropertyName)
+	sinkLimit := config.GetInt(SinkRateLimitPropertyName)
+	digest := config.GetBool(DigestPropertyName)
+
+	if window <= 0 || (agreementLimit <= 0 && sinkLimit <= 0 && !digest) {
+		return next
+	}
+	log.Infof("RateLimitingNotifier configuration\n"+
+		"\tWindow: %v\n"+
+		"\tAgreement limit: %d\n"+
+		"\tSink limit: %d\n"+
+		"\tDigest: %v\n",
+		window, agreementLimit, sinkLimit, digest)
+
+	return _newRateLimiting(window, agreementLimit, sinkLimit, digest, next, time.Now)
+}
+
+func _newRateLimiting(window time.Duration, agreementLimit, sinkLimit int, digest bool,
+	next ViolationNotifier, now func() time.Time) *RateLimitingNotifier {
+
+	return &RateLimitingNotifier{
+		window:         window,
+		agreementLimit: agreementLimit,
+		sinkLimit:      sinkLimit,
+		digest:         digest,
+		next:           next,
+		now:            now,
+		agreements:     map[string]*agreementWindow{},
+	}
+}
+
+// NotifyViolations implements ViolationNotifier interface
+func (n *RateLimitingNotifier) NotifyViolations(agreement *model.Agreement, result *assessment_model.Result) {
+	n.mutex.Lock()
+	now := n.now()
+	pending := n.roll(now)
+
+	aw, ok := n.agreements[agreement.Id]
+	if !ok {
+		aw = &agreementWindow{from: now}
+		n.agreements[agreement.Id] = aw
+	}
+	aw.agreement = *agreement
+
+	if n.digest {
+		if aw.pending == nil {
+			aw.pending = newEmptyResult()
+		}
+		mergeResult(aw.pending, result)
+		aw.aggregated++
+	} else if n.allowed(aw) {
+		aw.sent++
+		n.sent++
+		if aw.dropped > 0 {
+			result.Summary = &assessment_model.Summary{From: aw.from, To: now, Dropped: aw.dropped}
+		}
+		aw.dropped = 0
+		aw.from = now
+		pending = append(pending, notification{agreement: *agreement, result: result})
+	} else {
+		aw.dropped++
+		aw.windowDropped++
+		log.Debugf("RateLimitingNotifier. Dropped notification of agreement %s", agreement.Id)
+		if len(result.Recovered) > 0 {
+			recoveries := newEmptyResult()
+			recoveries.Recovered = result.Recovered
+			pending = append(pending, notification{agreement: *agreement, result: recoveries})
+		}
+	}
+	n.mutex.Unlock()
+
+	n.send(pending)
+}
+
+// Flush implements Flusher, sending the digests of the ended window
+func (n *RateLimitingNotifier) Flush() {
+	n.mutex.Lock()
+	pending := n.roll(n.now())
+	n.mutex.Unlock()
+
+	n.send(pending)
+}
+
+func (n *RateLimitingNotifier) allowed(aw *agreementWindow) bool {
+	if n.agreementLimit > 0 && aw.sent >= n.agreementLimit {
+		return false
+	}
+	if n.sinkLimit > 0 && n.sent >= n.sinkLimit {
+		return false
+	}
+	return true
+}
+
+// roll starts a new window if the current one has ended, returning the digests to send.
+// Must be called with the lock held.
+func (n *RateLimitingNotifier) roll(now time.Time) []notification {
+	if n.start.IsZero() {
+		n.start = now
+	}
+	if now.Before(n.start.Add(n.window)) {
+		return nil
+	}
+	n.start = now
+	n.sent = 0
+
+	result := []notification{}
+	for id, aw := range n.agreements {
+		if aw.windowDropped > 0 {
+			log.Warnf("RateLimitingNotifier. Dropped %d notifications of agreement %s", aw.windowDropped, id)
+		}
+		aw.sent = 0
+		aw.windowDropped = 0
+		if aw.pending == nil {
+			if aw.dropped == 0 {
+				delete(n.agreements, id)
+			}
+			continue
+		}
+		if n.sinkLimit > 0 && n.sent >= n.sinkLimit {
+			aw.dropped += aw.aggregated
+			log.Warnf("RateLimitingNotifier. Dropped digest of %d notifications of agreement %s",
+				aw.aggregated, id)
+		} else {
+			n.sent++
+			aw.pending.Summary = &assessment_model.Summary{
+				From:       aw.from,
+				To:         now,
+				Aggregated: aw.aggregated,
+				Dropped:    aw.dropped,
+			}
+			aw.dropped = 0
+			result = append(result, notification{agreement: aw.agreement, result: aw.pending})
+		}
+		aw.pending = nil
+		aw.aggregated = 0
+		aw.from = now
+	}
+	return result
+}
+
+/*
+Limiter counts the messages of each agreement and the total in fixed windows of
+time, with the limits of the RateLimitingNotifier.
+
+It is used by the notifiers that send several messages per notification (e.g. one
+per not started function), so that the limits also apply to those messages.
+A nil Limiter allows all the messages.
+*/
+type Limiter struct {
+	window         time.Duration
+	agreementLimit int
+	sinkLimit      int
+	now            func() time.Time
+
+	mutex      sync.Mutex
+	start      time.Time
+	sent       int
+	agreements map[string]int
+}
+
+// NewLimiter returns a Limiter with the window and limits in config, or nil if no
+// limits are set.
+func NewLimiter(config *viper.Viper) *Limiter {
+	config.SetDefault(NotificationWindowPropertyName, defaultNotificationWindow)
+
+	window := config.GetDuration(NotificationWindowPropertyName)
+	agreementLimit := config.GetInt(AgreementRateLimitPropertyName)
+	sinkLimit := config.GetInt(SinkRateLimitPropertyName)
+
+	if window <= 0 || (agreementLimit <= 0 && sinkLimit <= 0) {
+		return nil
+	}
+	return _newLimiter(window, agreementLimit, sinkLimit, time.Now)
+}
+
+func _newLimiter(window time.Duration, agreementLimit, sinkLimit int, now func() time.Time) *Limiter {
+	return &Limiter{
+		window:         window,
+		agreementLimit: agreementLimit,
+		sinkLimit:      sinkLimit,
+		now:            now,
+		agreements:     map[string]int{},
+	}
+}
+
+// Allow returns if a message of the agreement is under the limits, counting it if so
+func (l *Limiter) Allow(agreementID string) bool {
+	if l == nil {
+		return true
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := l.now()
+	if l.start.IsZero() || !now.Before(l.start.Add(l.window)) {
+		l.start = now
+		l.sent = 0
+		l.agreements = map[string]int{}
+	}
+	if l.agreementLimit > 0 && l.agreements[agreementID] >= l.agreementLimit {
+		return false
+	}
+	if l.sinkLimit > 0 && l.sent >= l.sinkLimit {
+		return false
+	}
+	l.agreements[agreementID]++
+	l.sent++
+	return true
+}
+
+func (n *RateLimitingNotifier) send(pending []notification) {
+	for i := range pending {
+		n.next.NotifyViolations(&pending[i].agreement, pending[i].result)
+	}
+}
+
+func newEmptyResult() *assessment_model.Result {
+	return &assessment_model.Result{
+		Violated:      map[string]assessment_model.EvaluationGtResult{},
+		Recovered:     map[string]model.Incident{},
+		Incidents:     map[string]model.Incident{},
+		LastValues:    map[string]assessment_model.ExpressionData{},
+		LastExecution: map[string]time.Time{},
+		Errors:        map[string]error{},
+		Budgets:       map[string]model.ErrorBudget{},
+		Pending:       map[string]model.Pending{},
+	}
+}
+
+// mergeResult aggregates src into dst. Violations are appended; the rest of values
+// are overwritten by the newer ones.
+func mergeResult(dst, src *assessment_model.Result) {
+	for gtname, gtresult := range src.Violated {
+		aux := dst.Violated[gtname]
+		aux.Metrics = append(aux.Metrics, gtresult.Metrics...)
+		aux.Violations = append(aux.Violations, gtresult.Violations...)
+		dst.Violated[gtname] = aux
+	}
+	for gtname, incident := range src.Recovered {
+		dst.Recovered[gtname] = incident
+	}
+	for gtname, incident := range src.Incidents {
+		dst.Incidents[gtname] = incident
+	}
+	for gtname, values := range src.LastValues {
+		dst.LastValues[gtname] = values
+	}
+	for gtname, t := range src.LastExecution {
+		dst.LastExecution[gtname] = t
+	}
+	for gtname, err := range src.Errors {
+		dst.Errors[gtname] = err
+	}
+	for gtname, budget := range src.Budgets {
+		dst.Budgets[gtname] = budget
+	}
+	for gtname, pending := range src.Pending {
+		dst.Pending[gtname] = pending
+	}
+}
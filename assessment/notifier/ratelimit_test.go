@@ -0,0 +1,175 @@
+/*
+Copyright 2020 Atos
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package notifier
+
+import (
+	assessment_model "SLALite/assessment/model"
+	"SLALite/model"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+type multirecorder struct {
+	results map[string][]*assessment_model.Result
+}
+
+func (n *multirecorder) NotifyViolations(agreement *model.Agreement, result *assessment_model.Result) {
+	n.results[agreement.Id] = append(n.results[agreement.Id], result)
+}
+
+type clock struct {
+	t time.Time
+}
+
+func (c *clock) now() time.Time {
+	return c.t
+}
+
+func (c *clock) advance(d time.Duration) {
+	c.t = c.t.Add(d)
+}
+
+func TestNewRateLimitingNotifier(t *testing.T) {
+	next := &multirecorder{}
+	config := viper.New()
+	if not := NewRateLimitingNotifier(config, next); not != next {
+		t.Errorf("Expected next notifier if no limits are set")
+	}
+	config.Set(DigestPropertyName, true)
+	if _, ok := NewRateLimitingNotifier(config, next).(*RateLimitingNotifier); !ok {
+		t.Errorf("Expected RateLimitingNotifier")
+	}
+}
+
+func TestRateLimits(t *testing.T) {
+	next := &multirecorder{results: map[string][]*assessment_model.Result{}}
+	c := &clock{t: time.Now()}
+	not := _newRateLimiting(time.Minute, 2, 3, false, next, c.now)
+
+	a1 := model.Agreement{Id: "a01"}
+	a2 := model.Agreement{Id: "a02"}
+	for i := 0; i < 3; i++ {
+		not.NotifyViolations(&a1, violatedResult("g1"))
+		c.advance(time.Second)
+	}
+	recovered := violatedResult("g1")
+	recovered.Recovered = map[string]model.Incident{"g2": {Guarantee: "g2"}}
+	not.NotifyViolations(&a2, violatedResult("g1"))
+	not.NotifyViolations(&a2, recovered)
+
+	if len(next.results["a01"]) != 2 {
+		t.Errorf("Unexpected notifications of a01 (agreement limit): %d", len(next.results["a01"]))
+	}
+	results := next.results["a02"]
+	if len(results) != 2 {
+		t.Fatalf("Unexpected notifications of a02 (sink limit): %d", len(results))
+	}
+	if len(results[1].Violated) != 0 || len(results[1].Recovered) != 1 {
+		t.Errorf("Expected only recoveries in notification: %v", results[1])
+	}
+
+	// new window
+	c.advance(time.Minute)
+	not.Flush()
+	not.NotifyViolations(&a1, violatedResult("g1"))
+	results = next.results["a01"]
+	if len(results) != 3 {
+		t.Fatalf("Unexpected notifications of a01 in new window: %d", len(results))
+	}
+	if sm := results[2].Summary; sm == nil || sm.Dropped != 1 {
+		t.Errorf("Unexpected summary: %v", sm)
+	}
+}
+
+func TestDigest(t *testing.T) {
+	next := &multirecorder{results: map[string][]*assessment_model.Result{}}
+	c := &clock{t: time.Now()}
+	start := c.t
+	not := _newRateLimiting(time.Minute, 0, 0, true, next, c.now)
+
+	a1 := model.Agreement{Id: "a01"}
+	not.NotifyViolations(&a1, violatedResult("g1"))
+	c.advance(time.Second)
+	not.NotifyViolations(&a1, violatedResult("g1"))
+	not.NotifyViolations(&a1, violatedResult("g2"))
+	not.Flush()
+	if len(next.results["a01"]) != 0 {
+		t.Fatalf("Unexpected notifications before window end: %d", len(next.results["a01"]))
+	}
+
+	c.advance(time.Minute)
+	not.Flush()
+	results := next.results["a01"]
+	if len(results) != 1 {
+		t.Fatalf("Unexpected notifications: %d", len(results))
+	}
+	digest := results[0]
+	if len(digest.Violated["g1"].Violations) != 2 || len(digest.Violated["g2"].Violations) != 1 {
+		t.Errorf("Unexpected digest: %v", digest.Violated)
+	}
+	if sm := digest.Summary; sm == nil || sm.Aggregated != 3 || !sm.From.Equal(start) {
+		t.Errorf("Unexpected summary: %v", sm)
+	}
+
+	// nothing to send in next window
+	c.advance(time.Minute)
+	not.Flush()
+	if len(next.results["a01"]) != 1 {
+		t.Errorf("Unexpected notifications: %d", len(next.results["a01"]))
+	}
+}
+
+func violatedResult(gtname string) *assessment_model.Result {
+	return &assessment_model.Result{
+		Violated: map[string]assessment_model.EvaluationGtResult{
+			gtname: {Violations: []model.Violation{newViolation(gtname)}},
+		},
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	if NewLimiter(viper.New()) != nil {
+		t.Errorf("Expected nil limiter if no limits are set")
+	}
+	var nilLimiter *Limiter
+	if !nilLimiter.Allow("a01") {
+		t.Errorf("Expected nil limiter to allow all messages")
+	}
+
+	c := &clock{t: time.Now()}
+	l := _newLimiter(time.Minute, 2, 3, c.now)
+	for _, tc := range []struct {
+		agreement string
+		allowed   bool
+	}{
+		{"a01", true},
+		{"a01", true},
+		{"a01", false},
+		{"a02", true},
+		{"a02", false},
+	} {
+		if actual := l.Allow(tc.agreement); actual != tc.allowed {
+			t.Errorf("Allow(%s): expected %v; actual %v", tc.agreement, tc.allowed, actual)
+		}
+	}
+
+	c.advance(time.Minute)
+	if !l.Allow("a01") {
+		t.Errorf("Expected message allowed in new window")
+	}
+}
@@ -19,6 +19,7 @@ import (
 	amodel "SLALite/assessment/model"
 	"SLALite/assessment/notifier"
 	"SLALite/model"
+	"SLALite/utils"
 	"bytes"
 	"encoding/json"
 	"net/http"
@@ -45,6 +46,15 @@ type violationInfo struct {
 	Client        model.Client      `json:"client"`
 	GuaranteeName string            `json:"guarantee_name"`
 	Violations    []model.Violation `json:"violations"`
+	Summary       *amodel.Summary   `json:"summary,omitempty"`
+}
+
+type recoveryInfo struct {
+	Type        string           `json:"type"`
+	AgreementID string           `json:"agremeent_id"`
+	Client      model.Client     `json:"client"`
+	Incidents   []model.Incident `json:"incidents"`
+	Summary     *amodel.Summary  `json:"summary,omitempty"`
 }
 
 // New constructs a REST Notifier
@@ -63,25 +73,42 @@ func _new(url string) notifier.ViolationNotifier {
 func logConfig(config *viper.Viper) {
 	log.Printf("RestNotifier configuration\n"+
 		"\tURL: %v\n",
-		config.GetString(NotificationURLPropertyName))
+		utils.MaskURL(config.GetString(NotificationURLPropertyName)))
 
 }
 
-/* Implements notifier.NotifyViolations */
+/*
+Implements notifier.NotifyViolations.
+
+Violations are sent in a message of type "violation"; incidents closed
+in a message of type "recovery". The summary of aggregated or dropped
+notifications, if any, is set in the first message sent.
+*/
 func (not _notifier) NotifyViolations(agreement *model.Agreement, result *amodel.Result) {
 
-	vs := result.GetViolations()
-	if len(vs) == 0 {
-		return
+	summary := result.Summary
+	if vs := result.GetViolations(); len(vs) > 0 {
+		not.send(violationInfo{
+			Type:        "violation",
+			AgreementID: agreement.Id,
+			Client:      agreement.Details.Client,
+			Violations:  vs,
+			Summary:     summary,
+		})
+		summary = nil
 	}
-
-	info := violationInfo{
-		Type:        "violation",
-		AgreementID: agreement.Id,
-		Client:      agreement.Details.Client,
-		Violations:  vs,
+	if incidents := result.GetRecoveries(); len(incidents) > 0 {
+		not.send(recoveryInfo{
+			Type:        "recovery",
+			AgreementID: agreement.Id,
+			Client:      agreement.Details.Client,
+			Incidents:   incidents,
+			Summary:     summary,
+		})
 	}
+}
 
+func (not _notifier) send(info interface{}) {
 	b := new(bytes.Buffer)
 	json.NewEncoder(b).Encode(info)
 
@@ -90,6 +117,6 @@ func (not _notifier) NotifyViolations(agreement *model.Agreement, result *amodel
 	if err != nil {
 		log.Errorf("RestNotifier error: %s", err)
 	} else {
-		log.Infof("RestNotifier. Sent violations: %v", info)
+		log.Infof("RestNotifier. Sent: %v", info)
 	}
 }
@@ -21,6 +21,7 @@ import (
 	"SLALite/assessment/monitor/simpleadapter"
 	"SLALite/model"
 	"SLALite/utils"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"os"
@@ -71,6 +72,46 @@ func TestSendEmpty(t *testing.T) {
 	not.NotifyViolations(&agreement, &amodel.Result{})
 }
 
+func TestSendRecovery(t *testing.T) {
+	Init()
+	end := time.Now()
+	incident := model.Incident{
+		AgreementId: agreement.Id,
+		Guarantee:   "g1",
+		Start:       end.Add(-time.Minute),
+		End:         &end,
+		Duration:    60,
+		Violations:  2,
+	}
+	result := amodel.Result{
+		Recovered: map[string]model.Incident{"g1": incident},
+		Summary:   &amodel.Summary{From: end.Add(-time.Minute), To: end, Dropped: 3},
+	}
+
+	types := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var info recoveryInfo
+		if err := json.NewDecoder(r.Body).Decode(&info); err != nil {
+			t.Errorf("Error decoding request: %s", err.Error())
+		}
+		types = append(types, info.Type)
+		if len(info.Incidents) != 1 || info.Incidents[0].Violations != 2 {
+			t.Errorf("Unexpected incidents: %v", info.Incidents)
+		}
+		if info.Summary == nil || info.Summary.Dropped != 3 {
+			t.Errorf("Unexpected summary: %v", info.Summary)
+		}
+		w.Write([]byte("OK"))
+	}))
+	defer server.Close()
+
+	not := _new(server.URL)
+	not.NotifyViolations(&agreement, &result)
+	if len(types) != 1 || types[0] != "recovery" {
+		t.Errorf("Unexpected notifications: %v", types)
+	}
+}
+
 func TestSendWrong(t *testing.T) {
 	Init()
 	cfg := assessment.Config{Adapter: ma, Now: time.Now()}
@@ -0,0 +1,196 @@
+/*
+Copyright 2020 Atos
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package assessment
+
+/*
+This file contains the evaluation of guarantee terms with an Objective (SLOs),
+whose error budget is tracked in the assessment of the guarantee.
+*/
+
+import (
+	amodel "SLALite/assessment/model"
+	"SLALite/model"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// bucketsPerWindow is the number of buckets of a rolling window. The points are
+// counted by bucket, so the window moves forward a bucket at a time.
+const bucketsPerWindow = 30
+
+// point is the result of the evaluation of the constraint at a point in time
+type point struct {
+	t      time.Time
+	ok     bool
+	values amodel.ExpressionData
+}
+
+// countPoints returns the buckets of a rolling window of seconds after adding
+// the points, and dropping the buckets that are out of the window at now.
+// It also returns the number of good and total points in the window.
+func countPoints(buckets []model.Bucket, window int64, points []point, now time.Time) ([]model.Bucket, int64, int64) {
+	size := time.Duration(window) * time.Second / bucketsPerWindow
+	if size < time.Second {
+		size = time.Second
+	}
+	from := now.Add(-time.Duration(window) * time.Second)
+
+	result := make([]model.Bucket, 0, len(buckets)+1)
+	for _, b := range buckets {
+		if b.Start.Add(size).After(from) {
+			result = append(result, b)
+		}
+	}
+	for _, p := range points {
+		start := p.t.Truncate(size)
+		if !start.Add(size).After(from) {
+			continue
+		}
+		i := len(result)
+		for i > 0 && result[i-1].Start.After(start) {
+			i--
+		}
+		if i == 0 || !result[i-1].Start.Equal(start) {
+			result = append(result, model.Bucket{})
+			copy(result[i+1:], result[i:])
+			result[i] = model.Bucket{Start: start}
+			i++
+		}
+		result[i-1].Total++
+		if p.ok {
+			result[i-1].Good++
+		}
+	}
+
+	var good, total int64
+	for _, b := range result {
+		good += b.Good
+		total += b.Total
+	}
+	return result, good, total
+}
+
+// evaluateObjective returns the error budget of a guarantee term with an Objective
+// after an evaluation, and the violations raised: when the budget gets exhausted
+// and when a burn rate starts firing.
+//
+// The values of the violations are the last failed values, or the last values
+// if there are no failed values in the evaluation.
+func evaluateObjective(a *model.Agreement, gt model.Guarantee, points []point,
+	failed amodel.GuaranteeData, last amodel.ExpressionData, now time.Time) (model.ErrorBudget, []model.Violation) {
+
+	o := gt.Objective
+	previous := a.Assessment.GetGuarantee(gt.Name).Budget
+	if previous == nil {
+		previous = &model.ErrorBudget{}
+	}
+	allowed := 1 - o.Target
+
+	budget := model.ErrorBudget{}
+	budget.Buckets, budget.Good, budget.Total = countPoints(previous.Buckets, o.Window, points, now)
+	budget.Compliance = 1
+	if budget.Total > 0 {
+		budget.Compliance = float64(budget.Good) / float64(budget.Total)
+	}
+	budget.Remaining = 1 - (1-budget.Compliance)/allowed
+
+	tuple := last
+	if len(failed) > 0 {
+		tuple = failed[len(failed)-1]
+	}
+	cal := a.Details.GetCalendar(gt)
+	violations := []model.Violation{}
+	violate := func(fields map[string]interface{}) {
+		if len(tuple) == 0 {
+			return
+		}
+		values := make([]model.MetricValue, 0, len(tuple))
+		for _, m := range tuple {
+			values = append(values, m)
+		}
+		d := tupleTime(tuple)
+		violations = append(violations, model.Violation{
+			AgreementId: a.Id,
+			Guarantee:   gt.Name,
+			Datetime:    d,
+			Constraint:  gt.Constraint,
+			Values:      values,
+			Fields:      fields,
+			Excluded:    excluded(cal, d),
+		})
+	}
+
+	if budget.Exhausted() && !previous.Exhausted() {
+		log.Debugf("Error budget of %s[%s] exhausted: %v", a.Id, gt.Name, budget.Remaining)
+		violate(map[string]interface{}{
+			"objective":  "budget",
+			"compliance": budget.Compliance,
+			"remaining":  budget.Remaining,
+		})
+	}
+
+	budget.BurnRates = make([]model.BurnRateState, 0, len(o.BurnRates))
+	for _, br := range o.BurnRates {
+		state := model.BurnRateState{Window: br.Window}
+		for _, aux := range previous.BurnRates {
+			if aux.Window == br.Window {
+				state = aux
+				break
+			}
+		}
+		wasFiring := state.Firing
+		var good, total int64
+		state.Buckets, good, total = countPoints(state.Buckets, br.Window, points, now)
+		state.Rate = 0
+		if total > 0 {
+			state.Rate = (float64(total-good) / float64(total)) / allowed
+		}
+		state.Firing = total > 0 && state.Rate >= br.Rate
+		if state.Firing && !wasFiring {
+			log.Debugf("Burn rate of %s[%s] firing: %v in %ds", a.Id, gt.Name, state.Rate, br.Window)
+			violate(map[string]interface{}{
+				"objective":  "burn_rate",
+				"burn_rate":  state.Rate,
+				"threshold":  br.Rate,
+				"window":     br.Window,
+				"remaining":  budget.Remaining,
+				"compliance": budget.Compliance,
+			})
+		}
+		budget.BurnRates = append(budget.BurnRates, state)
+	}
+	return budget, violations
+}
+
+// objectiveIncident returns the failed values and recovery values, as expected by
+// EvaluateGtIncident, of a guarantee term with an Objective: the term fails while
+// the budget is exhausted.
+func objectiveIncident(budget model.ErrorBudget, failed amodel.GuaranteeData,
+	last amodel.ExpressionData) (amodel.GuaranteeData, amodel.ExpressionData) {
+
+	if !budget.Exhausted() {
+		return amodel.GuaranteeData{}, last
+	}
+	if len(failed) > 0 {
+		return failed[len(failed)-1:], nil
+	}
+	if last != nil {
+		return amodel.GuaranteeData{last}, nil
+	}
+	return amodel.GuaranteeData{}, nil
+}
@@ -0,0 +1,124 @@
+/*
+Copyright 2020 Atos
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package assessment
+
+import (
+	assessment_model "SLALite/assessment/model"
+	"SLALite/assessment/monitor/simpleadapter"
+	"SLALite/model"
+	"math"
+	"testing"
+	"time"
+)
+
+var tb = time.Date(2019, 10, 29, 10, 0, 0, 0, time.UTC)
+
+// minute returns n values of m in the minute before end, where the first bad ones are negative
+func minute(end time.Time, n int, bad int) assessment_model.GuaranteeData {
+	result := make(assessment_model.GuaranteeData, 0, n)
+	for i := 0; i < n; i++ {
+		v := 1.0
+		if i < bad {
+			v = -1.0
+		}
+		t := end.Add(time.Duration(i-n) * time.Minute / time.Duration(n))
+		result = append(result, assessment_model.ExpressionData{
+			"m": model.MetricValue{Key: "m", Value: v, DateTime: t},
+		})
+	}
+	return result
+}
+
+func TestCountPoints(t *testing.T) {
+	points := []point{
+		{t: tb.Add(-50 * time.Second), ok: true},
+		{t: tb.Add(-31 * time.Second), ok: false},
+		{t: tb.Add(-29 * time.Second), ok: true},
+		{t: tb.Add(-5 * time.Minute), ok: true}, /* out of window */
+	}
+	/* window of 60s: 2s buckets */
+	buckets, good, total := countPoints(nil, 60, points, tb)
+	if len(buckets) != 3 || good != 2 || total != 3 {
+		t.Errorf("Unexpected count: %v, %d, %d", buckets, good, total)
+	}
+	for i := 1; i < len(buckets); i++ {
+		if !buckets[i-1].Start.Before(buckets[i].Start) {
+			t.Errorf("Buckets not sorted: %v", buckets)
+		}
+	}
+
+	buckets, good, total = countPoints(buckets, 60, []point{{t: tb.Add(-50 * time.Second), ok: false}}, tb)
+	if len(buckets) != 3 || good != 2 || total != 4 {
+		t.Errorf("Unexpected count: %v, %d, %d", buckets, good, total)
+	}
+
+	/* 30s later, the first two points are out of the window */
+	buckets, good, total = countPoints(buckets, 60, nil, tb.Add(30*time.Second))
+	if len(buckets) != 1 || good != 1 || total != 1 {
+		t.Errorf("Unexpected count: %v, %d, %d", buckets, good, total)
+	}
+}
+
+func TestAssessAgreementWithObjective(t *testing.T) {
+	a := createAgreement("aslo01", p1, c2, "Agreement aslo01", "m >= 0")
+	a.State = model.STARTED
+	a.Details.Guarantees[0].Objective = &model.Objective{
+		Target: 0.9,
+		Window: 3600,
+		BurnRates: []model.BurnRate{
+			{Rate: 1.2, Window: 600},
+		},
+	}
+
+	for i, c := range []struct {
+		bad        int
+		violations int
+		remaining  float64
+		firing     bool
+		incident   bool
+	}{
+		{bad: 0, violations: 0, remaining: 1},
+		{bad: 1, violations: 0, remaining: 0.5},
+		{bad: 3, violations: 2, remaining: -1.0 / 3, firing: true, incident: true},
+		{bad: 1, violations: 0, remaining: -0.25, firing: true, incident: true},
+		{bad: 0, violations: 0, remaining: 0, incident: false},
+	} {
+		now := tb.Add(time.Duration(i+1) * time.Minute)
+		ma := simpleadapter.New(minute(now, 10, c.bad))
+		result := AssessAgreement(&a, Config{Adapter: ma, Now: now})
+
+		ag := a.Assessment.GetGuarantee("TestGuarantee")
+		if ag.Budget == nil {
+			t.Fatalf("%d. Budget not set", i)
+		}
+		if actual := len(result.Violated["TestGuarantee"].Violations); actual != c.violations {
+			t.Errorf("%d. Expected %d violations; Actual: %d", i, c.violations, actual)
+		}
+		if math.Abs(ag.Budget.Remaining-c.remaining) > 1e-9 {
+			t.Errorf("%d. Expected remaining budget %v; Actual: %v", i, c.remaining, ag.Budget.Remaining)
+		}
+		if ag.Budget.Total != int64(10*(i+1)) {
+			t.Errorf("%d. Unexpected number of points: %d", i, ag.Budget.Total)
+		}
+		if len(ag.Budget.BurnRates) != 1 || ag.Budget.BurnRates[0].Firing != c.firing {
+			t.Errorf("%d. Unexpected burn rates: %v", i, ag.Budget.BurnRates)
+		}
+		if incident := ag.Incident != nil && ag.Incident.IsOpen(); incident != c.incident {
+			t.Errorf("%d. Expected open incident: %v; Actual: %v", i, c.incident, ag.Incident)
+		}
+	}
+}
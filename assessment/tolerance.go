@@ -0,0 +1,77 @@
+/*
+Copyright 2020 Atos
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package assessment
+
+/*
+This file contains the evaluation of guarantee terms with a Tolerance, whose
+failures only raise violations if they persist.
+*/
+
+import (
+	amodel "SLALite/assessment/model"
+	"SLALite/model"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// reached returns if a failure has reached the tolerance at t
+func reached(tol *model.Tolerance, pending *model.Pending, t time.Time) bool {
+	return pending.Count >= tol.Count &&
+		!t.Before(pending.Since.Add(time.Duration(tol.Duration)*time.Second))
+}
+
+// applyTolerance returns the failed values that raise violations in a guarantee term
+// with a Tolerance, i.e., the ones of a failure that has reached the tolerance; the
+// first values that fulfill the constraint after them, as the recovery values of
+// evaluateGuarantee; and the pending failure after the evaluation (nil if the last
+// evaluation succeeded).
+//
+// The pending failure of the previous evaluation continues if the first point failed.
+func applyTolerance(a *model.Agreement, gt model.Guarantee, previous *model.Pending,
+	points []point) (amodel.GuaranteeData, amodel.ExpressionData, *model.Pending) {
+
+	var pending *model.Pending
+	if previous != nil {
+		aux := *previous
+		pending = &aux
+	}
+	failed := make(amodel.GuaranteeData, 0, 1)
+	var recovery amodel.ExpressionData
+	for _, p := range points {
+		if p.ok {
+			if recovery == nil {
+				recovery = p.values
+			}
+			pending = nil
+			continue
+		}
+		if pending == nil {
+			pending = &model.Pending{Since: p.t}
+		}
+		pending.Count++
+		if !pending.Firing && reached(gt.For, pending, p.t) {
+			log.Debugf("Failure of %s[%s] firing: %d evaluations since %s", a.Id, gt.Name, pending.Count, pending.Since)
+			pending.Firing = true
+		}
+		if pending.Firing {
+			failed = append(failed, p.values)
+			recovery = nil
+		}
+	}
+	return failed, recovery, pending
+}
@@ -0,0 +1,87 @@
+/*
+Copyright 2020 Atos
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package assessment
+
+import (
+	"SLALite/assessment/monitor/simpleadapter"
+	"SLALite/model"
+	"testing"
+	"time"
+)
+
+type toleranceTick struct {
+	n          int
+	bad        int
+	violations int
+	count      int /* count of the pending failure; 0 if none */
+	firing     bool
+	incident   bool
+}
+
+func testTolerance(t *testing.T, tol model.Tolerance, ticks []toleranceTick) {
+	a := createAgreement("atol01", p1, c2, "Agreement atol01", "m >= 0")
+	a.State = model.STARTED
+	a.Details.Guarantees[0].For = &tol
+
+	for i, c := range ticks {
+		now := tb.Add(time.Duration(i+1) * time.Minute)
+		ma := simpleadapter.New(minute(now, c.n, c.bad))
+		result := AssessAgreement(&a, Config{Adapter: ma, Now: now})
+
+		ag := a.Assessment.GetGuarantee("TestGuarantee")
+		if actual := len(result.Violated["TestGuarantee"].Violations); actual != c.violations {
+			t.Errorf("%d. Expected %d violations; Actual: %d", i, c.violations, actual)
+		}
+		if c.count == 0 && ag.Pending != nil {
+			t.Errorf("%d. Unexpected pending failure: %v", i, ag.Pending)
+		}
+		if c.count > 0 && (ag.Pending == nil || ag.Pending.Count != c.count || ag.Pending.Firing != c.firing) {
+			t.Errorf("%d. Expected pending failure of %d (firing=%v); Actual: %v", i, c.count, c.firing, ag.Pending)
+		}
+		if incident := ag.Incident != nil && ag.Incident.IsOpen(); incident != c.incident {
+			t.Errorf("%d. Expected open incident: %v; Actual: %v", i, c.incident, ag.Incident)
+		}
+	}
+}
+
+func TestToleranceCount(t *testing.T) {
+	testTolerance(t, model.Tolerance{Count: 3}, []toleranceTick{
+		{n: 2, bad: 2, count: 2},
+		{n: 3, bad: 2, violations: 2},
+		{n: 1, bad: 1, count: 1},
+		{n: 4, bad: 4, violations: 3, count: 5, firing: true, incident: true},
+		{n: 2, bad: 1, violations: 1},
+	})
+}
+
+func TestToleranceDuration(t *testing.T) {
+	/* six values each minute, 10s apart */
+	testTolerance(t, model.Tolerance{Duration: 90}, []toleranceTick{
+		{n: 6, bad: 6, count: 6},
+		{n: 6, bad: 6, violations: 3, count: 12, firing: true, incident: true},
+		{n: 6, bad: 0},
+		{n: 3, bad: 3, count: 3},
+	})
+}
+
+func TestToleranceCountAndDuration(t *testing.T) {
+	testTolerance(t, model.Tolerance{Count: 2, Duration: 60}, []toleranceTick{
+		{n: 1, bad: 1, count: 1},
+		{n: 1, bad: 1, violations: 1, count: 2, firing: true, incident: true},
+		{n: 1, bad: 0},
+	})
+}
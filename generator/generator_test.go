@@ -80,6 +80,39 @@ func TestGenerateAgreement(t *testing.T) {
 	}
 }
 
+func TestGenerateAgreementTransient(t *testing.T) {
+	tmpl := tpl
+	tmpl.Details.Guarantees = append([]model.Guarantee(nil), tpl.Details.Guarantees...)
+	tmpl.Details.Guarantees[0].Transient = "{{.T}}"
+
+	genmodel := Model{
+		Template: tmpl,
+		Variables: map[string]interface{}{
+			"provider":      model.Provider{Id: "<provider-id>", Name: "<provider-name>"},
+			"client":        model.Client{Id: "<client-id>", Name: "<client-name>"},
+			"M":             "500",
+			"N":             "0.9",
+			"T":             "2h",
+			"agreementname": "<a-name>",
+		},
+	}
+	if errs := tmpl.Validate(val, model.CREATE); len(errs) != 0 {
+		t.Fatalf("Unexpected errors validating template: %v", errs)
+	}
+	a, err := Do(&genmodel, val, false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if a.Details.Guarantees[0].Transient != "2h" {
+		t.Errorf("Unexpected transient: %s", a.Details.Guarantees[0].Transient)
+	}
+
+	genmodel.Variables["T"] = "2 hours"
+	if _, err = Do(&genmodel, val, false); err == nil || !IsErrValidation(err) {
+		t.Errorf("Unexpected err. Expected: ErrValidation; actual: %v", err)
+	}
+}
+
 func TestGenerateAgreementMissingFields(t *testing.T) {
 	genmodel := Model{
 		Template: tpl,
@@ -19,8 +19,12 @@ import (
 	"SLALite/assessment"
 	"SLALite/assessment/monitor"
 	"SLALite/assessment/monitor/genericadapter"
+	"SLALite/assessment/monitor/influxdb"
 	"SLALite/assessment/monitor/prometheus"
+	"SLALite/assessment/monitor/push"
+	"SLALite/assessment/monitor/replay"
 	"SLALite/assessment/notifier"
+	"SLALite/assessment/notifier/kafka"
 	"SLALite/assessment/notifier/lognotifier"
 	rabbitpushgnotifier "SLALite/assessment/notifier/rabbitnotifier"
 	"SLALite/assessment/notifier/rest"
@@ -53,6 +57,9 @@ func main() {
 
 	log.Infof("Running SLALite %s compiled on %s", version, date)
 	config := createMainConfig(configFile, configPath, configBasename)
+	if err := utils.LoadSecretsFile(config); err != nil {
+		log.Fatal(err.Error())
+	}
 	logMainConfig(config)
 
 	singlefile := config.GetBool(utils.SingleFilePropertyName)
@@ -80,37 +87,95 @@ func main() {
 	}
 
 	validator := model.NewDefaultValidator(config.GetBool(utils.ExternalIDsPropertyName), true)
+	if !config.GetBool(utils.DirectMetricsPropertyName) {
+		validator = model.NewStrictValidator(config.GetBool(utils.ExternalIDsPropertyName), true)
+	}
+	if config.GetString(utils.AdapterTypePropertyName) == prometheus.Name {
+		validator = prometheus.NewValidator(validator)
+	}
 
-	adapter := buildAdapter(config)
+	var buffer *push.Buffer
+	if config.GetString(utils.AdapterTypePropertyName) == push.Name {
+		buffer = push.New(config)
+	}
+	adapter := buildAdapter(config, buffer)
 
 	notifier := buildNotifier(config)
+	notifier = buildEnrichingNotifier(config, notifier)
+	notifier = buildRateLimitingNotifier(config, notifier)
 
 	repo, _ = validation.New(repo, validator)
 	if repo != nil {
 		a, _ := NewApp(config, repo, validator)
+		if buffer != nil {
+			buffer.Register(a.Router)
+		}
 		aCfg := assessment.Config{
 			Repo:      repo,
 			Adapter:   adapter,
 			Notifier:  notifier,
 			Transient: trasientTime,
+			Clock:     utils.SystemClock,
 		}
 		go createValidationThread(checkPeriod, aCfg)
 		a.Run()
 	}
 }
 
-func buildAdapter(config *viper.Viper) monitor.MonitoringAdapter {
+func buildAdapter(config *viper.Viper, buffer *push.Buffer) monitor.MonitoringAdapter {
 	aType := config.GetString(utils.AdapterTypePropertyName)
+	aggregation := model.AggregationProcessor(config.GetString(utils.AggregationPropertyName))
+	if aggregation != model.LOCAL && aggregation != model.MONITORING {
+		log.Fatalf("Error creating adapter: invalid %s '%s'", utils.AggregationPropertyName, aggregation)
+	}
+	/*
+	 * only the Prometheus adapter pushes aggregations down to the monitoring;
+	 * the rest aggregate locally whatever the processor of the variables
+	 */
+	process := genericadapter.Aggregate
+	if aType == prometheus.Name {
+		process = genericadapter.Processor(aggregation)
+	} else if aggregation == model.MONITORING {
+		log.Warnf("The %s adapter does not support %s '%s'; aggregations are performed locally",
+			aType, utils.AggregationPropertyName, aggregation)
+	}
 	switch aType {
 	case prometheus.Name:
+		retriever, err := prometheus.New(config)
+		if err != nil {
+			log.Fatal("Error creating adapter: ", err.Error())
+		}
 		adapter := genericadapter.New(
-			prometheus.New(config).Retrieve(),
-			genericadapter.Identity)
+			retriever.Retrieve(),
+			process)
+		return adapter
+	case influxdb.Name:
+		retriever, err := influxdb.New(config)
+		if err != nil {
+			log.Fatal("Error creating adapter: ", err.Error())
+		}
+		adapter := genericadapter.New(
+			retriever.Retrieve(),
+			process)
+		return adapter
+	case replay.Name:
+		retriever, err := replay.New(config)
+		if err != nil {
+			log.Fatal("Error creating adapter: ", err.Error())
+		}
+		adapter := genericadapter.New(
+			retriever.Retrieve(),
+			process)
+		return adapter
+	case push.Name:
+		adapter := genericadapter.New(
+			buffer.Retrieve(),
+			process)
 		return adapter
 	default:
 		adapter := genericadapter.New(
 			genericadapter.DummyRetriever{Size: 3}.Retrieve(),
-			genericadapter.Identity)
+			process)
 		return adapter
 	}
 
@@ -123,7 +188,16 @@ func buildNotifier(config *viper.Viper) notifier.ViolationNotifier {
 		notifier := rest.New(config)
 		return notifier
 	case rabbitpushgnotifier.Name:
-		notifier := rabbitpushgnotifier.New(config)
+		notifier, err := rabbitpushgnotifier.New(config)
+		if err != nil {
+			log.Fatal("Error creating notifier: ", err.Error())
+		}
+		return notifier
+	case kafka.Name:
+		notifier, err := kafka.New(config)
+		if err != nil {
+			log.Fatal("Error creating notifier: ", err.Error())
+		}
 		return notifier
 	default:
 		notifier := lognotifier.LogNotifier{}
@@ -132,6 +206,31 @@ func buildNotifier(config *viper.Viper) notifier.ViolationNotifier {
 
 }
 
+func buildEnrichingNotifier(config *viper.Viper, next notifier.ViolationNotifier) notifier.ViolationNotifier {
+	prometheusURL, err := utils.GetSecret(config, prometheus.PrometheusURLPropertyName)
+	if err != nil {
+		log.Fatal("Error creating enrichers: ", err.Error())
+	}
+	// without a Prometheus URL, only the URLs set in agreements are queried, with plain requests
+	var clients *prometheus.Clients
+	if prometheusURL != "" {
+		clients, err = prometheus.NewClients(config)
+		if err != nil {
+			log.Fatal("Error creating enrichers: ", err.Error())
+		}
+	}
+	registry := notifier.NewEnricherRegistry()
+	registry.Register(rabbitpushgnotifier.NotStartedEnricherName,
+		rabbitpushgnotifier.NotStartedEnricher{PrometheusURL: prometheusURL, Clients: clients})
+	registry.BindAll(config.GetStringMapStringSlice(notifier.EnrichersPropertyName))
+
+	return notifier.NewEnrichingNotifier(registry, next)
+}
+
+func buildRateLimitingNotifier(config *viper.Viper, next notifier.ViolationNotifier) notifier.ViolationNotifier {
+	return notifier.NewRateLimitingNotifier(config, next)
+}
+
 func asSeconds(config *viper.Viper, field string) time.Duration {
 
 	raw := config.GetString(field)
@@ -160,7 +259,12 @@ func createMainConfig(file *string, paths *string, basename *string) *viper.Vipe
 	config.SetDefault(utils.RepositoryTypePropertyName, utils.DefaultRepositoryType)
 	config.SetDefault(utils.AdapterTypePropertyName, utils.DefaultAdapterType)
 	config.SetDefault(utils.ExternalIDsPropertyName, utils.DefaultExternalIDs)
+	config.SetDefault(utils.DirectMetricsPropertyName, utils.DefaultDirectMetrics)
 	config.SetDefault(utils.TransientTimePropertyName, utils.DefaultTransientTime)
+	config.SetDefault(utils.AggregationPropertyName, utils.DefaultAggregation)
+	config.SetDefault(notifier.EnrichersPropertyName, map[string][]string{
+		"notstarted": []string{rabbitpushgnotifier.NotStartedEnricherName},
+	})
 
 	if *file != "" {
 		config.SetConfigFile(*file)
@@ -186,17 +290,22 @@ func logMainConfig(config *viper.Viper) {
 	adapterType := config.GetString(utils.AdapterTypePropertyName)
 	notifierType := config.GetString(utils.NotifierTypePropertyName)
 	externalIDs := config.GetBool(utils.ExternalIDsPropertyName)
+	directMetrics := config.GetBool(utils.DirectMetricsPropertyName)
 	transientTime := asSeconds(config, utils.TransientTimePropertyName)
+	aggregation := config.GetString(utils.AggregationPropertyName)
 
 	log.Infof("SLALite initialization\n"+
 		"\tConfigfile: %s\n"+
 		"\tRepository type: %s\n"+
 		"\tAdapter type: %s\n"+
+		"\tAggregation: %s\n"+
 		"\tNotifier type: %s\n"+
 		"\tExternal IDs: %v\n"+
+		"\tDirect metrics: %v\n"+
 		"\tTransient time: %v\n"+
 		"\tCheck period:%v\n",
-		config.ConfigFileUsed(), repoType, adapterType, notifierType, externalIDs, transientTime, checkPeriod)
+		config.ConfigFileUsed(), repoType, adapterType, aggregation, notifierType, externalIDs, directMetrics,
+		transientTime, checkPeriod)
 
 	caPath := config.GetString(utils.CAPathPropertyName)
 	if caPath != "" {
@@ -207,12 +316,7 @@ func logMainConfig(config *viper.Viper) {
 func createValidationThread(checkPeriod time.Duration, cfg assessment.Config) {
 
 	ticker := time.NewTicker(checkPeriod)
-
-	for {
-		<-ticker.C
-		cfg.Now = time.Now()
-		assessment.AssessActiveAgreements(cfg)
-	}
+	assessment.Loop(cfg, ticker.C)
 }
 
 func validateProviders(repo model.IRepository) {
@@ -642,10 +642,165 @@ func testCreateTemplate(t *testing.T) {
 	}
 }
 
+/********************************************************************
+*****************FUNCTIONS******************************************
+********************************************************************/
+
+func TestGetFunctions(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/functions", nil)
+	res := request(req)
+	checkStatus(t, http.StatusOK, res.Code)
+
+	var functions []struct {
+		Name        string `json:"name"`
+		Signature   string `json:"signature"`
+		Description string `json:"description"`
+	}
+	_ = json.NewDecoder(res.Body).Decode(&functions)
+	names := map[string]bool{}
+	for _, f := range functions {
+		if f.Signature == "" || f.Description == "" {
+			t.Errorf("Function not documented: %v", f)
+		}
+		names[f.Name] = true
+	}
+	for _, name := range []string{"timeNow", "between", "labelMatches"} {
+		if !names[name] {
+			t.Errorf("Expected function %s in %v", name, functions)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	validate := func(body []byte) (int, ValidationResult) {
+		var result ValidationResult
+		req, _ := http.NewRequest("POST", "/validate", bytes.NewBuffer(body))
+		res := request(req)
+		_ = json.NewDecoder(res.Body).Decode(&result)
+		return res.Code, result
+	}
+
+	ag := createAgreement("validate01", p1, c2, "Agreement validate01", nil)
+	body, _ := json.Marshal(ag)
+	code, result := validate(body)
+	checkStatus(t, http.StatusOK, code)
+	if !result.Valid || len(result.Errors) != 0 {
+		t.Errorf("Expected valid agreement. Actual: %v", result)
+	}
+	if _, err := repo.GetAgreement(ag.Id); err == nil {
+		t.Errorf("Validated agreement must not be stored")
+	}
+
+	ag.Name = ""
+	ag.Details.Guarantees[0].Constraint = "test_value >"
+	body, _ = json.Marshal(ag)
+	code, result = validate(body)
+	checkStatus(t, http.StatusOK, code)
+	/* empty name, names do not match, constraint */
+	if result.Valid || len(result.Errors) != 3 {
+		t.Fatalf("Expected three errors. Actual: %v", result)
+	}
+	for _, e := range result.Errors {
+		if e.Field == "" && e.Position != -1 {
+			t.Errorf("Unexpected position of error: %v", e)
+		}
+		if e.Field != "" && e.Position != len("test_value >") {
+			t.Errorf("Unexpected position of error: %v", e)
+		}
+	}
+
+	body, _ = json.Marshal(t1)
+	code, result = validate(body)
+	checkStatus(t, http.StatusOK, code)
+	if !result.Valid {
+		t.Errorf("Expected valid template. Actual: %v", result)
+	}
+
+	code, _ = validate([]byte("{"))
+	checkStatus(t, http.StatusBadRequest, code)
+}
+
+/********************************************************************
+*****************MAINTENANCE WINDOWS*********************************
+********************************************************************/
+
+func TestMaintenanceWindows(t *testing.T) {
+	ag := createAgreement("maint01", p1, c2, "Agreement maint01", nil)
+	if _, err := repo.CreateAgreement(&ag); err != nil {
+		t.Fatalf("Error creating agreement: %v", err)
+	}
+	post := func(path string, window model.MaintenanceWindow) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(window)
+		req, _ := http.NewRequest("POST", path, bytes.NewBuffer(body))
+		return request(req)
+	}
+	start := time.Date(2020, 3, 1, 22, 0, 0, 0, time.UTC)
+
+	res := post("/agreements/maint01/maintenance", model.MaintenanceWindow{Start: start, End: start.Add(2 * time.Hour)})
+	checkStatus(t, http.StatusCreated, res.Code)
+	var created model.MaintenanceWindow
+	_ = json.NewDecoder(res.Body).Decode(&created)
+	if created.Id == "" || !created.Start.Equal(start) {
+		t.Errorf("Unexpected maintenance window: %v", created)
+	}
+
+	res = post("/agreements/maint01/maintenance", created)
+	checkStatus(t, http.StatusConflict, res.Code)
+
+	res = post("/agreements/maint01/maintenance", model.MaintenanceWindow{Start: start, End: start})
+	checkStatus(t, http.StatusBadRequest, res.Code)
+
+	overlapping := model.MaintenanceWindow{Start: start.Add(time.Hour), End: start.Add(3 * time.Hour)}
+	res = post("/agreements/maint01/maintenance", overlapping)
+	checkStatus(t, http.StatusBadRequest, res.Code)
+
+	res = post("/agreements/doesnotexist/maintenance", model.MaintenanceWindow{Start: start, End: start.Add(time.Hour)})
+	checkStatus(t, http.StatusNotFound, res.Code)
+
+	req, _ := http.NewRequest("GET", "/agreements/maint01/maintenance", nil)
+	res = request(req)
+	checkStatus(t, http.StatusOK, res.Code)
+	var windows []model.MaintenanceWindow
+	_ = json.NewDecoder(res.Body).Decode(&windows)
+	if len(windows) != 1 || windows[0].Id != created.Id {
+		t.Errorf("Unexpected maintenance windows: %v", windows)
+	}
+
+	req, _ = http.NewRequest("DELETE", "/agreements/maint01/maintenance/"+created.Id, nil)
+	res = request(req)
+	checkStatus(t, http.StatusNoContent, res.Code)
+	if stored, _ := repo.GetAgreement("maint01"); len(stored.Details.Calendar.Maintenance) != 0 {
+		t.Errorf("Maintenance window not deleted: %v", stored.Details.Calendar)
+	}
+
+	req, _ = http.NewRequest("DELETE", "/agreements/maint01/maintenance/"+created.Id, nil)
+	res = request(req)
+	checkStatus(t, http.StatusNotFound, res.Code)
+}
+
 /********************************************************************
 *****************CREATEAGREEMENT(FROM TEMPLATE)**********************
 ********************************************************************/
 
+func TestBuildAdapter(t *testing.T) {
+	config := viper.New()
+	config.Set(utils.AdapterTypePropertyName, "dummy")
+	config.Set(utils.AggregationPropertyName, string(model.MONITORING))
+
+	/* the dummy adapter aggregates locally, as it cannot push aggregations down */
+	agreement := createAgreement("adapter01", p1, c2, "Agreement adapter01", nil)
+	agreement.Details.Variables = []model.Variable{{Name: "m", Metric: "m",
+		Aggregation: &model.Aggregation{Type: model.COUNT, Processor: model.MONITORING}}}
+	gt := model.Guarantee{Name: "gt", Constraint: "m > 0"}
+	agreement.Details.Guarantees = []model.Guarantee{gt}
+
+	adapter := buildAdapter(config, nil).Initialize(&agreement)
+	values := adapter.GetValues(gt, []string{"m"}, time.Now())
+	if len(values) != 1 || values[0]["m"].Value != 3.0 {
+		t.Errorf("Unexpected values: %v", values)
+	}
+}
+
 func TestCreateAgreements(t *testing.T) {
 	t.Run("Create agreement from template", testCreateAgreementFromTemplate)
 	t.Run("Missing fields in create agreement from template", testCreateAgreementFromTemplateMissingFields)
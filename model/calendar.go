@@ -0,0 +1,203 @@
+/*
+Copyright 2020 Atos
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package model
+
+/*
+This file contains the calendars of agreements and guarantee terms: the business
+hours where the terms are assessed, and the maintenance windows where they are not.
+*/
+
+import (
+	"strings"
+	"time"
+)
+
+// CalendarMode is what is done with the evaluations out of the business hours or
+// in a maintenance window of a calendar
+type CalendarMode string
+
+const (
+	// SUPPRESS skips the evaluations (default mode)
+	SUPPRESS CalendarMode = "suppress"
+	// EXCLUDE evaluates as usual, but the violations are marked as excluded
+	EXCLUDE CalendarMode = "exclude"
+)
+
+// CalendarModes is the list of valid calendar modes
+var CalendarModes = []CalendarMode{SUPPRESS, EXCLUDE}
+
+// Calendar sets the periods of time where guarantee terms are not assessed as
+// usual: out of the business hours, and in maintenance windows.
+//
+// A calendar may be set in the agreement details, applying to all the guarantee
+// terms, and in a guarantee term. The calendar of a guarantee term replaces the
+// location, mode and business hours of the calendar of the agreement, while the
+// maintenance windows of both apply.
+// swagger:model
+type Calendar struct {
+	// Location is the timezone of the business hours (UTC if empty)
+	// example: Europe/Madrid
+	Location string `json:"location,omitempty"`
+	// Mode is suppress (default) or exclude
+	Mode CalendarMode `json:"mode,omitempty"`
+	// BusinessHours are the recurring periods where the terms are assessed (always if empty)
+	BusinessHours []BusinessHours `json:"business_hours,omitempty"`
+	// Maintenance are the one-off periods where the terms are not assessed
+	Maintenance []MaintenanceWindow `json:"maintenance,omitempty"`
+}
+
+// BusinessHours is a recurring period of time, from Start to End (excluded) each
+// of the Days, in the location of the calendar. If End is before Start, the
+// period ends the next day.
+// swagger:model
+type BusinessHours struct {
+	// Days are the lowercase English names of the days of the week (all days if empty)
+	// example: ["monday", "tuesday", "wednesday", "thursday", "friday"]
+	Days []string `json:"days,omitempty"`
+	// Start is the time of day in 15:04 or 15:04:05 format
+	// example: 09:00
+	Start string `json:"start"`
+	// End is the time of day in 15:04 or 15:04:05 format
+	// example: 17:30
+	End string `json:"end"`
+}
+
+// MaintenanceWindow is a one-off period of time, from Start to End (excluded)
+// swagger:model
+type MaintenanceWindow struct {
+	Id          string    `json:"id"`
+	Start       time.Time `json:"start"`
+	End         time.Time `json:"end"`
+	Description string    `json:"description,omitempty"`
+}
+
+// GetId returns the Id of a maintenance window
+func (w *MaintenanceWindow) GetId() string {
+	return w.Id
+}
+
+// Includes returns if t is in the maintenance window
+func (w *MaintenanceWindow) Includes(t time.Time) bool {
+	return !t.Before(w.Start) && t.Before(w.End)
+}
+
+// Overlaps returns if the maintenance window shares some time with other
+func (w *MaintenanceWindow) Overlaps(other *MaintenanceWindow) bool {
+	return w.Start.Before(other.End) && other.Start.Before(w.End)
+}
+
+// Validate validates the consistency of a Calendar entity
+func (c *Calendar) Validate(val Validator, mode ValidationMode) []error {
+	return val.ValidateCalendar(c, mode)
+}
+
+// GetMode returns the mode of the calendar, SUPPRESS if not set
+func (c *Calendar) GetMode() CalendarMode {
+	if c.Mode == "" {
+		return SUPPRESS
+	}
+	return c.Mode
+}
+
+// Excludes returns if t is out of the business hours or in a maintenance window
+// of the calendar
+func (c *Calendar) Excludes(t time.Time) bool {
+	for i := range c.Maintenance {
+		if c.Maintenance[i].Includes(t) {
+			return true
+		}
+	}
+	return !c.InBusinessHours(t)
+}
+
+// InBusinessHours returns if t is in the business hours of the calendar. Invalid
+// locations are considered UTC, and invalid business hours are ignored.
+func (c *Calendar) InBusinessHours(t time.Time) bool {
+	if len(c.BusinessHours) == 0 {
+		return true
+	}
+	if loc, err := time.LoadLocation(c.Location); err == nil {
+		t = t.In(loc)
+	} else {
+		t = t.UTC()
+	}
+	tod := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute +
+		time.Duration(t.Second())*time.Second
+	yesterday := (t.Weekday() + 6) % 7
+
+	for _, bh := range c.BusinessHours {
+		start, err1 := parseTimeOfDay(bh.Start)
+		end, err2 := parseTimeOfDay(bh.End)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		if start < end {
+			if bh.includesDay(t.Weekday()) && tod >= start && tod < end {
+				return true
+			}
+			continue
+		}
+		/* overnight period */
+		if bh.includesDay(t.Weekday()) && tod >= start || bh.includesDay(yesterday) && tod < end {
+			return true
+		}
+	}
+	return false
+}
+
+func (bh *BusinessHours) includesDay(day time.Weekday) bool {
+	if len(bh.Days) == 0 {
+		return true
+	}
+	name := strings.ToLower(day.String())
+	for _, d := range bh.Days {
+		if d == name {
+			return true
+		}
+	}
+	return false
+}
+
+// parseTimeOfDay returns the time of day of a "15:04" or "15:04:05" string
+func parseTimeOfDay(s string) (time.Duration, error) {
+	layout := "15:04"
+	if strings.Count(s, ":") == 2 {
+		layout = "15:04:05"
+	}
+	t, err := time.Parse(layout, s)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute +
+		time.Duration(t.Second())*time.Second, nil
+}
+
+// GetCalendar returns the calendar that applies to a guarantee term of the agreement,
+// or nil if there is none (see Calendar)
+func (d *Details) GetCalendar(gt Guarantee) *Calendar {
+	if gt.Calendar == nil {
+		return d.Calendar
+	}
+	if d.Calendar == nil || len(d.Calendar.Maintenance) == 0 {
+		return gt.Calendar
+	}
+	result := *gt.Calendar
+	result.Maintenance = make([]MaintenanceWindow, 0, len(d.Calendar.Maintenance)+len(gt.Calendar.Maintenance))
+	result.Maintenance = append(result.Maintenance, d.Calendar.Maintenance...)
+	result.Maintenance = append(result.Maintenance, gt.Calendar.Maintenance...)
+	return &result
+}
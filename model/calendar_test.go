@@ -0,0 +1,138 @@
+/*
+Copyright 2020 Atos
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+var weekdays = []string{"monday", "tuesday", "wednesday", "thursday", "friday"}
+
+func utc(s string) time.Time {
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestCalendarExcludes(t *testing.T) {
+	c := Calendar{
+		Location: "Europe/Madrid",
+		BusinessHours: []BusinessHours{
+			{Days: weekdays, Start: "09:00", End: "17:30"},
+			{Days: []string{"saturday"}, Start: "22:00", End: "02:00"},
+		},
+		Maintenance: []MaintenanceWindow{
+			{Id: "m1", Start: utc("2020-03-03T10:00:00Z"), End: utc("2020-03-03T11:00:00Z")},
+		},
+	}
+	/* Madrid is UTC+1 in these dates; 2020-03-02 is monday */
+	for _, tc := range []struct {
+		t        string
+		excluded bool
+	}{
+		{"2020-03-02T08:00:00Z", false},
+		{"2020-03-02T07:59:59Z", true},
+		{"2020-03-02T16:30:00Z", true},
+		{"2020-03-03T09:59:00Z", false},
+		{"2020-03-03T10:30:00Z", true},
+		{"2020-03-03T11:00:00Z", false},
+		{"2020-03-07T21:30:00Z", false},
+		{"2020-03-08T00:30:00Z", false},
+		{"2020-03-08T01:30:00Z", true},
+		{"2020-03-08T12:00:00Z", true},
+	} {
+		if actual := c.Excludes(utc(tc.t)); actual != tc.excluded {
+			t.Errorf("Excludes(%s): expected %v; actual %v", tc.t, tc.excluded, actual)
+		}
+	}
+
+	c = Calendar{}
+	if c.Excludes(utc("2020-03-08T12:00:00Z")) || c.GetMode() != SUPPRESS {
+		t.Errorf("Unexpected behaviour of empty calendar")
+	}
+}
+
+func TestGetCalendar(t *testing.T) {
+	d := Details{}
+	gt := Guarantee{Name: "g"}
+	if d.GetCalendar(gt) != nil {
+		t.Errorf("Expected nil calendar")
+	}
+
+	d.Calendar = &Calendar{
+		Location:    "Europe/Madrid",
+		Maintenance: []MaintenanceWindow{{Id: "m1"}},
+	}
+	if c := d.GetCalendar(gt); c != d.Calendar {
+		t.Errorf("Expected calendar of agreement. Actual: %v", c)
+	}
+
+	gt.Calendar = &Calendar{
+		Mode:        EXCLUDE,
+		Maintenance: []MaintenanceWindow{{Id: "m2"}},
+	}
+	c := d.GetCalendar(gt)
+	if c.Location != "" || c.Mode != EXCLUDE || len(c.Maintenance) != 2 {
+		t.Errorf("Unexpected calendar: %v", c)
+	}
+	if len(gt.Calendar.Maintenance) != 1 {
+		t.Errorf("Calendar of guarantee modified: %v", gt.Calendar)
+	}
+}
+
+func TestCalendarValidation(t *testing.T) {
+	start := utc("2020-03-03T10:00:00Z")
+	g := Guarantee{Name: "name", Constraint: "a < 10", Calendar: &Calendar{
+		Location:      "Europe/Madrid",
+		Mode:          EXCLUDE,
+		BusinessHours: []BusinessHours{{Days: weekdays, Start: "09:00", End: "17:30:30"}},
+		Maintenance:   []MaintenanceWindow{{Start: start, End: start.Add(time.Hour)}},
+	}}
+	checkNumber(t, &g, 0)
+
+	g.Calendar = &Calendar{
+		Location:      "Europe/Nowhere",
+		Mode:          "ignore",
+		BusinessHours: []BusinessHours{{Days: []string{"mon"}, Start: "9am", End: "25:00"}},
+		Maintenance:   []MaintenanceWindow{{Start: start, End: start}},
+	}
+	checkNumber(t, &g, 6)
+
+	d := Details{Id: "id", Name: "name", Provider: pr, Client: cl, Calendar: g.Calendar}
+	checkNumber(t, &d, 6)
+
+	c := &Calendar{Maintenance: []MaintenanceWindow{
+		{Id: "m1", Start: start, End: start.Add(time.Hour)},
+		{Id: "m2", Start: start.Add(30 * time.Minute), End: start.Add(2 * time.Hour)},
+	}}
+	checkNumber(t, c, 1)
+
+	next := MaintenanceWindow{Start: start.Add(2 * time.Hour), End: start.Add(3 * time.Hour)}
+	if errs := c.ValidateMaintenanceWindow(&next); len(errs) != 0 {
+		t.Errorf("Unexpected errors: %v", errs)
+	}
+	next.Start = start.Add(90 * time.Minute)
+	if errs := c.ValidateMaintenanceWindow(&next); len(errs) != 1 {
+		t.Errorf("Expected overlap error; got %v", errs)
+	}
+	var empty *Calendar
+	if errs := empty.ValidateMaintenanceWindow(&MaintenanceWindow{Start: start, End: start}); len(errs) != 1 {
+		t.Errorf("Expected error on empty window; got %v", errs)
+	}
+}
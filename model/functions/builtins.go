@@ -0,0 +1,317 @@
+/*
+Copyright 2020 Atos
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package functions
+
+/*
+This file contains the built-in functions.
+*/
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+func init() {
+	for _, f := range []Function{
+		{"timeNow", "timeNow()",
+			"Returns the current Unix time in seconds of the assessment", NUMBER, timeNow},
+		{"abs", "abs(x)",
+			"Returns the absolute value of x", NUMBER, abs},
+		{"min", "min(x, y, ...)",
+			"Returns the minimum of the arguments", NUMBER, minmax(math.Min)},
+		{"max", "max(x, y, ...)",
+			"Returns the maximum of the arguments", NUMBER, minmax(math.Max)},
+		{"duration", "duration(s)",
+			"Returns the seconds of a duration string (e.g. duration('1m30s') = 90)", NUMBER, duration},
+		{"percentOf", "percentOf(x, total)",
+			"Returns the percentage of x over total (e.g. percentOf(errors, requests) < 1)", NUMBER, percentOf},
+		{"between", "between(x, min, max)",
+			"Returns if min <= x <= max", BOOL, between},
+		{"timeOfDayBetween", "timeOfDayBetween(from, to[, location])",
+			"Returns if the time of the values is between the times of day from and to (e.g. '09:00', '17:30'), " +
+				"which may wrap midnight. The location is an IANA time zone (default: UTC)", BOOL, timeOfDayBetween},
+		{"hourOfDay", "hourOfDay([location])",
+			"Returns the hour of the day (0-23) of the time of the values", NUMBER, hourOfDay},
+		{"dayOfWeek", "dayOfWeek([location])",
+			"Returns the lowercase English name of the day of the week of the time of the values " +
+				"(e.g. dayOfWeek() IN ('saturday', 'sunday'))", STRING, dayOfWeek},
+		{"label", "label(variable, name)",
+			"Returns the value of the label name of the value of variable, or '' if not set " +
+				"(e.g. label('cpu', 'host') == 'node1')", STRING, label},
+		{"matches", "matches(s, regex)",
+			"Returns if the string s matches the regular expression", BOOL, matches},
+		{"labelMatches", "labelMatches(variable, name, regex)",
+			"Returns if the label name of the value of variable matches the regular expression", BOOL, labelMatches},
+		{"contains", "contains(s, substring)",
+			"Returns if the string s contains substring", BOOL, contains},
+	} {
+		MustRegister(f)
+	}
+}
+
+// now returns the current time of the assessment, or an error if the context is
+// not set by an assessment. The wall clock is never read.
+func now(ctx *Context) (time.Time, error) {
+	if ctx.Now.IsZero() {
+		return ctx.Now, fmt.Errorf("the time of the assessment is not set")
+	}
+	return ctx.Now, nil
+}
+
+func timeNow(ctx *Context, args ...interface{}) (interface{}, error) {
+	if err := Arity(args, 0, 0); err != nil {
+		return nil, err
+	}
+	t, err := now(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return float64(t.Unix()), nil
+}
+
+func abs(ctx *Context, args ...interface{}) (interface{}, error) {
+	if err := Arity(args, 1, 1); err != nil {
+		return nil, err
+	}
+	x, err := Number(args, 0)
+	return math.Abs(x), err
+}
+
+func minmax(f func(float64, float64) float64) Evaluator {
+	return func(ctx *Context, args ...interface{}) (interface{}, error) {
+		if err := Arity(args, 1, -1); err != nil {
+			return nil, err
+		}
+		result, err := Number(args, 0)
+		for i := 1; i < len(args) && err == nil; i++ {
+			var x float64
+			x, err = Number(args, i)
+			result = f(result, x)
+		}
+		return result, err
+	}
+}
+
+func duration(ctx *Context, args ...interface{}) (interface{}, error) {
+	if err := Arity(args, 1, 1); err != nil {
+		return nil, err
+	}
+	s, err := String(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return nil, err
+	}
+	return d.Seconds(), nil
+}
+
+func percentOf(ctx *Context, args ...interface{}) (interface{}, error) {
+	if err := Arity(args, 2, 2); err != nil {
+		return nil, err
+	}
+	x, err := Number(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	total, err := Number(args, 1)
+	if err != nil {
+		return nil, err
+	}
+	if total == 0 {
+		return nil, fmt.Errorf("total is zero")
+	}
+	return 100 * x / total, nil
+}
+
+func between(ctx *Context, args ...interface{}) (interface{}, error) {
+	if err := Arity(args, 3, 3); err != nil {
+		return nil, err
+	}
+	values := [3]float64{}
+	for i := range values {
+		x, err := Number(args, i)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = x
+	}
+	return values[1] <= values[0] && values[0] <= values[2], nil
+}
+
+// localTime returns the time of the context in the location given by the i-th
+// argument, if present
+func localTime(ctx *Context, args []interface{}, i int) (time.Time, error) {
+	t := ctx.Time
+	if t.IsZero() {
+		var err error
+		if t, err = now(ctx); err != nil {
+			return t, err
+		}
+	}
+	if i >= len(args) {
+		return t.UTC(), nil
+	}
+	name, err := String(args, i)
+	if err != nil {
+		return t, err
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return t, err
+	}
+	return t.In(loc), nil
+}
+
+// timeOfDay returns the time of day of a "15:04" or "15:04:05" string
+func timeOfDay(s string) (time.Duration, error) {
+	for _, layout := range []string{"15:04", "15:04:05"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute +
+				time.Duration(t.Second())*time.Second, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid time of day '%s'", s)
+}
+
+func timeOfDayBetween(ctx *Context, args ...interface{}) (interface{}, error) {
+	if err := Arity(args, 2, 3); err != nil {
+		return nil, err
+	}
+	var bounds [2]time.Duration
+	for i := range bounds {
+		s, err := String(args, i)
+		if err != nil {
+			return nil, err
+		}
+		if bounds[i], err = timeOfDay(s); err != nil {
+			return nil, err
+		}
+	}
+	t, err := localTime(ctx, args, 2)
+	if err != nil {
+		return nil, err
+	}
+	tod := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute +
+		time.Duration(t.Second())*time.Second
+	from, to := bounds[0], bounds[1]
+	if from <= to {
+		return from <= tod && tod <= to, nil
+	}
+	/* wraps midnight */
+	return tod >= from || tod <= to, nil
+}
+
+func hourOfDay(ctx *Context, args ...interface{}) (interface{}, error) {
+	if err := Arity(args, 0, 1); err != nil {
+		return nil, err
+	}
+	t, err := localTime(ctx, args, 0)
+	return float64(t.Hour()), err
+}
+
+func dayOfWeek(ctx *Context, args ...interface{}) (interface{}, error) {
+	if err := Arity(args, 0, 1); err != nil {
+		return nil, err
+	}
+	t, err := localTime(ctx, args, 0)
+	return strings.ToLower(t.Weekday().String()), err
+}
+
+func labelValue(ctx *Context, args []interface{}) (string, error) {
+	variable, err := String(args, 0)
+	if err != nil {
+		return "", err
+	}
+	name, err := String(args, 1)
+	if err != nil {
+		return "", err
+	}
+	return ctx.Labels[variable][name], nil
+}
+
+func label(ctx *Context, args ...interface{}) (interface{}, error) {
+	if err := Arity(args, 2, 2); err != nil {
+		return nil, err
+	}
+	return labelValue(ctx, args)
+}
+
+var regexps sync.Map
+
+// compile returns a compiled regular expression, caching it
+func compile(expr string) (*regexp.Regexp, error) {
+	if re, ok := regexps.Load(expr); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	regexps.Store(expr, re)
+	return re, nil
+}
+
+func matches(ctx *Context, args ...interface{}) (interface{}, error) {
+	if err := Arity(args, 2, 2); err != nil {
+		return nil, err
+	}
+	s, err := String(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	expr, err := String(args, 1)
+	if err != nil {
+		return nil, err
+	}
+	re, err := compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	return re.MatchString(s), nil
+}
+
+func labelMatches(ctx *Context, args ...interface{}) (interface{}, error) {
+	if err := Arity(args, 3, 3); err != nil {
+		return nil, err
+	}
+	value, err := labelValue(ctx, args)
+	if err != nil {
+		return nil, err
+	}
+	return matches(ctx, value, args[2])
+}
+
+func contains(ctx *Context, args ...interface{}) (interface{}, error) {
+	if err := Arity(args, 2, 2); err != nil {
+		return nil, err
+	}
+	s, err := String(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	sub, err := String(args, 1)
+	if err != nil {
+		return nil, err
+	}
+	return strings.Contains(s, sub), nil
+}
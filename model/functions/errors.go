@@ -0,0 +1,100 @@
+/*
+Copyright 2020 Atos
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package functions
+
+/*
+This file contains the errors of constraints, and the location of the position of
+the errors of govaluate in the constraint.
+*/
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Error is an error in a constraint
+type Error struct {
+	// Position is the offset in bytes of the error in the constraint, or -1 if unknown
+	Position int
+	Message  string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+var (
+	transitionError = regexp.MustCompile(`^Cannot transition token types from \w+ \[(.*)\] to \w+ \[(.*)\]$`)
+	functionError   = regexp.MustCompile(`^Undefined function (.*)$`)
+	tokenError      = regexp.MustCompile(`^Invalid token: '(.*)'$`)
+)
+
+// newError returns an Error from an error returned by govaluate when parsing
+// a constraint, locating the position of the error
+func newError(constraint string, err error) *Error {
+	msg := err.Error()
+	pos := -1
+
+	switch {
+	case msg == "Unexpected end of expression":
+		pos = len(constraint)
+	case msg == "Unbalanced parenthesis":
+		pos = unbalanced(constraint)
+	case msg == "Unclosed string literal":
+		pos = strings.LastIndex(constraint, "'")
+	case msg == "Unclosed parameter bracket":
+		pos = strings.LastIndex(constraint, "[")
+	case transitionError.MatchString(msg):
+		m := transitionError.FindStringSubmatch(msg)
+		if from := strings.Index(constraint, m[1]); from >= 0 {
+			from += len(m[1])
+			if to := strings.Index(constraint[from:], m[2]); to >= 0 {
+				pos = from + to
+			}
+		}
+	case functionError.MatchString(msg):
+		pos = strings.Index(constraint, functionError.FindStringSubmatch(msg)[1])
+	case tokenError.MatchString(msg):
+		pos = strings.Index(constraint, tokenError.FindStringSubmatch(msg)[1])
+	}
+	return &Error{Position: pos, Message: msg}
+}
+
+// unbalanced returns the position of the first unbalanced parenthesis of a
+// constraint, or -1 if not found
+func unbalanced(constraint string) int {
+	open := []int{}
+	quoted := false
+	for i, c := range constraint {
+		switch {
+		case c == '\'':
+			quoted = !quoted
+		case quoted:
+		case c == '(':
+			open = append(open, i)
+		case c == ')':
+			if len(open) == 0 {
+				return i
+			}
+			open = open[:len(open)-1]
+		}
+	}
+	if len(open) > 0 {
+		return open[0]
+	}
+	return -1
+}
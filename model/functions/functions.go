@@ -0,0 +1,187 @@
+/*
+Copyright 2020 Atos
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+/*
+Package functions contains the registry of functions that can be used in the
+constraints of guarantee terms (e.g. "between(latency, 0, duration('500ms'))").
+
+The built-in functions are registered on init (see builtins.go). More functions
+can be registered from Go before the assessment starts:
+
+	functions.Register(functions.Function{
+		Name:        "double",
+		Signature:   "double(x)",
+		Description: "Returns two times x",
+		Returns:     functions.NUMBER,
+		Eval: func(ctx *functions.Context, args ...interface{}) (interface{}, error) {
+			x, err := functions.Number(args, 0)
+			return 2 * x, err
+		},
+	})
+
+The functions are evaluated with a Context, containing the current time of the
+assessment and the time and labels of the values that are being evaluated. The
+functions must not read the wall clock, so that the evaluations are reproducible.
+*/
+package functions
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Knetic/govaluate"
+)
+
+// Context is the information about the values being evaluated in a constraint
+type Context struct {
+	// Now is the current time of the assessment (see assessment.Config).
+	// The functions that need it return an error if it is not set.
+	Now time.Time
+	// Time is the time of the evaluated values (the time of the newest one)
+	Time time.Time
+	// Labels contains the labels of the value of each variable
+	Labels map[string]map[string]string
+}
+
+// Evaluator is the type of the implementation of a function.
+//
+// The args are the values of the arguments in the constraint, where numbers are
+// float64 and strings are string.
+type Evaluator func(ctx *Context, args ...interface{}) (interface{}, error)
+
+// Function is a function available in constraints
+// swagger:model
+type Function struct {
+	// example: between
+	Name string `json:"name"`
+	// example: between(x, min, max)
+	Signature string `json:"signature"`
+	// example: Returns if min <= x <= max
+	Description string `json:"description"`
+	// Returns is the type of the result, used to type check constraints
+	// example: bool
+	Returns Type `json:"returns,omitempty"`
+	// Eval is the implementation of the function
+	Eval Evaluator `json:"-"`
+}
+
+var (
+	mutex    sync.RWMutex
+	registry = map[string]Function{}
+)
+
+// Register adds a function to the registry. It returns an error if the name is
+// empty or already registered, or the function has no implementation.
+func Register(f Function) error {
+	if f.Name == "" {
+		return fmt.Errorf("function name is empty")
+	}
+	if f.Eval == nil {
+		return fmt.Errorf("function %s has no implementation", f.Name)
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	if _, ok := registry[f.Name]; ok {
+		return fmt.Errorf("function %s is already registered", f.Name)
+	}
+	registry[f.Name] = f
+	return nil
+}
+
+// MustRegister is Register, but panics on error. It is intended for registering
+// functions on init.
+func MustRegister(f Function) {
+	if err := Register(f); err != nil {
+		panic(err)
+	}
+}
+
+// List returns the registered functions sorted by name
+func List() []Function {
+	mutex.RLock()
+	defer mutex.RUnlock()
+
+	result := make([]Function, 0, len(registry))
+	for _, f := range registry {
+		result = append(result, f)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+// Bind returns the registered functions, as needed by govaluate, evaluated with ctx.
+//
+// The context is read on each call to a function, so it may be updated between
+// evaluations of an expression.
+func Bind(ctx *Context) map[string]govaluate.ExpressionFunction {
+	mutex.RLock()
+	defer mutex.RUnlock()
+
+	result := make(map[string]govaluate.ExpressionFunction, len(registry))
+	for name, f := range registry {
+		name, eval := name, f.Eval
+		result[name] = func(args ...interface{}) (interface{}, error) {
+			v, err := eval(ctx, args...)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s", name, err.Error())
+			}
+			return v, nil
+		}
+	}
+	return result
+}
+
+// Number returns the i-th argument as a number
+func Number(args []interface{}, i int) (float64, error) {
+	if i >= len(args) {
+		return 0, fmt.Errorf("missing argument %d", i+1)
+	}
+	switch v := args[i].(type) {
+	case float64:
+		return v, nil
+	case int:
+		return float64(v), nil
+	case int64:
+		return float64(v), nil
+	default:
+		return 0, fmt.Errorf("argument %d (%v) is not a number", i+1, args[i])
+	}
+}
+
+// String returns the i-th argument as a string
+func String(args []interface{}, i int) (string, error) {
+	if i >= len(args) {
+		return "", fmt.Errorf("missing argument %d", i+1)
+	}
+	s, ok := args[i].(string)
+	if !ok {
+		return "", fmt.Errorf("argument %d (%v) is not a string", i+1, args[i])
+	}
+	return s, nil
+}
+
+// Arity returns an error if the number of arguments is not between min and max.
+// A negative max means no maximum.
+func Arity(args []interface{}, min, max int) error {
+	if len(args) < min || (max >= 0 && len(args) > max) {
+		return fmt.Errorf("invalid number of arguments: %d", len(args))
+	}
+	return nil
+}
@@ -0,0 +1,295 @@
+/*
+Copyright 2020 Atos
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package functions
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Knetic/govaluate"
+)
+
+/* Tuesday */
+var t0 = time.Date(2019, 10, 29, 22, 30, 0, 0, time.UTC)
+
+func evaluate(t *testing.T, ctx *Context, expr string, parameters map[string]interface{}) (interface{}, error) {
+	expression, err := govaluate.NewEvaluableExpressionWithFunctions(expr, Bind(ctx))
+	if err != nil {
+		t.Fatalf("Error parsing %s: %s", expr, err.Error())
+	}
+	return expression.Evaluate(parameters)
+}
+
+func TestBuiltins(t *testing.T) {
+	ctx := &Context{
+		Time: t0,
+		Labels: map[string]map[string]string{
+			"cpu": {"host": "node-12", "env": "prod"},
+		},
+	}
+	parameters := map[string]interface{}{
+		"cpu":      -95.0,
+		"errors":   5.0,
+		"requests": 1000.0,
+		"latency":  0.3,
+	}
+	for _, c := range []struct {
+		expr     string
+		expected interface{}
+	}{
+		{"abs(cpu)", 95.0},
+		{"min(3, latency, 1)", 0.3},
+		{"max(3, latency, 1)", 3.0},
+		{"duration('1m30s')", 90.0},
+		{"percentOf(errors, requests) < 1", true},
+		{"between(latency, 0, duration('500ms'))", true},
+		{"between(latency, 0.5, 1)", false},
+		{"timeOfDayBetween('22:00', '06:00')", true},
+		{"timeOfDayBetween('09:00', '17:30')", false},
+		{"timeOfDayBetween('07:00', '08:00', 'Asia/Tokyo')", true},
+		{"hourOfDay()", 22.0},
+		{"dayOfWeek()", "tuesday"},
+		{"dayOfWeek() IN ('saturday', 'sunday')", false},
+		{"label('cpu', 'host')", "node-12"},
+		{"label('cpu', 'zone')", ""},
+		{"label('mem', 'host')", ""},
+		{"matches(label('cpu', 'env'), '^pro')", true},
+		{"labelMatches('cpu', 'host', 'node-[0-9]+')", true},
+		{"contains(label('cpu', 'host'), '13')", false},
+	} {
+		actual, err := evaluate(t, ctx, c.expr, parameters)
+		if err != nil {
+			t.Errorf("Error evaluating %s: %s", c.expr, err.Error())
+		} else if actual != c.expected {
+			t.Errorf("%s. Expected: %v; Actual: %v", c.expr, c.expected, actual)
+		}
+	}
+}
+
+func TestBuiltinErrors(t *testing.T) {
+	ctx := &Context{Time: t0}
+	for _, expr := range []string{
+		"abs('a')",
+		"abs(1, 2)",
+		"duration('5 minutes')",
+		"percentOf(1, 0)",
+		"between(1, 2)",
+		"timeOfDayBetween('9am', '17:00')",
+		"hourOfDay('Mars/Olympus')",
+		"matches('a', '[')",
+		"label('cpu')",
+	} {
+		if _, err := evaluate(t, ctx, expr, nil); err == nil {
+			t.Errorf("Expected error evaluating %s", expr)
+		}
+	}
+}
+
+func TestRegister(t *testing.T) {
+	double := Function{
+		Name:        "double",
+		Signature:   "double(x)",
+		Description: "Returns two times x",
+		Eval: func(ctx *Context, args ...interface{}) (interface{}, error) {
+			x, err := Number(args, 0)
+			return 2 * x, err
+		},
+	}
+	if err := Register(double); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		mutex.Lock()
+		delete(registry, double.Name)
+		mutex.Unlock()
+	}()
+	if err := Register(double); err == nil {
+		t.Errorf("Expected error registering a function twice")
+	}
+	if err := Register(Function{Name: "noimpl"}); err == nil {
+		t.Errorf("Expected error registering a function without implementation")
+	}
+	if actual, err := evaluate(t, &Context{}, "double(2)", nil); err != nil || actual != 4.0 {
+		t.Errorf("Unexpected result: %v, %v", actual, err)
+	}
+
+	list := List()
+	for i := 1; i < len(list); i++ {
+		if list[i-1].Name >= list[i].Name {
+			t.Errorf("Functions not sorted: %s, %s", list[i-1].Name, list[i].Name)
+		}
+	}
+}
+
+func TestNow(t *testing.T) {
+	ctx := &Context{Now: t0}
+	for _, c := range []struct {
+		expr     string
+		expected interface{}
+	}{
+		{"timeNow()", float64(t0.Unix())},
+		{"hourOfDay()", 22.0},
+		{"timeOfDayBetween('22:00', '23:00')", true},
+	} {
+		actual, err := evaluate(t, ctx, c.expr, nil)
+		if err != nil {
+			t.Errorf("Error evaluating %s: %s", c.expr, err.Error())
+		} else if actual != c.expected {
+			t.Errorf("%s. Expected: %v; Actual: %v", c.expr, c.expected, actual)
+		}
+		/* the wall clock is not used if the assessment time is not set */
+		if _, err := evaluate(t, &Context{}, c.expr, nil); err == nil {
+			t.Errorf("Expected error evaluating %s without time", c.expr)
+		}
+	}
+}
+
+func TestInfer(t *testing.T) {
+	for _, c := range []struct {
+		expr     string
+		expected Type
+	}{
+		{"m < 10", BOOL},
+		{"m", NUMBER},
+		{"(m + n) * 2", NUMBER},
+		{"!(m > 0)", BOOL},
+		{"m > 0 ? 'up' : 'down'", STRING},
+		{"between(m, 0, 1) && dayOfWeek() == 'monday'", BOOL},
+		{"label('m', 'host')", STRING},
+		{"timeNow() - [m.start]", NUMBER},
+		{"'m' + m", STRING},
+		{"-m ** 2 % 3", NUMBER},
+		{"dayOfWeek() in ('saturday', 'sunday')", BOOL},
+		{"hourOfDay() >= 9 && hourOfDay() < 17 || m > 0", BOOL},
+		{"m > 0 ? 1 : 'x'", ANY},
+	} {
+		actual, err := Infer(c.expr)
+		if err != nil {
+			t.Errorf("Error inferring type of %s: %s", c.expr, err.Error())
+		} else if actual != c.expected {
+			t.Errorf("%s. Expected: %v; Actual: %v", c.expr, c.expected, actual)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	untyped := Function{
+		Name: "untyped",
+		Eval: func(ctx *Context, args ...interface{}) (interface{}, error) {
+			return args[0], nil
+		},
+	}
+	MustRegister(untyped)
+	defer func() {
+		mutex.Lock()
+		delete(registry, untyped.Name)
+		mutex.Unlock()
+	}()
+
+	for _, c := range []struct {
+		expr  string
+		valid bool
+	}{
+		{"m < 10 && n >= 0", true},
+		{"untyped(m)", true},
+		{"untyped(m) + 1", true},
+		{"m + 1", false},
+		{"abs(m)", false},
+		{"contains(m, 'a') > 1", false},
+		{"m <", false},
+		{"m LT 10", false},
+		{"undefined(m)", false},
+		{"untyped(m) > 'a' && m > 0", true},
+		{"a > 0 || a > 'b'", false},
+		{"a < 0 && !(label('a', 'x') < 1)", false},
+		{"!m", false},
+		{"true + 1 > 0", false},
+		{"m =~ 'x'", false},
+		{"m in (1)", false},
+		{"m > 0 ? m : 'x'", true},
+		{"m ? true : false", false},
+	} {
+		err := Check(c.expr)
+		if c.valid && err != nil {
+			t.Errorf("Unexpected error checking %s: %s", c.expr, err.Error())
+		} else if !c.valid && err == nil {
+			t.Errorf("Expected error checking %s", c.expr)
+		}
+	}
+}
+
+func TestErrorPosition(t *testing.T) {
+	for _, c := range []struct {
+		expr     string
+		position int
+	}{
+		{"m <", 3},
+		{"m LT 10", 2},
+		{"(m < 10", 0},
+		{"m < 10)", 6},
+		{"m < undefined(1)", 4},
+		{"contains(s, 'a)", 12},
+		{"m < 1 # 2", 6},
+		{"m + 1", 0},
+	} {
+		err := Check(c.expr)
+		if e, ok := err.(*Error); !ok {
+			t.Errorf("Expected error checking %s", c.expr)
+		} else if e.Position != c.position {
+			t.Errorf("%s: %s. Expected position: %d; Actual: %d", c.expr, e.Message, c.position, e.Position)
+		}
+	}
+}
+
+func TestVariables(t *testing.T) {
+	vars, err := Variables("cpu > 90 && label('cpu', 'host') == 'a' && [mem.used] < 1")
+	if err != nil || len(vars) != 2 {
+		t.Errorf("Unexpected variables: %v, %v", vars, err)
+	}
+	for _, c := range []struct {
+		expr     string
+		variable string
+		position int
+	}{
+		{"cpu > 90", "cpu", 0},
+		{"label('cpu', 'host') == 'a' && cpu > 90", "cpu", 31},
+		{"cpus > 1 && cpu > 90", "cpu", 12},
+		{"m < 1 && [mem.used] < 1", "mem.used", 9},
+		{"m < 1", "n", -1},
+	} {
+		if actual := VariablePosition(c.expr, c.variable); actual != c.position {
+			t.Errorf("%s, %s. Expected: %d; Actual: %d", c.expr, c.variable, c.position, actual)
+		}
+	}
+}
+
+func TestContextUpdate(t *testing.T) {
+	ctx := &Context{}
+	expression, err := govaluate.NewEvaluableExpressionWithFunctions("hourOfDay() < 12", Bind(ctx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		hour     int
+		expected bool
+	}{{9, true}, {15, false}} {
+		ctx.Time = time.Date(2019, 10, 29, c.hour, 0, 0, 0, time.UTC)
+		if actual, _ := expression.Evaluate(nil); actual != c.expected {
+			t.Errorf("Hour %d. Expected: %v; Actual: %v", c.hour, c.expected, actual)
+		}
+	}
+}
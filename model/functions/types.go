@@ -0,0 +1,356 @@
+/*
+Copyright 2020 Atos
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package functions
+
+/*
+This file contains the type checking and the analysis of the variables of constraints.
+*/
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Knetic/govaluate"
+)
+
+// Type is the type of the result of a function or a constraint
+type Type string
+
+const (
+	// ANY is the type of results whose type is not known
+	ANY Type = ""
+	// BOOL is the type of booleans
+	BOOL Type = "bool"
+	// NUMBER is the type of numbers (float64)
+	NUMBER Type = "number"
+	// STRING is the type of strings
+	STRING Type = "string"
+)
+
+// TypeOf returns the type of a value, as returned by govaluate
+func TypeOf(value interface{}) Type {
+	switch value.(type) {
+	case bool:
+		return BOOL
+	case float64, int, int64:
+		return NUMBER
+	case string:
+		return STRING
+	default:
+		return ANY
+	}
+}
+
+// array is the type of the lists of values (e.g. the right operand of IN)
+const array Type = "array"
+
+// Infer returns the type of the result of a constraint.
+//
+// The type of each operand is inferred statically from the tokens of the constraint:
+// variables are numbers, and functions return the type they are registered with.
+// The operands of each operator are checked regardless of the values, so that
+// short-circuits do not hide type errors (e.g. "a > 0 || a > 'b'"). A function whose
+// type is unknown is compatible with any operator, and the type of the operations
+// that depend on it may be ANY. The errors are of type *Error.
+func Infer(constraint string) (Type, error) {
+	mutex.RLock()
+	stubs := make(map[string]govaluate.ExpressionFunction, len(registry))
+	for name, f := range registry {
+		t := f.Returns
+		stubs[name] = func(args ...interface{}) (interface{}, error) {
+			return t, nil
+		}
+	}
+	mutex.RUnlock()
+
+	expression, err := govaluate.NewEvaluableExpressionWithFunctions(constraint, stubs)
+	if err != nil {
+		return ANY, newError(constraint, err)
+	}
+	c := typeChecker{tokens: expression.Tokens()}
+	t, err := c.separator()
+	if err != nil {
+		return ANY, &Error{Position: -1, Message: err.Error()}
+	}
+	return t, nil
+}
+
+/*
+typeChecker infers the type of a list of tokens of govaluate, following the
+precedence of its operators, from lowest to highest:
+
+	,  ?:??  ||  &&  comparators  & | ^  >> <<  + -  * / %  **  prefixes  functions
+*/
+type typeChecker struct {
+	tokens []govaluate.ExpressionToken
+	pos    int
+}
+
+// level is a binary operator precedence level
+type level struct {
+	kind      govaluate.TokenKind
+	operators []string
+	next      func(*typeChecker) (Type, error)
+	check     func(op string, left, right Type) (Type, error)
+}
+
+var levels []level
+
+func init() {
+	/* from highest to lowest precedence */
+	next := (*typeChecker).prefix
+	for _, l := range []level{
+		{govaluate.MODIFIER, []string{"**"}, nil, numeric},
+		{govaluate.MODIFIER, []string{"*", "/", "%"}, nil, numeric},
+		{govaluate.MODIFIER, []string{"+", "-"}, nil, additive},
+		{govaluate.MODIFIER, []string{">>", "<<"}, nil, numeric},
+		{govaluate.MODIFIER, []string{"&", "|", "^"}, nil, numeric},
+		{govaluate.COMPARATOR, []string{"==", "!=", ">", ">=", "<", "<=", "=~", "!~", "in"}, nil, comparator},
+		{govaluate.LOGICALOP, []string{"&&"}, nil, logical},
+		{govaluate.LOGICALOP, []string{"||"}, nil, logical},
+		{govaluate.TERNARY, []string{"?", ":", "??"}, nil, ternary},
+		{govaluate.SEPARATOR, []string{","}, nil, separated},
+	} {
+		l.next = next
+		levels = append(levels, l)
+		i := len(levels) - 1
+		next = func(c *typeChecker) (Type, error) {
+			return c.binary(levels[i])
+		}
+	}
+}
+
+func (c *typeChecker) separator() (Type, error) {
+	return c.binary(levels[len(levels)-1])
+}
+
+func (c *typeChecker) peek() (govaluate.ExpressionToken, bool) {
+	if c.pos >= len(c.tokens) {
+		return govaluate.ExpressionToken{}, false
+	}
+	return c.tokens[c.pos], true
+}
+
+// binary infers the type of a left associative chain of the operators of l
+func (c *typeChecker) binary(l level) (Type, error) {
+	left, err := l.next(c)
+	if err != nil {
+		return ANY, err
+	}
+	for {
+		token, ok := c.peek()
+		if !ok || token.Kind != l.kind || !hasOperator(l.operators, token.Value) {
+			return left, nil
+		}
+		c.pos++
+		right, err := l.next(c)
+		if err != nil {
+			return ANY, err
+		}
+		if left, err = l.check(token.Value.(string), left, right); err != nil {
+			return ANY, err
+		}
+	}
+}
+
+func (c *typeChecker) prefix() (Type, error) {
+	token, ok := c.peek()
+	if !ok || token.Kind != govaluate.PREFIX {
+		return c.function()
+	}
+	c.pos++
+	t, err := c.prefix()
+	if err != nil {
+		return ANY, err
+	}
+	op := token.Value.(string)
+	if op == "!" {
+		return BOOL, expect(op, t, BOOL)
+	}
+	return NUMBER, expect(op, t, NUMBER)
+}
+
+func (c *typeChecker) function() (Type, error) {
+	token, ok := c.peek()
+	if !ok || token.Kind != govaluate.FUNCTION {
+		return c.value()
+	}
+	c.pos++
+	/* the arguments are checked, but not their types */
+	if _, err := c.value(); err != nil {
+		return ANY, err
+	}
+	returns, _ := token.Value.(govaluate.ExpressionFunction)()
+	t, _ := returns.(Type)
+	return t, nil
+}
+
+func (c *typeChecker) value() (Type, error) {
+	token, ok := c.peek()
+	if !ok {
+		return ANY, fmt.Errorf("unexpected end of expression")
+	}
+	c.pos++
+	switch token.Kind {
+	case govaluate.CLAUSE:
+		if next, ok := c.peek(); ok && next.Kind == govaluate.CLAUSE_CLOSE {
+			/* function without arguments */
+			c.pos++
+			return ANY, nil
+		}
+		t, err := c.separator()
+		c.pos++ /* CLAUSE_CLOSE */
+		return t, err
+	case govaluate.VARIABLE, govaluate.NUMERIC, govaluate.TIME:
+		return NUMBER, nil
+	case govaluate.STRING, govaluate.PATTERN:
+		return STRING, nil
+	case govaluate.BOOLEAN:
+		return BOOL, nil
+	case govaluate.PREFIX:
+		c.pos--
+		return c.prefix()
+	default:
+		return ANY, fmt.Errorf("unexpected token '%v'", token.Value)
+	}
+}
+
+func hasOperator(operators []string, value interface{}) bool {
+	for _, op := range operators {
+		if op == value {
+			return true
+		}
+	}
+	return false
+}
+
+// expect returns an error if t is not expected (ANY is always expected)
+func expect(op string, t Type, expected Type) error {
+	if t != ANY && t != expected {
+		return fmt.Errorf("the operator '%s' needs a %s, not a %s", op, expected, t)
+	}
+	return nil
+}
+
+func numeric(op string, left, right Type) (Type, error) {
+	if err := expect(op, left, NUMBER); err != nil {
+		return ANY, err
+	}
+	return NUMBER, expect(op, right, NUMBER)
+}
+
+func additive(op string, left, right Type) (Type, error) {
+	if op == "+" && (left == STRING || right == STRING) {
+		/* concatenation */
+		return STRING, nil
+	}
+	if op == "+" && (left == ANY || right == ANY) {
+		return ANY, nil
+	}
+	return numeric(op, left, right)
+}
+
+func comparator(op string, left, right Type) (Type, error) {
+	switch op {
+	case "==", "!=":
+		return BOOL, nil
+	case "=~", "!~":
+		if err := expect(op, left, STRING); err != nil {
+			return ANY, err
+		}
+		return BOOL, expect(op, right, STRING)
+	case "in":
+		return BOOL, expect(op, right, array)
+	}
+	if left == ANY || right == ANY || left == right && (left == NUMBER || left == STRING) {
+		return BOOL, nil
+	}
+	return ANY, fmt.Errorf("the operator '%s' cannot compare a %s and a %s", op, left, right)
+}
+
+func logical(op string, left, right Type) (Type, error) {
+	if err := expect(op, left, BOOL); err != nil {
+		return ANY, err
+	}
+	return BOOL, expect(op, right, BOOL)
+}
+
+func ternary(op string, left, right Type) (Type, error) {
+	if op == "?" {
+		/* right is the type of the true branch */
+		return right, expect(op, left, BOOL)
+	}
+	if left == right {
+		return left, nil
+	}
+	return ANY, nil
+}
+
+func separated(op string, left, right Type) (Type, error) {
+	return array, nil
+}
+
+// Check returns an error of type *Error if the constraint cannot be parsed or its
+// result is not a bool
+func Check(constraint string) error {
+	t, err := Infer(constraint)
+	if err != nil {
+		return err
+	}
+	if t != BOOL && t != ANY {
+		return &Error{Position: 0, Message: fmt.Sprintf("the result is a %s, not a bool", t)}
+	}
+	return nil
+}
+
+// Variables returns the names of the variables of a constraint
+func Variables(constraint string) ([]string, error) {
+	expression, err := govaluate.NewEvaluableExpressionWithFunctions(constraint, Bind(&Context{}))
+	if err != nil {
+		return nil, newError(constraint, err)
+	}
+	return expression.Vars(), nil
+}
+
+// VariablePosition returns the offset in bytes of the first occurrence of a
+// variable in a constraint, or -1 if not found
+func VariablePosition(constraint string, variable string) int {
+	if i := strings.Index(constraint, "["+variable+"]"); i >= 0 {
+		return i
+	}
+	quoted := false
+	for i := 0; i < len(constraint); i++ {
+		c := constraint[i]
+		if c == '\'' {
+			quoted = !quoted
+			continue
+		}
+		if quoted || !strings.HasPrefix(constraint[i:], variable) {
+			continue
+		}
+		end := i + len(variable)
+		if (i == 0 || !isIdentifier(constraint[i-1])) &&
+			(end == len(constraint) || !isIdentifier(constraint[end])) {
+			return i
+		}
+	}
+	return -1
+}
+
+func isIdentifier(c byte) bool {
+	return c == '_' || c == '.' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
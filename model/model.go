@@ -22,8 +22,10 @@ by any repository.
 package model
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 )
 
@@ -81,6 +83,18 @@ type TextType string
 // AggregationType is the type of supported variable aggregations
 type AggregationType string
 
+// WindowType is the type of supported aggregation windows
+type WindowType string
+
+// AggregationProcessor is where the aggregation of a variable is performed
+type AggregationProcessor string
+
+// PredictionType is the type of supported variable predictions
+type PredictionType string
+
+// InterpolationType is the type of supported interpolations of variables
+type InterpolationType string
+
 const (
 	// STARTED is the state of an agreement that can be evaluated
 	STARTED State = "started"
@@ -105,8 +119,74 @@ const (
 	NONE AggregationType = "none"
 	// AVERAGE is used to calculate average of a variable
 	AVERAGE AggregationType = "average"
+	// SUM is used to calculate the sum of the values of a variable
+	SUM AggregationType = "sum"
+	// MIN is used to calculate the minimum of a variable
+	MIN AggregationType = "min"
+	// MAX is used to calculate the maximum of a variable
+	MAX AggregationType = "max"
+	// COUNT is used to calculate the number of values of a variable
+	COUNT AggregationType = "count"
+	// RATE is used to calculate the per-second increase of a counter, considering resets
+	RATE AggregationType = "rate"
+	// LAST is used to take the last value of a variable
+	LAST AggregationType = "last"
+	// P50 is used to calculate the median of a variable
+	P50 AggregationType = "p50"
+	// P95 is used to calculate the 95th percentile of a variable
+	P95 AggregationType = "p95"
+	// P99 is used to calculate the 99th percentile of a variable
+	P99 AggregationType = "p99"
+	// STDDEV is used to calculate the (population) standard deviation of a variable
+	STDDEV AggregationType = "stddev"
+)
+
+// AggregationTypes is the list of supported aggregations
+var AggregationTypes = [...]AggregationType{NONE, AVERAGE, SUM, MIN, MAX, COUNT, RATE, LAST, P50, P95, P99, STDDEV}
+
+const (
+	// TUMBLING windows are consecutive and non overlapping; an aggregated value
+	// is calculated for each window
+	TUMBLING WindowType = "tumbling"
+	// SLIDING windows end at each value; an aggregated value is calculated for
+	// each value with the values in the previous window
+	SLIDING WindowType = "sliding"
+)
+
+const (
+	// LOCAL aggregations are performed by the SLALite on the retrieved values
+	LOCAL AggregationProcessor = "local"
+	// MONITORING aggregations are pushed down to the queries to the monitoring
+	// (e.g. avg_over_time in PromQL), so the retrieved values are already aggregated
+	MONITORING AggregationProcessor = "monitoring"
 )
 
+const (
+	// NOPREDICTION is used when the real values of the variable are evaluated
+	NOPREDICTION PredictionType = "none"
+	// HOLTWINTERS is used to evaluate the values smoothed by Holt-Winters
+	HOLTWINTERS PredictionType = "holt_winters"
+	// PREDICTLINEAR is used to evaluate the values predicted by linear regression
+	PREDICTLINEAR PredictionType = "predict_linear"
+)
+
+const (
+	// CONSTANT interpolation takes the last known value of the variable
+	CONSTANT InterpolationType = "constant"
+	// LINEAR interpolation takes the value on the line between the last known
+	// value and the next value of the variable
+	LINEAR InterpolationType = "linear"
+	// NEAREST interpolation takes the nearest in time of the last known value and
+	// the next value of the variable
+	NEAREST InterpolationType = "nearest"
+	// DROPINCOMPLETE does not interpolate: the values of the other variables are
+	// discarded
+	DROPINCOMPLETE InterpolationType = "drop-incomplete"
+)
+
+// InterpolationTypes is the list of supported interpolations
+var InterpolationTypes = [...]InterpolationType{CONSTANT, LINEAR, NEAREST, DROPINCOMPLETE}
+
 // States is the list of possible states of an agreement/template
 var States = [...]State{STOPPED, STARTED, TERMINATED}
 
@@ -205,6 +285,66 @@ type AssessmentGuarantee struct {
 	LastExecution  time.Time  `json:"last_execution"`
 	LastValues     LastValues `json:"last_values,omitempty"`
 	LastViolation  *Violation `json:"last_violation,omitempty"`
+	// Incident is the open incident of the guarantee term, or the last closed one
+	Incident *Incident `json:"incident,omitempty"`
+	// LastError is the error of the last evaluation of the guarantee term, if it failed
+	LastError string `json:"last_error,omitempty"`
+	// Budget is the error budget of a guarantee term with an Objective
+	Budget *ErrorBudget `json:"budget,omitempty"`
+	// Pending is the ongoing failure of a guarantee term with a Tolerance
+	Pending *Pending `json:"pending,omitempty"`
+}
+
+// Pending is an ongoing failure of a guarantee term with a Tolerance, i.e., the
+// consecutive failed evaluations since the last successful one. It is firing when
+// the Tolerance has been reached, so the failed evaluations raise violations.
+// swagger:model
+type Pending struct {
+	// Since is the time of the first failed evaluation
+	Since time.Time `json:"since"`
+	// Count is the number of consecutive failed evaluations
+	Count  int  `json:"count"`
+	Firing bool `json:"firing"`
+}
+
+// ErrorBudget is the state of the objective of a guarantee term
+// swagger:model
+type ErrorBudget struct {
+	// Good is the number of points in the window that satisfy the constraint
+	Good int64 `json:"good"`
+	// Total is the number of points in the window
+	Total int64 `json:"total"`
+	// Compliance is Good / Total (1 if there are no points)
+	Compliance float64 `json:"compliance"`
+	// Remaining is the ratio of the error budget left; it is negative if exhausted
+	Remaining float64  `json:"remaining"`
+	Buckets   []Bucket `json:"buckets,omitempty"`
+	// BurnRates contains the state of each BurnRate of the Objective
+	BurnRates []BurnRateState `json:"burn_rates,omitempty"`
+}
+
+// Exhausted returns if the compliance is under the target
+func (b *ErrorBudget) Exhausted() bool {
+	return b.Remaining < 0
+}
+
+// BurnRateState is the state of a BurnRate of an Objective
+// swagger:model
+type BurnRateState struct {
+	Window int64 `json:"window"`
+	// Rate is the current burn rate
+	Rate float64 `json:"rate"`
+	// Firing is true while Rate is over the threshold of the BurnRate
+	Firing  bool     `json:"firing"`
+	Buckets []Bucket `json:"buckets,omitempty"`
+}
+
+// Bucket contains the number of points evaluated in a period of a rolling window
+// swagger:model
+type Bucket struct {
+	Start time.Time `json:"start"`
+	Good  int64     `json:"good"`
+	Total int64     `json:"total"`
 }
 
 // LastValues contain last values of variables in guarantee terms
@@ -224,6 +364,9 @@ type Details struct {
 	Expiration *time.Time  `json:"expiration,omitempty"`
 	Variables  []Variable  `json:"variables,omitempty"`
 	Guarantees []Guarantee `json:"guarantees"`
+	Calendar   *Calendar   `json:"calendar,omitempty"`
+	// Interpolation sets the default interpolation of the variables
+	Interpolation *Interpolation `json:"interpolation,omitempty"`
 }
 
 // Variable gives additional information about a metric used in a Guarantee constraint
@@ -232,16 +375,69 @@ type Variable struct {
 	Name        string       `json:"name"`
 	Metric      string       `json:"metric"`
 	Aggregation *Aggregation `json:"aggregation,omitempty"`
+	// Labels overrides the mapping of metric labels set in the adapter
+	Labels *LabelMapping `json:"labels,omitempty"`
+	// Predict overrides the prediction set in the adapter
+	Predict *Prediction `json:"predict,omitempty"`
+	// Interpolation overrides the interpolation set in the agreement
+	Interpolation *Interpolation `json:"interpolation,omitempty"`
+}
+
+// Interpolation sets how the values of the variables of a guarantee term are
+// aligned in time. The values of the variables are evaluated together if their
+// times differ in up to Tolerance seconds. Otherwise, the value of a variable
+// without a value at that time is interpolated according to the Type.
+//
+// The unset fields of the interpolation of a variable are taken from the
+// interpolation of the agreement; the default Type is constant and the default
+// Tolerance is 0.1 seconds.
+// swagger:model
+type Interpolation struct {
+	Type InterpolationType `json:"type,omitempty"`
+	// example: 5
+	Tolerance float64 `json:"tolerance,omitempty"`
+}
+
+// Prediction sets that the values of a variable are forecast by the monitoring
+// from the past values of the metric, instead of the real ones.
+//
+// Range is the window of past values to consider (e.g. 5m); if empty, the metric
+// must already be a range. Horizon is the time in the future of the values
+// predicted by predict_linear (e.g. 30s). SmoothingFactor and TrendFactor are the
+// parameters of holt_winters, between 0 and 1.
+// swagger:model
+type Prediction struct {
+	Type            PredictionType `json:"type"`
+	Range           string         `json:"range,omitempty"`
+	Horizon         string         `json:"horizon,omitempty"`
+	SmoothingFactor float64        `json:"smoothing_factor,omitempty"`
+	TrendFactor     float64        `json:"trend_factor,omitempty"`
+}
+
+// LabelMapping sets how the labels of a metric in the monitoring system are mapped
+// to the Key and Resource of a MetricValue.
+//
+// Key and Resource are lists of alternatives, where the first one with a non-empty value
+// is used. An alternative is a list of label names joined by "+", whose value
+// is the concatenation of the label values. E.g.: ["call_id", "job_id+exported_instance"]
+// swagger:model
+type LabelMapping struct {
+	Key      []string `json:"key,omitempty"`
+	Resource []string `json:"resource,omitempty"`
 }
 
 // Aggregation gives aggregation information of a variable.
 // If defined and value is not NONE, the metric must be aggregated
 // in the specified window in seconds.
 // I.e. (average, 3600) means that the average over a period of one hour is calculated.
+// WindowType is tumbling (default) or sliding; a sliding window needs a Window.
+// Processor overrides where the aggregation is performed, set in the configuration.
 // swagger:model
 type Aggregation struct {
-	Type   AggregationType `json:"type"`
-	Window int             `json:"window"`
+	Type       AggregationType      `json:"type"`
+	Window     int                  `json:"window"`
+	WindowType WindowType           `json:"window_type,omitempty"`
+	Processor  AggregationProcessor `json:"processor,omitempty"`
 }
 
 // Guarantee is the struct that represents an SLO
@@ -253,6 +449,78 @@ type Guarantee struct {
 	Schedule   Schedule     `json:"schedule,omitempty"`
 	Warning    string       `json:"warning,omitempty"`
 	Penalties  []PenaltyDef `json:"penalties,omitempty"`
+	// Enrichers is the list of names of the enrichers that add information
+	// to the violations of this guarantee before being notified
+	Enrichers []string `json:"enrichers,omitempty"`
+	// Objective makes the guarantee term an SLO over a rolling window
+	Objective *Objective `json:"objective,omitempty"`
+	// For makes the guarantee term raise violations only if a failure persists
+	For *Tolerance `json:"for,omitempty"`
+	// Transient is the time to wait until a new violation of the guarantee term
+	// can be raised again (e.g. 30s, 2h). If empty, the global transient time is used.
+	Transient string `json:"transient,omitempty"`
+	// Calendar sets the periods where the guarantee term is not assessed as usual
+	Calendar *Calendar `json:"calendar,omitempty"`
+}
+
+// TransientTime returns the transient time of the guarantee term, or def if
+// not set or not valid
+func (g *Guarantee) TransientTime(def time.Duration) time.Duration {
+	if g.Transient == "" {
+		return def
+	}
+	d, err := time.ParseDuration(g.Transient)
+	if err != nil {
+		return def
+	}
+	return d
+}
+
+// Tolerance sets that a failure of a guarantee term raises violations only after
+// a number of consecutive failed evaluations of the constraint and/or after the
+// failure lasts a number of seconds, like the "for" clause of Prometheus alerting
+// rules. If both are set, both must be reached.
+// swagger:model
+type Tolerance struct {
+	// Count is the number of consecutive failed evaluations before raising violations
+	// example: 3
+	Count int `json:"count,omitempty"`
+	// Duration is the number of seconds a failure lasts before raising violations
+	// example: 300
+	Duration int64 `json:"duration,omitempty"`
+}
+
+// Objective sets that a guarantee term is fulfilled if the ratio of points that
+// satisfy the constraint in a rolling window is at least the target
+// (e.g. 99.5% of the points in 30 days), instead of requiring each point to
+// satisfy it.
+//
+// The error budget is the ratio of points that may fail (1 - Target). A violation
+// is raised when the budget is exhausted, and when the failed points consume the
+// budget faster than a burn rate.
+// swagger:model
+type Objective struct {
+	// Target is the ratio of points that must satisfy the constraint, in (0, 1)
+	// example: 0.995
+	Target float64 `json:"target"`
+	// Window is the rolling window in seconds
+	// example: 2592000
+	Window int64 `json:"window"`
+	// BurnRates are the burn rates that raise a violation
+	BurnRates []BurnRate `json:"burn_rates,omitempty"`
+}
+
+// BurnRate is a threshold of the speed at which the error budget is consumed.
+// The burn rate is the ratio of failed points in a window over 1 - Target
+// (i.e., a burn rate of 1 exhausts the budget at the end of the objective window).
+// swagger:model
+type BurnRate struct {
+	// Rate is the threshold that raises a violation
+	// example: 14.4
+	Rate float64 `json:"rate"`
+	// Window is the window in seconds where the burn rate is calculated
+	// example: 3600
+	Window int64 `json:"window"`
 }
 
 // Scope is the resources a guarantee term applies on
@@ -276,6 +544,59 @@ type MetricValue struct {
 	Value    interface{} `json:"value"`
 	DateTime time.Time   `json:"datetime"`
 	Resource string      `json:"resource"`
+	// Labels contains the labels of the metric in the monitoring system, if any
+	Labels Labels `json:"labels,omitempty"`
+}
+
+// Labels is a set of labels of a metric. It is kept as its canonical JSON
+// encoding, so that MetricValues remain comparable. The empty value has no labels.
+//
+// swagger:type object
+type Labels string
+
+// NewLabels returns the Labels of a map of label names to values
+func NewLabels(m map[string]string) Labels {
+	if len(m) == 0 {
+		return ""
+	}
+	/* json.Marshal sorts the keys of a map */
+	b, err := json.Marshal(m)
+	if err != nil {
+		return ""
+	}
+	return Labels(b)
+}
+
+// Map returns the labels as a map of label names to values
+func (l Labels) Map() map[string]string {
+	result := make(map[string]string)
+	if l != "" {
+		json.Unmarshal([]byte(l), &result)
+	}
+	return result
+}
+
+// Get returns the value of a label, or the empty string if not present
+func (l Labels) Get(name string) string {
+	return l.Map()[name]
+}
+
+// MarshalJSON serializes the labels as a JSON object
+func (l Labels) MarshalJSON() ([]byte, error) {
+	if l == "" {
+		return []byte("{}"), nil
+	}
+	return []byte(l), nil
+}
+
+// UnmarshalJSON deserializes the labels from a JSON object
+func (l *Labels) UnmarshalJSON(b []byte) error {
+	var m map[string]string
+	if err := json.Unmarshal(b, &m); err != nil {
+		return err
+	}
+	*l = NewLabels(m)
+	return nil
 }
 
 func (v MetricValue) String() string {
@@ -291,6 +612,26 @@ type Violation struct {
 	Datetime    time.Time     `json:"datetime"`
 	Constraint  string        `json:"constraint"`
 	Values      []MetricValue `json:"values"`
+	// Fields contains additional information added by enrichers
+	Fields map[string]interface{} `json:"fields,omitempty"`
+	// Excluded is true if the violation occurred in a period excluded by a calendar
+	Excluded bool `json:"excluded,omitempty"`
+}
+
+// Incident is the period of time while a guarantee term is not fulfilled.
+//
+// An incident is opened by the first failed evaluation of the guarantee term,
+// and is closed (End is set) when the term is fulfilled again. Duration is the
+// elapsed time in seconds (up to the last assessment if still open) and Violations
+// is the number of violations raised during the incident.
+// swagger:model
+type Incident struct {
+	AgreementId string     `json:"agreement_id"`
+	Guarantee   string     `json:"guarantee"`
+	Start       time.Time  `json:"start"`
+	End         *time.Time `json:"end,omitempty"`
+	Duration    float64    `json:"duration"`
+	Violations  int        `json:"violations"`
 }
 
 // Penalty is generated when a guarantee term is violated is the term has
@@ -378,6 +719,50 @@ func (as *Assessment) GetGuarantee(name string) AssessmentGuarantee {
 	return as.Guarantees[name]
 }
 
+// IsOpen returns if the incident has not been closed yet
+func (i *Incident) IsOpen() bool {
+	return i.End == nil
+}
+
+// Close sets the end of the incident
+func (i *Incident) Close(end time.Time) {
+	i.End = &end
+	i.Duration = end.Sub(i.Start).Seconds()
+}
+
+// Merge returns a mapping with the values of m, taking the values of def where m is empty
+func (m *LabelMapping) Merge(def LabelMapping) LabelMapping {
+	if m == nil {
+		return def
+	}
+	result := *m
+	if len(result.Key) == 0 {
+		result.Key = def.Key
+	}
+	if len(result.Resource) == 0 {
+		result.Resource = def.Resource
+	}
+	return result
+}
+
+// Map returns the key and resource of a metric with the given labels
+func (m LabelMapping) Map(labels map[string]string) (key string, resource string) {
+	return mapLabels(m.Key, labels), mapLabels(m.Resource, labels)
+}
+
+func mapLabels(alternatives []string, labels map[string]string) string {
+	for _, alternative := range alternatives {
+		var b strings.Builder
+		for _, name := range strings.Split(alternative, "+") {
+			b.WriteString(labels[strings.TrimSpace(name)])
+		}
+		if b.Len() > 0 {
+			return b.String()
+		}
+	}
+	return ""
+}
+
 // Validate validates the consistency of a Details entity
 func (t *Details) Validate(val Validator, mode ValidationMode) []error {
 	return val.ValidateDetails(t, mode)
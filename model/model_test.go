@@ -65,15 +65,58 @@ func TestAssessment(t *testing.T) {
 }
 
 func TestGuarantee(t *testing.T) {
-	g := Guarantee{Name: "name", Constraint: "a LT 10"}
+	g := Guarantee{Name: "name", Constraint: "a < 10"}
 	checkNumber(t, &g, 0)
 
-	g = Guarantee{Name: "", Constraint: "a LT 10"}
+	g = Guarantee{Name: "", Constraint: "a < 10"}
 	checkNumber(t, &g, 1)
 
 	g = Guarantee{Name: "name", Constraint: ""}
 	checkNumber(t, &g, 1)
 
+	g = Guarantee{Name: "name", Constraint: "a < {{.A}}"}
+	checkNumber(t, &g, 0)
+
+	for _, c := range []string{"a LT 10", "a + 10", "abs(a)", "a > 'b'", "unknown(a) > 0"} {
+		g = Guarantee{Name: "name", Constraint: c}
+		checkNumber(t, &g, 1)
+	}
+
+	g = Guarantee{Name: "name", Constraint: "a < 10",
+		Objective: &Objective{Target: 0.99, Window: 3600, BurnRates: []BurnRate{{Rate: 14.4, Window: 300}}}}
+	checkNumber(t, &g, 0)
+
+	g = Guarantee{Name: "name", Constraint: "a < 10", Objective: &Objective{Target: 1, Window: 0}}
+	checkNumber(t, &g, 2)
+
+	g = Guarantee{Name: "name", Constraint: "a < 10",
+		Objective: &Objective{Target: 0.99, Window: 3600, BurnRates: []BurnRate{{Rate: 0, Window: 7200}}}}
+	checkNumber(t, &g, 2)
+
+	g = Guarantee{Name: "name", Constraint: "a < 10", For: &Tolerance{Count: 3, Duration: 300}}
+	checkNumber(t, &g, 0)
+
+	g = Guarantee{Name: "name", Constraint: "a < 10", For: &Tolerance{Count: -1, Duration: -1}}
+	checkNumber(t, &g, 2)
+
+	g = Guarantee{Name: "name", Constraint: "a < 10", For: &Tolerance{Count: 3},
+		Objective: &Objective{Target: 0.99, Window: 3600}}
+	checkNumber(t, &g, 1)
+
+	g = Guarantee{Name: "name", Constraint: "a < 10", Transient: "1h"}
+	checkNumber(t, &g, 0)
+	if g.TransientTime(time.Second) != time.Hour {
+		t.Errorf("Unexpected transient time: %v", g.TransientTime(time.Second))
+	}
+
+	g = Guarantee{Name: "name", Constraint: "a < 10", Transient: "{{.T}}"}
+	checkNumber(t, &g, 0)
+
+	g = Guarantee{Name: "name", Constraint: "a < 10", Transient: "1 hour"}
+	checkNumber(t, &g, 1)
+	if g.TransientTime(time.Second) != time.Second {
+		t.Errorf("Unexpected transient time: %v", g.TransientTime(time.Second))
+	}
 }
 
 func TestDetails(t *testing.T) {
@@ -104,6 +147,121 @@ func TestDetails(t *testing.T) {
 	checkNumber(t, &at, 2)
 }
 
+func TestDetailsPredictions(t *testing.T) {
+	at := Details{
+		Id:       "id",
+		Name:     "name",
+		Provider: pr,
+		Client:   cl,
+		Variables: []Variable{
+			{Name: "a", Metric: "a", Predict: &Prediction{Type: PREDICTLINEAR, Range: "5m", Horizon: "30s"}},
+			{Name: "b", Metric: "b", Predict: &Prediction{Type: HOLTWINTERS, SmoothingFactor: 0.3, TrendFactor: 0.1}},
+		},
+	}
+	checkNumber(t, &at, 0)
+
+	at.Variables = []Variable{
+		{Name: "a", Metric: "a", Predict: &Prediction{Type: "other", Range: "5x"}},
+		{Name: "b", Metric: "b", Predict: &Prediction{Type: HOLTWINTERS, SmoothingFactor: 1, TrendFactor: -1}},
+	}
+	checkNumber(t, &at, 4)
+}
+
+func TestDetailsAggregations(t *testing.T) {
+	at := Details{
+		Id:       "id",
+		Name:     "name",
+		Provider: pr,
+		Client:   cl,
+		Variables: []Variable{
+			{Name: "a", Metric: "a", Aggregation: &Aggregation{Type: P95, Window: 300}},
+			{Name: "b", Metric: "b", Aggregation: &Aggregation{Type: RATE, Window: 60, WindowType: SLIDING}},
+			{Name: "c", Metric: "c", Aggregation: &Aggregation{Type: NONE}},
+			{Name: "d", Metric: "d", Aggregation: &Aggregation{Type: SUM, Window: 60, Processor: MONITORING}},
+		},
+	}
+	checkNumber(t, &at, 0)
+
+	at.Variables = []Variable{
+		{Name: "a", Metric: "a", Aggregation: &Aggregation{Type: "median", Window: -1}},
+		{Name: "b", Metric: "b", Aggregation: &Aggregation{Type: MAX, WindowType: SLIDING}},
+		{Name: "c", Metric: "c", Aggregation: &Aggregation{Type: MAX, WindowType: "hopping"}},
+		{Name: "d", Metric: "d", Aggregation: &Aggregation{Type: MAX, Processor: "remote"}},
+		{Name: "e", Metric: "e", Aggregation: &Aggregation{Type: MAX, Processor: MONITORING}},
+	}
+	checkNumber(t, &at, 6)
+}
+
+func TestDetailsInterpolations(t *testing.T) {
+	at := Details{
+		Id:            "id",
+		Name:          "name",
+		Provider:      pr,
+		Client:        cl,
+		Interpolation: &Interpolation{Type: LINEAR, Tolerance: 0.5},
+		Variables: []Variable{
+			{Name: "a", Metric: "a", Interpolation: &Interpolation{Type: NEAREST}},
+			{Name: "b", Metric: "b", Interpolation: &Interpolation{Type: DROPINCOMPLETE, Tolerance: 1}},
+			{Name: "c", Metric: "c", Interpolation: &Interpolation{Tolerance: 2}},
+		},
+	}
+	checkNumber(t, &at, 0)
+
+	at.Interpolation = &Interpolation{Type: "cubic", Tolerance: -1}
+	at.Variables = []Variable{
+		{Name: "a", Metric: "a", Interpolation: &Interpolation{Type: "spline"}},
+		{Name: "b", Metric: "b", Interpolation: &Interpolation{Type: CONSTANT, Tolerance: -0.1}},
+	}
+	checkNumber(t, &at, 4)
+}
+
+func TestDetailsReferences(t *testing.T) {
+	at := Details{
+		Id:       "id",
+		Name:     "name",
+		Provider: pr,
+		Client:   cl,
+		Variables: []Variable{
+			{Name: "latency", Metric: "histogram_quantile(0.95, rate(latency_bucket[5m]))"},
+		},
+		Guarantees: []Guarantee{
+			{Name: "g1", Constraint: "latency < 100 && up == 1", Warning: "latency < 80"},
+			{Name: "g2", Constraint: "[http.requests] > 0 && [errors] < 1"},
+			{Name: "g3", Constraint: "latency < {{.L}} && [m-1] > 0"},
+		},
+	}
+	errs := at.Validate(val, CREATE)
+	if len(errs) != 1 {
+		t.Fatalf("Expected 1 error. Actual: %v", errs)
+	}
+	if e, ok := errs[0].(*ExpressionError); !ok || e.Field != "Guarantee['g2'].Constraint" || e.Position != 0 {
+		t.Errorf("Unexpected error: %#v", errs[0])
+	}
+
+	strict := NewStrictValidator(false, true)
+	errs = at.Validate(strict, CREATE)
+	if len(errs) != 3 {
+		t.Fatalf("Expected 3 errors. Actual: %v", errs)
+	}
+	if e, ok := errs[0].(*ExpressionError); !ok || e.Field != "Guarantee['g1'].Constraint" || e.Position != 17 {
+		t.Errorf("Unexpected error: %#v", errs[0])
+	}
+
+	at.Guarantees = []Guarantee{
+		{Name: "g1", Constraint: "latency < 100", Warning: "latency <"},
+		{Name: "g2", Constraint: "latency < 100)"},
+	}
+	errs = at.Validate(val, CREATE)
+	if len(errs) != 2 {
+		t.Fatalf("Expected 2 errors. Actual: %v", errs)
+	}
+	for i, expected := range []int{9, 13} {
+		if e, ok := errs[i].(*ExpressionError); !ok || e.Position != expected {
+			t.Errorf("Unexpected error: %#v", errs[i])
+		}
+	}
+}
+
 func TestAgreement(t *testing.T) {
 
 	a := Agreement{
@@ -180,6 +338,35 @@ func TestTemplate(test *testing.T) {
 	checkNumber(test, &t, 1)
 }
 
+func TestLabelMapping(t *testing.T) {
+	labels := map[string]string{
+		"job_id":            "j1",
+		"exported_instance": "i1",
+		"function_name":     "f1",
+	}
+	def := LabelMapping{
+		Key:      []string{"call_id", "job_id+exported_instance"},
+		Resource: []string{"function_name"},
+	}
+	if key, resource := def.Map(labels); key != "j1i1" || resource != "f1" {
+		t.Errorf("Unexpected key/resource: %s/%s", key, resource)
+	}
+	labels["call_id"] = "c1"
+	if key, _ := def.Map(labels); key != "c1" {
+		t.Errorf("Unexpected key: %s", key)
+	}
+
+	var m *LabelMapping
+	if merged := m.Merge(def); len(merged.Key) != 2 {
+		t.Errorf("Unexpected merged mapping: %v", merged)
+	}
+	m = &LabelMapping{Key: []string{"function_name"}}
+	merged := m.Merge(def)
+	if key, resource := merged.Map(labels); key != "f1" || resource != "f1" {
+		t.Errorf("Unexpected key/resource: %s/%s", key, resource)
+	}
+}
+
 func TestStates(t *testing.T) {
 	a := Agreement{State: STOPPED}
 	if !a.IsStopped() {
@@ -404,6 +591,41 @@ func TestMetricValue(t *testing.T) {
 	}
 }
 
+func TestLabels(t *testing.T) {
+	l1 := NewLabels(map[string]string{"job": "j1", "instance": "i1"})
+	l2 := NewLabels(map[string]string{"instance": "i1", "job": "j1"})
+	if l1 != l2 {
+		t.Errorf("Labels should be equal: %s != %s", l1, l2)
+	}
+	if NewLabels(nil) != "" || len(Labels("").Map()) != 0 {
+		t.Errorf("Empty labels should be the empty value")
+	}
+	if v := l1.Get("job"); v != "j1" {
+		t.Errorf("Unexpected label value: %s", v)
+	}
+
+	m := MetricValue{Key: "m1", Value: 1.0, Labels: l1}
+	marshalled, err := json.Marshal(m)
+	if err != nil {
+		t.Fatalf("Error marshalling metric value: %v", err)
+	}
+	if !strings.Contains(string(marshalled), `"labels":{"instance":"i1","job":"j1"}`) {
+		t.Errorf("Unexpected marshalled metric value: %s", marshalled)
+	}
+	var unmarshalled MetricValue
+	if err := json.Unmarshal(marshalled, &unmarshalled); err != nil {
+		t.Fatalf("Error unmarshalling metric value: %v", err)
+	}
+	if unmarshalled.Labels != l1 {
+		t.Errorf("Unexpected unmarshalled labels: %s", unmarshalled.Labels)
+	}
+
+	marshalled, _ = json.Marshal(MetricValue{Key: "m1", Value: 1.0})
+	if strings.Contains(string(marshalled), `"labels"`) {
+		t.Errorf("Labels section is not omitted. Marshalled metric value is %s", marshalled)
+	}
+}
+
 func checkNumber(t *testing.T, v Validable, expected int) {
 	if errs := v.Validate(val, CREATE); len(errs) != expected {
 		t.Errorf("Error validating %s%v. Errors = %v; Expected: %d", reflect.TypeOf(v), v, errs, expected)
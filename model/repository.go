@@ -147,4 +147,24 @@ type IRepository interface {
 	 * (it is recommended to check a.IsValidTransition before UpdateAgreementState)
 	 */
 	UpdateAgreementState(id string, newState State) (*Agreement, error)
+
+	/*
+	 * UpdateAgreementAssessment replaces the Assessment of an Agreement, leaving
+	 * the rest of the Agreement untouched.
+	 *
+	 * Returns the updated agreement; error != nil on error
+	 *
+	 * error is sql.ErrNoRows if the Agreement does not exist
+	 */
+	UpdateAgreementAssessment(id string, assessment *Assessment) (*Agreement, error)
+
+	/*
+	 * UpdateAgreementCalendar replaces the Calendar of the Details of an Agreement,
+	 * leaving the rest of the Agreement untouched.
+	 *
+	 * Returns the updated agreement; error != nil on error
+	 *
+	 * error is sql.ErrNoRows if the Agreement does not exist
+	 */
+	UpdateAgreementCalendar(id string, calendar *Calendar) (*Agreement, error)
 }
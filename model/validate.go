@@ -17,8 +17,12 @@ limitations under the License.
 package model
 
 import (
+	"SLALite/model/functions"
 	"fmt"
 	"net/url"
+	"regexp"
+	"strings"
+	"time"
 )
 
 /*
@@ -32,6 +36,7 @@ type Validator interface {
 	ValidateAgreement(a *Agreement, mode ValidationMode) []error
 	ValidateTemplate(t *Template, mode ValidationMode) []error
 	ValidateAssessment(as *Assessment, mode ValidationMode) []error
+	ValidateCalendar(c *Calendar, mode ValidationMode) []error
 	ValidateDetails(t *Details, mode ValidationMode) []error
 	ValidateGuarantee(g *Guarantee, mode ValidationMode) []error
 	ValidateViolation(v *Violation, mode ValidationMode) []error
@@ -54,8 +59,9 @@ DefaultValidator is an implementation of Validator.
 It validates inputs to the system and should cover most of the cases.
 */
 type DefaultValidator struct {
-	externalIDs bool
-	equalIDs    bool
+	externalIDs   bool
+	equalIDs      bool
+	directMetrics bool
 }
 
 // NewDefaultValidator returns a default Validator.
@@ -68,8 +74,22 @@ type DefaultValidator struct {
 // equalIDs=true. externalIDs is consider false regardless of its value if externalIDs=true
 func NewDefaultValidator(externalIDs bool, equalIDs bool) Validator {
 	return DefaultValidator{
-		externalIDs: externalIDs,
-		equalIDs:    !externalIDs && equalIDs,
+		externalIDs:   externalIDs,
+		equalIDs:      !externalIDs && equalIDs,
+		directMetrics: true,
+	}
+}
+
+// NewStrictValidator returns a default Validator (see NewDefaultValidator) that also
+// requires the variables of the guarantee terms to be declared in Details.Variables.
+//
+// The default validator allows undeclared variables whose name is a valid metric
+// name (direct metrics), that are retrieved from the metric of the same name.
+func NewStrictValidator(externalIDs bool, equalIDs bool) Validator {
+	return DefaultValidator{
+		externalIDs:   externalIDs,
+		equalIDs:      !externalIDs && equalIDs,
+		directMetrics: false,
 	}
 }
 
@@ -135,6 +155,11 @@ func (val DefaultValidator) ValidateAgreement(a *Agreement, mode ValidationMode)
 	return result
 }
 
+// ValidateCalendar implements model.Validator.ValidateCalendar
+func (val DefaultValidator) ValidateCalendar(c *Calendar, mode ValidationMode) []error {
+	return checkCalendar("Calendar", c, []error{})
+}
+
 // ValidateAssessment implements model.Validator.ValidateAssessment
 func (val DefaultValidator) ValidateAssessment(as *Assessment, mode ValidationMode) []error {
 	if as.MonitoringURL != "" {
@@ -164,6 +189,27 @@ func (val DefaultValidator) ValidateDetails(t *Details, mode ValidationMode) []e
 		for _, e := range g.Validate(val, mode) {
 			result = append(result, e)
 		}
+		result = checkReferences(t, g.Constraint,
+			fmt.Sprintf("Guarantee['%s'].Constraint", g.Name), val.directMetrics, result)
+		result = checkReferences(t, g.Warning,
+			fmt.Sprintf("Guarantee['%s'].Warning", g.Name), val.directMetrics, result)
+	}
+	for _, v := range t.Variables {
+		if v.Aggregation != nil {
+			result = checkAggregation(v.Name, v.Aggregation, result)
+		}
+		if v.Predict != nil {
+			result = checkPrediction(v.Name, v.Predict, result)
+		}
+		if v.Interpolation != nil {
+			result = checkInterpolation(fmt.Sprintf("Variable['%s'].Interpolation", v.Name), v.Interpolation, result)
+		}
+	}
+	if t.Calendar != nil {
+		result = checkCalendar("Calendar", t.Calendar, result)
+	}
+	if t.Interpolation != nil {
+		result = checkInterpolation("Interpolation", t.Interpolation, result)
 	}
 	return result
 }
@@ -191,10 +237,275 @@ func (val DefaultValidator) ValidateGuarantee(g *Guarantee, mode ValidationMode)
 	result := make([]error, 0)
 	result = checkNotEmpty(g.Name, "Guarantee.Name", result)
 	result = checkNotEmpty(g.Constraint, fmt.Sprintf("Guarantee['%s'].Constraint", g.Name), result)
+	result = checkConstraint(g.Constraint, fmt.Sprintf("Guarantee['%s'].Constraint", g.Name), result)
+	result = checkConstraint(g.Warning, fmt.Sprintf("Guarantee['%s'].Warning", g.Name), result)
+	if g.Objective != nil {
+		result = checkObjective(g.Name, g.Objective, result)
+	}
+	if g.For != nil {
+		result = checkTolerance(g.Name, g.For, g.Objective != nil, result)
+	}
+	if g.Calendar != nil {
+		result = checkCalendar(fmt.Sprintf("Guarantee['%s'].Calendar", g.Name), g.Calendar, result)
+	}
+	if !hasPlaceholders(g.Transient) {
+		result = checkDuration(g.Transient, fmt.Sprintf("Guarantee['%s'].Transient", g.Name), result)
+	}
 
 	return result
 }
 
+// ExpressionError is an error in an expression (constraint or warning) of a
+// guarantee term
+// swagger:model
+type ExpressionError struct {
+	// Field is the path of the field that contains the expression
+	// example: Guarantee['latency'].Constraint
+	Field string `json:"field"`
+	// example: latency < 100 &&
+	Expression string `json:"expression"`
+	// Position is the offset in bytes of the error in the expression, or -1 if unknown
+	// example: 15
+	Position int `json:"position"`
+	// example: Unexpected end of expression
+	Message string `json:"message"`
+}
+
+func (e *ExpressionError) Error() string {
+	return fmt.Sprintf("%s '%s' is not valid (position %d): %s", e.Field, e.Expression, e.Position, e.Message)
+}
+
+// hasPlaceholders returns if an expression contains template placeholders; these
+// expressions are checked when the agreement is created from the template.
+func hasPlaceholders(expression string) bool {
+	return strings.Contains(expression, "{{")
+}
+
+// checkConstraint checks that a constraint is a boolean expression
+func checkConstraint(constraint string, description string, current []error) []error {
+	if constraint == "" || hasPlaceholders(constraint) {
+		return current
+	}
+	if err := functions.Check(constraint); err != nil {
+		e := err.(*functions.Error)
+		return append(current, &ExpressionError{
+			Field:      description,
+			Expression: constraint,
+			Position:   e.Position,
+			Message:    e.Message,
+		})
+	}
+	return current
+}
+
+// directMetric is the syntax of the variables that can be used in guarantee terms
+// without being declared in Details.Variables (i.e., the name is the metric)
+var directMetric = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+
+// checkReferences checks that the variables of an expression are declared in the
+// details or, if allowed, are direct metrics
+func checkReferences(t *Details, expression string, description string, directMetrics bool, current []error) []error {
+	if expression == "" || hasPlaceholders(expression) {
+		return current
+	}
+	vars, err := functions.Variables(expression)
+	if err != nil {
+		/* syntax errors are returned by checkConstraint */
+		return current
+	}
+	for _, name := range vars {
+		if _, ok := t.GetVariable(name); ok {
+			continue
+		}
+		msg := ""
+		if !directMetrics {
+			msg = fmt.Sprintf("variable '%s' is not declared in Variables", name)
+		} else if !directMetric.MatchString(name) {
+			msg = fmt.Sprintf("variable '%s' is not declared in Variables and is not a valid metric name", name)
+		} else {
+			continue
+		}
+		current = append(current, &ExpressionError{
+			Field:      description,
+			Expression: expression,
+			Position:   functions.VariablePosition(expression, name),
+			Message:    msg,
+		})
+	}
+	return current
+}
+
+func checkObjective(gtname string, o *Objective, current []error) []error {
+	desc := fmt.Sprintf("Guarantee['%s'].Objective", gtname)
+	if o.Target <= 0 || o.Target >= 1 {
+		current = append(current, fmt.Errorf("%s.Target must be between 0 and 1", desc))
+	}
+	if o.Window <= 0 {
+		current = append(current, fmt.Errorf("%s.Window must be greater than 0", desc))
+	}
+	for i, b := range o.BurnRates {
+		if b.Rate <= 0 {
+			current = append(current, fmt.Errorf("%s.BurnRates[%d].Rate must be greater than 0", desc, i))
+		}
+		if b.Window <= 0 || b.Window > o.Window {
+			current = append(current, fmt.Errorf("%s.BurnRates[%d].Window must be between 0 and Window", desc, i))
+		}
+	}
+	return current
+}
+
+func checkInterpolation(desc string, i *Interpolation, current []error) []error {
+	valid := i.Type == ""
+	for _, t := range InterpolationTypes {
+		valid = valid || i.Type == t
+	}
+	if !valid {
+		current = append(current, fmt.Errorf("%s.Type '%s' is not valid", desc, i.Type))
+	}
+	if i.Tolerance < 0 {
+		current = append(current, fmt.Errorf("%s.Tolerance must not be negative", desc))
+	}
+	return current
+}
+
+func checkCalendar(desc string, c *Calendar, current []error) []error {
+	if _, err := time.LoadLocation(c.Location); err != nil {
+		current = append(current, fmt.Errorf("%s.Location '%s' is not valid", desc, c.Location))
+	}
+	valid := c.Mode == ""
+	for _, m := range CalendarModes {
+		valid = valid || c.Mode == m
+	}
+	if !valid {
+		current = append(current, fmt.Errorf("%s.Mode '%s' is not valid", desc, c.Mode))
+	}
+	for i, bh := range c.BusinessHours {
+		bhdesc := fmt.Sprintf("%s.BusinessHours[%d]", desc, i)
+		for _, d := range bh.Days {
+			if !isWeekday(d) {
+				current = append(current, fmt.Errorf("%s.Days '%s' is not a day of the week", bhdesc, d))
+			}
+		}
+		if _, err := parseTimeOfDay(bh.Start); err != nil {
+			current = append(current, fmt.Errorf("%s.Start '%s' is not a valid time of day", bhdesc, bh.Start))
+		}
+		if _, err := parseTimeOfDay(bh.End); err != nil {
+			current = append(current, fmt.Errorf("%s.End '%s' is not a valid time of day", bhdesc, bh.End))
+		}
+	}
+	for i := range c.Maintenance {
+		current = checkMaintenanceWindow(fmt.Sprintf("%s.Maintenance[%d]", desc, i), &c.Maintenance[i],
+			c.Maintenance[:i], current)
+	}
+	return current
+}
+
+// ValidateMaintenanceWindow validates a maintenance window to be added to the calendar:
+// it must end after it starts and must not overlap the windows of the calendar
+func (c *Calendar) ValidateMaintenanceWindow(w *MaintenanceWindow) []error {
+	var others []MaintenanceWindow
+	if c != nil {
+		others = c.Maintenance
+	}
+	return checkMaintenanceWindow("MaintenanceWindow", w, others, []error{})
+}
+
+func checkMaintenanceWindow(desc string, w *MaintenanceWindow, others []MaintenanceWindow, current []error) []error {
+	if !w.End.After(w.Start) {
+		current = append(current, fmt.Errorf("%s.End must be after Start", desc))
+	}
+	for i := range others {
+		if w.Overlaps(&others[i]) {
+			current = append(current, fmt.Errorf("%s overlaps maintenance window '%s'", desc, others[i].Id))
+		}
+	}
+	return current
+}
+
+func isWeekday(name string) bool {
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		if name == strings.ToLower(d.String()) {
+			return true
+		}
+	}
+	return false
+}
+
+func checkTolerance(gtname string, t *Tolerance, objective bool, current []error) []error {
+	desc := fmt.Sprintf("Guarantee['%s'].For", gtname)
+	if t.Count < 0 {
+		current = append(current, fmt.Errorf("%s.Count must not be negative", desc))
+	}
+	if t.Duration < 0 {
+		current = append(current, fmt.Errorf("%s.Duration must not be negative", desc))
+	}
+	if objective {
+		current = append(current, fmt.Errorf("%s cannot be set with an Objective", desc))
+	}
+	return current
+}
+
+func checkAggregation(varname string, a *Aggregation, current []error) []error {
+	desc := fmt.Sprintf("Variable['%s'].Aggregation", varname)
+	valid := a.Type == ""
+	for _, t := range AggregationTypes {
+		valid = valid || a.Type == t
+	}
+	if !valid {
+		current = append(current, fmt.Errorf("%s.Type '%s' is not valid", desc, a.Type))
+	}
+	if a.Window < 0 {
+		current = append(current, fmt.Errorf("%s.Window must not be negative", desc))
+	}
+	switch a.WindowType {
+	case "", TUMBLING:
+	case SLIDING:
+		if a.Window == 0 {
+			current = append(current, fmt.Errorf("%s.Window must be set in a sliding window", desc))
+		}
+	default:
+		current = append(current, fmt.Errorf("%s.WindowType '%s' is not valid", desc, a.WindowType))
+	}
+	switch a.Processor {
+	case "", LOCAL:
+	case MONITORING:
+		if a.Window == 0 {
+			current = append(current, fmt.Errorf("%s.Window must be set in a monitoring aggregation", desc))
+		}
+	default:
+		current = append(current, fmt.Errorf("%s.Processor '%s' is not valid", desc, a.Processor))
+	}
+	return current
+}
+
+func checkPrediction(varname string, p *Prediction, current []error) []error {
+	desc := fmt.Sprintf("Variable['%s'].Predict", varname)
+	switch p.Type {
+	case NOPREDICTION, HOLTWINTERS, PREDICTLINEAR:
+	default:
+		current = append(current, fmt.Errorf("%s.Type '%s' is not valid", desc, p.Type))
+	}
+	current = checkDuration(p.Range, desc+".Range", current)
+	current = checkDuration(p.Horizon, desc+".Horizon", current)
+	current = checkFactor(p.SmoothingFactor, desc+".SmoothingFactor", current)
+	current = checkFactor(p.TrendFactor, desc+".TrendFactor", current)
+	return current
+}
+
+func checkDuration(field string, description string, current []error) []error {
+	if _, err := time.ParseDuration(field); field != "" && err != nil {
+		current = append(current, fmt.Errorf("%s '%s' is not a valid duration", description, field))
+	}
+	return current
+}
+
+func checkFactor(field float64, description string, current []error) []error {
+	if field < 0 || field >= 1 {
+		current = append(current, fmt.Errorf("%s must be between 0 and 1", description))
+	}
+	return current
+}
+
 func checkNotEmpty(field string, description string, current []error) []error {
 	if field == "" {
 		current = append(current, fmt.Errorf("%s is empty", description))
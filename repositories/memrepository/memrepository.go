@@ -316,6 +316,32 @@ func (r MemRepository) UpdateAgreementState(id string, newState model.State) (*m
 	return result, err
 }
 
+/*
+UpdateAgreementAssessment replaces the assessment of the agreement
+*/
+func (r MemRepository) UpdateAgreementAssessment(id string, assessment *model.Assessment) (*model.Agreement, error) {
+	current, ok := r.agreements[id]
+	if !ok {
+		return nil, model.ErrNotFound
+	}
+	current.Assessment = *assessment
+	r.agreements[id] = current
+	return &current, nil
+}
+
+/*
+UpdateAgreementCalendar replaces the calendar of the agreement
+*/
+func (r MemRepository) UpdateAgreementCalendar(id string, calendar *model.Calendar) (*model.Agreement, error) {
+	current, ok := r.agreements[id]
+	if !ok {
+		return nil, model.ErrNotFound
+	}
+	current.Details.Calendar = calendar
+	r.agreements[id] = current
+	return &current, nil
+}
+
 /*
 GetAllTemplates returns the list of templates.
 
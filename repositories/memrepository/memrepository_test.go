@@ -70,6 +70,8 @@ func TestRepository(t *testing.T) {
 	t.Run("GetAgreementsByState", ctx.TestGetAgreementsByState)
 	t.Run("UpdateAgreement", ctx.TestUpdateAgreement)
 	t.Run("UpdateAgreementNotExists", ctx.TestUpdateAgreementNotExists)
+	t.Run("UpdateAgreementAssessment", ctx.TestUpdateAgreementAssessment)
+	t.Run("UpdateAgreementCalendar", ctx.TestUpdateAgreementCalendar)
 	t.Run("DeleteAgreement", ctx.TestDeleteAgreement)
 	t.Run("DeleteAgreementNotExists", ctx.TestDeleteAgreementNotExists)
 
@@ -306,6 +306,32 @@ func (r Repository) UpdateAgreementState(id string, newState model.State) (*mode
 	return agreement, err
 }
 
+/*
+UpdateAgreementAssessment replaces the assessment of the agreement
+*/
+func (r Repository) UpdateAgreementAssessment(id string, assessment *model.Assessment) (*model.Agreement, error) {
+	var agreement *model.Agreement
+
+	err := r.update(agreementCollectionName, id, bson.M{"$set": bson.M{"assessment": assessment}})
+	if err == nil {
+		agreement, _ = r.GetAgreement(id)
+	}
+	return agreement, err
+}
+
+/*
+UpdateAgreementCalendar replaces the calendar of the agreement
+*/
+func (r Repository) UpdateAgreementCalendar(id string, calendar *model.Calendar) (*model.Agreement, error) {
+	var agreement *model.Agreement
+
+	err := r.update(agreementCollectionName, id, bson.M{"$set": bson.M{"details.calendar": calendar}})
+	if err == nil {
+		agreement, _ = r.GetAgreement(id)
+	}
+	return agreement, err
+}
+
 /*
 GetAllTemplates returns the list of templates.
 
@@ -292,6 +292,46 @@ func (r *TestContext) TestUpdateAgreementNotExists(t *testing.T) {
 	assertEquals(t, "Unexpected error. Expected: %v; Actual: %v", model.ErrNotFound, err)
 }
 
+// TestUpdateAgreementAssessment executes this test
+func (r *TestContext) TestUpdateAgreementAssessment(t *testing.T) {
+	now := time.Now()
+	assessment := model.Assessment{FirstExecution: now, LastExecution: now}
+
+	_, err := r.Repo.UpdateAgreementAssessment(Data.A02.Id, &assessment)
+	assertEquals(t, "Unexpected error. Expected: %v; Actual: %v", nil, err)
+
+	a, err := r.Repo.GetAgreement(Data.A02.Id)
+	assertEquals(t, "Unexpected error. Expected: %v; Actual: %v", nil, err)
+	assertEquals(t, "Unexpected Assessment.LastExecution. Expected: %v; Actual: %v",
+		now.Unix(), a.Assessment.LastExecution.Unix())
+	assertEquals(t, "Unexpected state. Expected: %v; Actual: %v", model.STOPPED, a.State)
+
+	_, err = r.Repo.UpdateAgreementAssessment(Data.Anotexists.Id, &assessment)
+	assertEquals(t, "Unexpected error. Expected: %v; Actual: %v", model.ErrNotFound, err)
+}
+
+// TestUpdateAgreementCalendar executes this test
+func (r *TestContext) TestUpdateAgreementCalendar(t *testing.T) {
+	start := time.Date(2020, 3, 1, 22, 0, 0, 0, time.UTC)
+	calendar := model.Calendar{
+		Maintenance: []model.MaintenanceWindow{{Id: "m1", Start: start, End: start.Add(time.Hour)}},
+	}
+
+	_, err := r.Repo.UpdateAgreementCalendar(Data.A02.Id, &calendar)
+	assertEquals(t, "Unexpected error. Expected: %v; Actual: %v", nil, err)
+
+	a, err := r.Repo.GetAgreement(Data.A02.Id)
+	assertEquals(t, "Unexpected error. Expected: %v; Actual: %v", nil, err)
+	if a.Details.Calendar == nil || len(a.Details.Calendar.Maintenance) != 1 {
+		t.Fatalf("Unexpected calendar: %v", a.Details.Calendar)
+	}
+	assertEquals(t, "Unexpected maintenance window. Expected: %v; Actual: %v",
+		"m1", a.Details.Calendar.Maintenance[0].Id)
+
+	_, err = r.Repo.UpdateAgreementCalendar(Data.Anotexists.Id, &calendar)
+	assertEquals(t, "Unexpected error. Expected: %v; Actual: %v", model.ErrNotFound, err)
+}
+
 // TestDeleteAgreement executes this test
 func (r *TestContext) TestDeleteAgreement(t *testing.T) {
 	err := r.Repo.DeleteAgreement(&Data.A02)
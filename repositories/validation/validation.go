@@ -172,6 +172,24 @@ func (r repository) UpdateAgreementState(id string, newState model.State) (*mode
 	return r.backend.UpdateAgreementState(id, newState)
 }
 
+// UpdateAgreementAssessment validates and changes the assessment of an Agreement.
+func (r repository) UpdateAgreementAssessment(id string, assessment *model.Assessment) (*model.Agreement, error) {
+	if errs := assessment.Validate(r.val, model.UPDATE); len(errs) > 0 {
+		return nil, newValError(errs)
+	}
+	return r.backend.UpdateAgreementAssessment(id, assessment)
+}
+
+// UpdateAgreementCalendar validates and changes the calendar of an Agreement.
+func (r repository) UpdateAgreementCalendar(id string, calendar *model.Calendar) (*model.Agreement, error) {
+	if calendar != nil {
+		if errs := calendar.Validate(r.val, model.UPDATE); len(errs) > 0 {
+			return nil, newValError(errs)
+		}
+	}
+	return r.backend.UpdateAgreementCalendar(id, calendar)
+}
+
 // GetAllTemplates gets all Templates.
 func (r repository) GetAllTemplates() (model.Templates, error) {
 	return r.backend.GetAllTemplates()
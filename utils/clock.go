@@ -0,0 +1,76 @@
+/*
+Copyright 2020 Atos
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock is the source of the current time of the assessment.
+//
+// The assessment uses the time of a Clock instead of calling time.Now(), so that
+// it can be driven by a FakeClock in tests and replays.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// SystemClock is the Clock that returns the wall time
+var SystemClock Clock = systemClock{}
+
+// FakeClock is a Clock whose time is only changed by Set and Advance.
+// It is safe for concurrent use.
+// Ex:
+//    clock := NewFakeClock(t0)
+//    clock.Advance(time.Minute)
+type FakeClock struct {
+	mutex sync.Mutex
+	t     time.Time
+}
+
+// NewFakeClock returns a FakeClock set to t
+func NewFakeClock(t time.Time) *FakeClock {
+	return &FakeClock{t: t}
+}
+
+// Now returns the time of the clock
+func (c *FakeClock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.t
+}
+
+// Set sets the time of the clock
+func (c *FakeClock) Set(t time.Time) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.t = t
+}
+
+// Advance moves the time of the clock forward by d, returning the new time
+func (c *FakeClock) Advance(d time.Duration) time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.t = c.t.Add(d)
+	return c.t
+}
@@ -0,0 +1,38 @@
+/*
+Copyright 2020 Atos
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFakeClock(t *testing.T) {
+	t0 := time.Date(2019, 10, 29, 10, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(t0)
+
+	if !clock.Now().Equal(t0) {
+		t.Errorf("Expected: %v; Actual: %v", t0, clock.Now())
+	}
+	if actual := clock.Advance(time.Minute); !actual.Equal(t0.Add(time.Minute)) {
+		t.Errorf("Expected: %v; Actual: %v", t0.Add(time.Minute), actual)
+	}
+	clock.Set(t0)
+	if !clock.Now().Equal(t0) {
+		t.Errorf("Expected: %v; Actual: %v", t0, clock.Now())
+	}
+}
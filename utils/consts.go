@@ -37,6 +37,12 @@ const (
 	// DefaultExternalIDs is the default value of externalIDs
 	DefaultExternalIDs bool = false
 
+	// DefaultDirectMetrics is the default value of directMetrics
+	DefaultDirectMetrics bool = true
+
+	// DefaultAggregation is the default processor of variable aggregations
+	DefaultAggregation string = "local"
+
 	// DefaultTransientTime is the default number of seconds after a violation
 	// to raise a violation for the same guarantee term
 	DefaultTransientTime time.Duration = 0
@@ -50,6 +56,10 @@ const (
 	// AdapterTypePropertyName is the name of the property adapter type(prometheus)
 	AdapterTypePropertyName = "adapter"
 
+	// AggregationPropertyName is the name of the property that sets where the variables
+	// are aggregated, if not set in the variable (local/monitoring)
+	AggregationPropertyName = "aggregation"
+
 	// NotifierTypePropertyName is the name of the property notifier type (log/rest/rabbit)
 	NotifierTypePropertyName = "notifier"
 
@@ -57,6 +67,10 @@ const (
 	// auto assigns the ID of entities when they are stored on repository
 	ExternalIDsPropertyName = "externalIDs"
 
+	// DirectMetricsPropertyName is a boolean value that indicates if guarantee terms
+	// may use variables not declared in the agreement, whose name is the metric
+	DirectMetricsPropertyName = "directMetrics"
+
 	// TransientTimePropertyName is the name of the property that holds the number of
 	// seconds to wait until a new violation for a guarantee term is raised
 	TransientTimePropertyName = "transientTime"
@@ -0,0 +1,125 @@
+/*
+Copyright 2020 Atos
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+/*
+This file contains the functions to read sensitive settings (endpoints with
+credentials, passwords...) without hardcoding them in the configuration file.
+
+A sensitive setting "name" is resolved in the following order:
+
+- the value of the setting, from the config file or the SLA_<NAME> env var
+- the content of the file pointed by the "name_file" setting, usually given
+  by the SLA_<NAME>_FILE env var (Docker/K8s secrets)
+- the value in the secrets file (see LoadSecretsFile)
+*/
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+const (
+	// SecretsFilePropertyName is the name of the property that contains the path
+	// of a file with sensitive settings
+	SecretsFilePropertyName = "secretsFile"
+
+	// fileSuffix is appended to a setting name to obtain its file indirection
+	fileSuffix = "_file"
+
+	// maskedPassword substitutes passwords when logging URLs
+	maskedPassword = "xxxxx"
+)
+
+/*
+LoadSecretsFile reads the file pointed by the SecretsFilePropertyName setting
+(if set) and adds its settings to config.
+
+The file can be in any format supported by Viper. The settings read have the
+lowest precedence, so they can be overriden by the config file or env vars.
+*/
+func LoadSecretsFile(config *viper.Viper) error {
+	path := config.GetString(SecretsFilePropertyName)
+	if path == "" {
+		return nil
+	}
+
+	secrets := viper.New()
+	secrets.SetConfigFile(path)
+	if err := secrets.ReadInConfig(); err != nil {
+		return fmt.Errorf("Error reading secrets file %s: %s", path, err.Error())
+	}
+	for _, key := range secrets.AllKeys() {
+		config.SetDefault(key, secrets.Get(key))
+	}
+	log.Infof("Read secrets from %s", path)
+	return nil
+}
+
+/*
+GetSecret returns the value of a sensitive setting.
+
+If the setting is not set, the file pointed by the setting name + "_file" is
+read and its content (without surrounding whitespace) returned.
+F.e., the value of "rabbitMQ" can be read from the file in SLA_RABBITMQ_FILE.
+*/
+func GetSecret(config *viper.Viper, name string) (string, error) {
+	if value := config.GetString(name); value != "" {
+		return value, nil
+	}
+	path := config.GetString(name + fileSuffix)
+	if path == "" {
+		return "", nil
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("Error reading %s from %s: %s", name, path, err.Error())
+	}
+	return strings.TrimSpace(string(content)), nil
+}
+
+// RequireSecret is like GetSecret, but returns an error if the setting is empty.
+func RequireSecret(config *viper.Viper, name string) (string, error) {
+	value, err := GetSecret(config, name)
+	if err != nil {
+		return "", err
+	}
+	if value == "" {
+		envvar := strings.ToUpper(ConfigPrefix + "_" + name)
+		return "", fmt.Errorf("%s is not set. Set it in the config file, in the %s or %s env vars, or in the secrets file",
+			name, envvar, envvar+strings.ToUpper(fileSuffix))
+	}
+	return value, nil
+}
+
+// MaskURL returns the URL in raw with the password (if any) masked, to be able to log it.
+func MaskURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.User == nil {
+		return raw
+	}
+	if _, ok := u.User.Password(); !ok {
+		return raw
+	}
+	u.User = url.UserPassword(u.User.Username(), maskedPassword)
+	return u.String()
+}
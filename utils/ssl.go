@@ -26,6 +26,7 @@ Documented here: https://forfuncsake.github.io/post/2017/08/trust-extra-ca-cert-
 import (
 	"crypto/tls"
 	"crypto/x509"
+	"fmt"
 	"io/ioutil"
 	"net/http"
 	"time"
@@ -112,3 +113,41 @@ func GetClient(insecure bool) *http.Client {
 
 	return client
 }
+
+/*
+NewTLSConfig returns a *tls.Config to connect to a server with custom settings.
+
+Parameters:
+- caFile: path of a PEM file with CAs trusted in addition to the system ones.
+  If empty, the CAs added with AddTrustedCAs are trusted.
+- certFile, keyFile: paths of the client certificate and key (optional).
+- insecure: bypasses the SSL verification (do not use in production!!)
+*/
+func NewTLSConfig(caFile, certFile, keyFile string, insecure bool) (*tls.Config, error) {
+	result := &tls.Config{
+		InsecureSkipVerify: insecure,
+		RootCAs:            cas,
+	}
+	if caFile != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		certs, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("Cannot read CA certificates in %s: %s", caFile, err.Error())
+		}
+		if ok := pool.AppendCertsFromPEM(certs); !ok {
+			return nil, fmt.Errorf("Error appending certificates in %s", caFile)
+		}
+		result.RootCAs = pool
+	}
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("Error reading x509 key pair. cert: %s key: %s: %s", certFile, keyFile, err.Error())
+		}
+		result.Certificates = []tls.Certificate{cert}
+	}
+	return result, nil
+}